@@ -21,10 +21,28 @@ const (
 	DoubleType    TypeName = "double"
 	BytesType     TypeName = "bytes"
 	Utf8Type      TypeName = "utf8"
+	TimestampType TypeName = "timestamp"
+	DateType      TypeName = "date"
+	TimeType      TypeName = "time"
+	DurationType  TypeName = "duration"
+	DecimalType   TypeName = "decimal"
+	UuidType      TypeName = "uuid"
+	EnumType      TypeName = "enum"
 	ArrayType     TypeName = "array"
 	StructureType TypeName = "structure"
 )
 
+// TimeUnit is the precision of a TimestampType, TimeType or DurationType: "s", "ms", "us" or "ns", microseconds when
+// not given.
+type TimeUnit string
+
+const (
+	Seconds      TimeUnit = "s"
+	Milliseconds TimeUnit = "ms"
+	Microseconds TimeUnit = "us"
+	Nanoseconds  TimeUnit = "ns"
+)
+
 // Type is either a scalar type, for which TypeName will be:
 // - BooleanType
 // - ByteType
@@ -40,12 +58,25 @@ const (
 // - BytesType
 // - Utf8Type
 // and Values, Fields will be nil
+// or a logical type, for which TypeName will be:
+// - TimestampType, with an optional Unit and Timezone
+// - DateType
+// - TimeType, with an optional Unit
+// - DurationType, with an optional Unit
+// - DecimalType, with its Precision and Scale
+// - UuidType
+// - EnumType, with its Symbols
 // or an ArrayType (TypeName will be ArrayType), Values will be another Type definition and Fields will be nil
 // or a StructureType (TypeName will be StructureType), Values will be nil and Fields will be set with the fields of the structure.
 type Type struct {
-	Name   TypeName
-	Values *Type
-	Fields *Fields
+	Name      TypeName
+	Values    *Type
+	Fields    *Fields
+	Unit      TimeUnit
+	Timezone  string
+	Precision int32
+	Scale     int32
+	Symbols   []string
 }
 
 type Field struct {
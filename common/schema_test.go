@@ -43,3 +43,62 @@ func TestFromYaml(t *testing.T) {
 		},
 	})
 }
+
+func TestFromYamlNested(t *testing.T) {
+	schema, err := FromYaml("../testdata/yaml/nested_schema.yaml")
+	if err != nil {
+		t.Error(err)
+	}
+
+	schema.AssertSchema(t, []FieldAssertion{
+		func(t *testing.T, schema *Schema, index int) {
+			schema.AssertField(t, index, "eventId", false, Type{Name: Utf8Type})
+		},
+		func(t *testing.T, schema *Schema, index int) {
+			schema.AssertField(t, index, "tags", true, Type{Name: ArrayType, Values: &Type{Name: Utf8Type}})
+		},
+		func(t *testing.T, schema *Schema, index int) {
+			schema.AssertField(t, index, "location", true, Type{Name: StructureType, Fields: &Fields{
+				{Name: "latitude", Nullable: false, Type: Type{Name: DoubleType}},
+				{Name: "longitude", Nullable: false, Type: Type{Name: DoubleType}},
+			}})
+		},
+		func(t *testing.T, schema *Schema, index int) {
+			schema.AssertField(t, index, "stops", false, Type{Name: ArrayType, Values: &Type{Name: StructureType, Fields: &Fields{
+				{Name: "name", Nullable: false, Type: Type{Name: Utf8Type}},
+				{Name: "durations", Nullable: true, Type: Type{Name: ArrayType, Values: &Type{Name: IntType}}},
+			}}})
+		},
+	})
+}
+
+func TestFromYamlLogical(t *testing.T) {
+	schema, err := FromYaml("../testdata/yaml/logical_schema.yaml")
+	if err != nil {
+		t.Error(err)
+	}
+
+	schema.AssertSchema(t, []FieldAssertion{
+		func(t *testing.T, schema *Schema, index int) {
+			schema.AssertField(t, index, "tripId", false, Type{Name: UuidType})
+		},
+		func(t *testing.T, schema *Schema, index int) {
+			schema.AssertField(t, index, "pickupTimestamp", false, Type{Name: TimestampType, Unit: Milliseconds, Timezone: "UTC"})
+		},
+		func(t *testing.T, schema *Schema, index int) {
+			schema.AssertField(t, index, "pickupDate", false, Type{Name: DateType})
+		},
+		func(t *testing.T, schema *Schema, index int) {
+			schema.AssertField(t, index, "pickupTime", true, Type{Name: TimeType, Unit: Seconds})
+		},
+		func(t *testing.T, schema *Schema, index int) {
+			schema.AssertField(t, index, "duration", true, Type{Name: DurationType, Unit: Seconds})
+		},
+		func(t *testing.T, schema *Schema, index int) {
+			schema.AssertField(t, index, "fareAmount", false, Type{Name: DecimalType, Precision: 10, Scale: 2})
+		},
+		func(t *testing.T, schema *Schema, index int) {
+			schema.AssertField(t, index, "paymentType", false, Type{Name: EnumType, Symbols: []string{"cash", "card"}})
+		},
+	})
+}
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -26,7 +27,7 @@ func (schema *Schema) AssertField(t *testing.T, index int, name string, nullable
 		t.Errorf("expected nullable of field at: %d to be %v, got: %v", index, nullable, field.Nullable)
 	}
 
-	if field.Type != tpe {
+	if !reflect.DeepEqual(field.Type, tpe) {
 		t.Errorf("expected type of field at: %d to be %+v, got: %+v", index, tpe, field.Type)
 	}
 }
@@ -2,21 +2,47 @@ package main
 
 import (
 	"github.com/exsql-io/go-datastore/common"
+	"github.com/exsql-io/go-datastore/services"
 	"github.com/exsql-io/go-datastore/store"
 	"gopkg.in/yaml.v3"
 	"os"
 )
 
 type Stream struct {
-	Topic  string                `yaml:"topic"`
-	Format store.InputFormatType `yaml:"format"`
-	Schema common.Schema         `yaml:"schema"`
+	Topic   string                `yaml:"topic"`
+	Format  store.InputFormatType `yaml:"format"`
+	Schema  common.Schema         `yaml:"schema"`
+	Options store.Options         `yaml:",inline"`
+	// Group is the consumer group the topic is consumed in, overriding the one derived from the instance id.
+	Group string `yaml:"group"`
+	// Start is the position the partitions of the topic are read from when they are not resumed.
+	Start services.Start `yaml:"start"`
+	// BadRecords is the policy applied to the records of the topic which can't be decoded, they are skipped by default.
+	BadRecords services.BadRecordPolicy `yaml:"badRecords"`
 }
 
 type Configuration struct {
 	InstanceId string `yaml:"instanceId"`
 	Brokers    []string
-	Streams    []Stream `yaml:"streams"`
+	// DataDirectory is the directory the stores of the streams are persisted to, they are kept in memory when empty.
+	DataDirectory string   `yaml:"dataDirectory"`
+	Streams       []Stream `yaml:"streams"`
+	// ConsumerGroups consumes the topic of each stream in a consumer group derived from the instance id, the topics are
+	// otherwise consumed in full by each instance.
+	ConsumerGroups bool `yaml:"consumerGroups"`
+}
+
+// GroupId returns the consumer group the topic of stream is consumed in, or an empty string when it is consumed without.
+func (configuration *Configuration) GroupId(stream Stream) string {
+	if stream.Group != "" {
+		return stream.Group
+	}
+
+	if configuration.ConsumerGroups {
+		return configuration.InstanceId + "." + stream.Topic
+	}
+
+	return ""
 }
 
 func LoadConfiguration(path string) (*Configuration, error) {
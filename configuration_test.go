@@ -2,8 +2,11 @@ package main
 
 import (
 	"github.com/exsql-io/go-datastore/common"
+	"github.com/exsql-io/go-datastore/services"
 	"github.com/exsql-io/go-datastore/store"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestLoadConfiguration(t *testing.T) {
@@ -31,6 +34,101 @@ func TestLoadConfiguration(t *testing.T) {
 	assertStream(configuration, 0, "nyc-taxi-trips", store.Json, t)
 }
 
+func TestLoadConfigurationTable(t *testing.T) {
+	configuration, err := LoadConfiguration("testdata/yaml/table_configuration.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if configuration.DataDirectory != "/var/lib/go-datastore" {
+		t.Errorf("expected DataDirectory field to be '/var/lib/go-datastore', but got: '%s'", configuration.DataDirectory)
+	}
+
+	options := configuration.Streams[0].Options
+	if options.Mode != store.Table {
+		t.Errorf("expected mode of stream at: 0 to be %s, got: %s", store.Table, options.Mode)
+	}
+
+	if !options.Partitioned {
+		t.Errorf("expected stream at: 0 to be partitioned")
+	}
+
+	if len(options.Key) != 1 || options.Key[0] != "vendorId" {
+		t.Errorf("expected key of stream at: 0 to be [vendorId], got: %v", options.Key)
+	}
+
+	expected := store.Retention{MaxAge: 24 * time.Hour, MaxRows: 1000}
+	if options.Retention != expected {
+		t.Errorf("expected retention of stream at: 0 to be %+v, got: %+v", expected, options.Retention)
+	}
+
+	tiering := store.Tiering{MaxHotAge: time.Hour, MaxHotRecords: 4, RowGroupSize: 1024}
+	if options.Tiering != tiering {
+		t.Errorf("expected tiering of stream at: 0 to be %+v, got: %+v", tiering, options.Tiering)
+	}
+
+	indexes := []store.Index{{Column: "vendorId", Kind: store.Hash}, {Column: "name", Kind: store.Bitmap}}
+	if !reflect.DeepEqual(options.Indexes, indexes) {
+		t.Errorf("expected indexes of stream at: 0 to be %+v, got: %+v", indexes, options.Indexes)
+	}
+
+	start := services.Start{Position: services.Offsets, Offsets: map[int32]int64{0: 10, 2: 0}}
+	if !reflect.DeepEqual(configuration.Streams[0].Start, start) {
+		t.Errorf("expected start of stream at: 0 to be %+v, got: %+v", start, configuration.Streams[0].Start)
+	}
+
+	if err := start.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	if err := (services.Start{Position: services.Timestamp}).Validate(); err == nil {
+		t.Errorf("expected a start at a timestamp without timestamp to be rejected")
+	}
+
+	policy := services.BadRecordPolicy{Action: services.DeadLetter, Path: "/var/lib/go-datastore/vendors.dead-letters.jsonl"}
+	if configuration.Streams[0].BadRecords != policy {
+		t.Errorf("expected bad records policy of stream at: 0 to be %+v, got: %+v", policy, configuration.Streams[0].BadRecords)
+	}
+
+	invalid := []services.BadRecordPolicy{
+		{Action: services.DeadLetter},
+		{Action: services.DeadLetter, Topic: "dead-letters", Path: "dead-letters.jsonl"},
+		{Action: services.Skip, Topic: "dead-letters"},
+		{Action: "retry"},
+	}
+
+	for _, policy := range invalid {
+		if err := policy.Validate(); err == nil {
+			t.Errorf("expected bad records policy: %+v to be rejected", policy)
+		}
+	}
+}
+
+func TestConfigurationGroupId(t *testing.T) {
+	configuration, err := LoadConfiguration("testdata/yaml/configuration.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if group := configuration.GroupId(configuration.Streams[0]); group != "" {
+		t.Errorf("expected stream at: 0 to be consumed without group, got: '%s'", group)
+	}
+
+	configuration, err = LoadConfiguration("testdata/yaml/table_configuration.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if group := configuration.GroupId(configuration.Streams[0]); group != "instance-id.vendors" {
+		t.Errorf("expected stream at: 0 to be consumed in group 'instance-id.vendors', got: '%s'", group)
+	}
+
+	stream := Stream{Topic: "vendors", Group: "vendors-readers"}
+	if group := configuration.GroupId(stream); group != "vendors-readers" {
+		t.Errorf("expected stream to be consumed in group 'vendors-readers', got: '%s'", group)
+	}
+}
+
 func assertStream(configuration *Configuration, index int, topic string, format store.InputFormatType, t *testing.T) {
 	stream := configuration.Streams[index]
 	if stream.Topic != topic {
@@ -0,0 +1,308 @@
+package engine
+
+import (
+	"context"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/apache/arrow/go/v13/arrow/array"
+	"github.com/apache/arrow/go/v13/arrow/bitutil"
+	"github.com/apache/arrow/go/v13/arrow/compute"
+	"github.com/apache/arrow/go/v13/arrow/memory"
+)
+
+// drain pulls every remaining batch out of operator, the returned batches must be released by the caller.
+func drain(operator VolcanoOperator) ([]arrow.Record, error) {
+	var batches []arrow.Record
+	for {
+		batch, err := operator.Next()
+		if err == EOB {
+			return batches, nil
+		}
+
+		if err != nil {
+			releaseRecords(batches)
+			return nil, err
+		}
+
+		batches = append(batches, *batch)
+	}
+}
+
+// Concatenate merges batches sharing the same schema into a single record.
+func Concatenate(ctx context.Context, batches []arrow.Record) (arrow.Record, error) {
+	if len(batches) == 1 {
+		batches[0].Retain()
+		return batches[0], nil
+	}
+
+	schema := batches[0].Schema()
+	rows := int64(0)
+	for _, batch := range batches {
+		rows += batch.NumRows()
+	}
+
+	columns := make([]arrow.Array, 0, len(schema.Fields()))
+	defer func() { releaseArrays(columns) }()
+
+	chunks := make([]arrow.Array, len(batches))
+	for i := 0; i < len(schema.Fields()); i++ {
+		for j, batch := range batches {
+			chunks[j] = batch.Column(i)
+		}
+
+		column, err := array.Concatenate(chunks, compute.GetAllocator(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		columns = append(columns, column)
+	}
+
+	return array.NewRecord(schema, columns, rows), nil
+}
+
+// TakeRows builds a record out of the rows of batch located at rows, the dictionary and extension columns included.
+func TakeRows(ctx context.Context, batch arrow.Record, rows []int64) (arrow.Record, error) {
+	indices := newIndices(ctx, rows, nil)
+	defer indices.Release()
+
+	return take(ctx, batch, indices)
+}
+
+// take builds a record out of the rows of batch located at indices, null indices produce null rows.
+func take(ctx context.Context, batch arrow.Record, indices arrow.Array) (arrow.Record, error) {
+	columns, err := takeColumns(ctx, batch.Columns(), indices)
+	if err != nil {
+		return nil, err
+	}
+
+	defer releaseArrays(columns)
+
+	return array.NewRecord(batch.Schema(), columns, int64(indices.Len())), nil
+}
+
+func takeColumns(ctx context.Context, columns []arrow.Array, indices arrow.Array) ([]arrow.Array, error) {
+	taken := make([]arrow.Array, 0, len(columns))
+	for _, column := range columns {
+		values, err := takeArray(ctx, column, indices)
+		if err != nil {
+			releaseArrays(taken)
+			return nil, err
+		}
+
+		taken = append(taken, values)
+	}
+
+	return taken, nil
+}
+
+// takeArray takes the values of column located at indices, like compute.TakeArray which does not support the
+// dictionary and extension arrays, nor the structures and lists nesting them.
+func takeArray(ctx context.Context, column arrow.Array, indices arrow.Array) (arrow.Array, error) {
+	if !hasUntakeableType(column.DataType()) {
+		return compute.TakeArray(ctx, column, indices)
+	}
+
+	switch c := column.(type) {
+	case *array.Dictionary:
+		taken, err := compute.TakeArray(ctx, c.Indices(), indices)
+		if err != nil {
+			return nil, err
+		}
+
+		defer taken.Release()
+
+		return array.NewDictionaryArray(c.DataType(), taken, c.Dictionary()), nil
+	case array.ExtensionArray:
+		storage, err := takeArray(ctx, c.Storage(), indices)
+		if err != nil {
+			return nil, err
+		}
+
+		defer storage.Release()
+
+		return array.NewExtensionArrayWithStorage(c.DataType().(arrow.ExtensionType), storage), nil
+	case *array.Struct:
+		return takeStruct(ctx, c, indices)
+	case *array.List:
+		return takeList(ctx, c, indices)
+	}
+
+	return compute.TakeArray(ctx, column, indices)
+}
+
+func takeStruct(ctx context.Context, structs *array.Struct, indices arrow.Array) (arrow.Array, error) {
+	validity := booleanArray(ctx, structs.Len(), func(row int) (bool, bool) {
+		return structs.IsValid(row), true
+	})
+
+	defer validity.Release()
+
+	columns := []arrow.Array{validity}
+	for i := 0; i < structs.NumField(); i++ {
+		columns = append(columns, structs.Field(i))
+	}
+
+	taken, err := takeColumns(ctx, columns, indices)
+	if err != nil {
+		return nil, err
+	}
+
+	defer releaseArrays(taken)
+
+	fields := structs.DataType().(*arrow.StructType).Fields()
+	data := make([]arrow.ArrayData, len(fields))
+	for i := range fields {
+		data[i] = taken[i+1].Data()
+	}
+
+	valid := taken[0].(*array.Boolean)
+	bitmap := memory.NewResizableBuffer(compute.GetAllocator(ctx))
+	defer bitmap.Release()
+
+	bitmap.Resize(int(bitutil.BytesForBits(int64(valid.Len()))))
+	nulls := 0
+	for row := 0; row < valid.Len(); row++ {
+		isValid := valid.IsValid(row) && valid.Value(row)
+		bitutil.SetBitTo(bitmap.Bytes(), row, isValid)
+		if !isValid {
+			nulls += 1
+		}
+	}
+
+	result := array.NewData(structs.DataType(), valid.Len(), []*memory.Buffer{bitmap}, data, nulls, 0)
+	defer result.Release()
+
+	return array.MakeFromData(result), nil
+}
+
+func takeList(ctx context.Context, lists *array.List, indices arrow.Array) (arrow.Array, error) {
+	positions := indices.(*array.Int64)
+	offsets := make([]int32, 0, positions.Len()+1)
+	valid := make([]bool, positions.Len())
+	var valueIndices []int64
+	offsets = append(offsets, 0)
+	for row := 0; row < positions.Len(); row++ {
+		position := int(positions.Value(row))
+		if positions.IsValid(row) && lists.IsValid(position) {
+			valid[row] = true
+			start, end := lists.ValueOffsets(position)
+			for index := start; index < end; index++ {
+				valueIndices = append(valueIndices, index)
+			}
+		}
+
+		offsets = append(offsets, int32(len(valueIndices)))
+	}
+
+	valuePositions := newIndices(ctx, valueIndices, nil)
+	defer valuePositions.Release()
+
+	values, err := takeArray(ctx, lists.ListValues(), valuePositions)
+	if err != nil {
+		return nil, err
+	}
+
+	defer values.Release()
+
+	builder := array.NewInt32Builder(compute.GetAllocator(ctx))
+	defer builder.Release()
+
+	builder.AppendValues(offsets, nil)
+	offsetsArray := builder.NewInt32Array()
+	defer offsetsArray.Release()
+
+	validity := array.NewBooleanBuilder(compute.GetAllocator(ctx))
+	defer validity.Release()
+
+	validity.AppendValues(valid, nil)
+	validityArray := validity.NewBooleanArray()
+	defer validityArray.Release()
+
+	nulls := 0
+	bitmap := memory.NewResizableBuffer(compute.GetAllocator(ctx))
+	defer bitmap.Release()
+
+	bitmap.Resize(int(bitutil.BytesForBits(int64(len(valid)))))
+	for row, isValid := range valid {
+		bitutil.SetBitTo(bitmap.Bytes(), row, isValid)
+		if !isValid {
+			nulls += 1
+		}
+	}
+
+	result := array.NewData(lists.DataType(), len(valid), []*memory.Buffer{bitmap, offsetsArray.Data().Buffers()[1]}, []arrow.ArrayData{values.Data()}, nulls, 0)
+	defer result.Release()
+
+	return array.MakeFromData(result), nil
+}
+
+// hasUntakeableType tells whether dataType is, or nests, a type which compute.TakeArray does not support.
+func hasUntakeableType(dataType arrow.DataType) bool {
+	switch t := dataType.(type) {
+	case *arrow.DictionaryType, arrow.ExtensionType:
+		return true
+	case *arrow.StructType:
+		for _, field := range t.Fields() {
+			if hasUntakeableType(field.Type) {
+				return true
+			}
+		}
+	case *arrow.ListType:
+		return hasUntakeableType(t.Elem())
+	}
+
+	return false
+}
+
+// FilterRecord keeps the rows of batch for which selector is true.
+func FilterRecord(ctx context.Context, batch arrow.Record, selector arrow.Array) (arrow.Record, error) {
+	if !hasUntakeableType(arrow.StructOf(batch.Schema().Fields()...)) {
+		return compute.FilterRecordBatch(ctx, batch, selector, compute.DefaultFilterOptions())
+	}
+
+	selected := selector.(*array.Boolean)
+	var indices []int64
+	for row := 0; row < selected.Len(); row++ {
+		if selected.IsValid(row) && selected.Value(row) {
+			indices = append(indices, int64(row))
+		}
+	}
+
+	positions := newIndices(ctx, indices, nil)
+	defer positions.Release()
+
+	return take(ctx, batch, positions)
+}
+
+func newEmptyRecord(ctx context.Context, schema *arrow.Schema) arrow.Record {
+	columns := make([]arrow.Array, len(schema.Fields()))
+	for i, field := range schema.Fields() {
+		columns[i] = array.MakeArrayOfNull(compute.GetAllocator(ctx), field.Type, 0)
+	}
+
+	defer releaseArrays(columns)
+
+	return array.NewRecord(schema, columns, 0)
+}
+
+func newIndices(ctx context.Context, indices []int64, valid []bool) arrow.Array {
+	builder := array.NewInt64Builder(compute.GetAllocator(ctx))
+	defer builder.Release()
+
+	builder.AppendValues(indices, valid)
+	return builder.NewArray()
+}
+
+func releaseRecords(records []arrow.Record) {
+	for _, record := range records {
+		record.Release()
+	}
+}
+
+func releaseArrays(arrays []arrow.Array) {
+	for _, a := range arrays {
+		if a != nil {
+			a.Release()
+		}
+	}
+}
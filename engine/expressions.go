@@ -0,0 +1,355 @@
+package engine
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/apache/arrow/go/v13/arrow/array"
+	"github.com/apache/arrow/go/v13/arrow/compute"
+	"github.com/apache/arrow/go/v13/arrow/compute/exprs"
+	"github.com/apache/arrow/go/v13/arrow/decimal128"
+	"github.com/apache/arrow/go/v13/arrow/scalar"
+	"github.com/substrait-io/substrait-go/expr"
+	"github.com/substrait-io/substrait-go/types"
+	"strings"
+)
+
+// arrowFunctions maps the substrait scalar functions to the arrow compute function implementing them.
+var arrowFunctions = map[string]string{
+	"equal":     "equal",
+	"not_equal": "not_equal",
+	"lt":        "less",
+	"lte":       "less_equal",
+	"gt":        "greater",
+	"gte":       "greater_equal",
+	"add":       "add",
+	"subtract":  "subtract",
+	"multiply":  "multiply",
+	"divide":    "divide",
+	"negate":    "negate",
+	"abs":       "abs",
+	"power":     "power",
+	"sqrt":      "sqrt",
+	"and":       "and_kleene",
+	"or":        "or_kleene",
+	"xor":       "xor",
+}
+
+// goFunctions implements the substrait scalar functions which have no arrow compute equivalent, their arguments are
+// materialized as arrays of the length of the batch.
+var goFunctions = map[string]func(ctx context.Context, args []arrow.Array) (arrow.Array, error){
+	"is_null":              isNull,
+	"is_not_null":          isNotNull,
+	"is_not_distinct_from": isNotDistinctFrom,
+	"like":                 like,
+}
+
+var emptySchema = arrow.NewSchema(nil, nil)
+
+// EvaluateExpression evaluates a substrait scalar expression against every row of batch and returns the resulting
+// column. The allocator and the extension set are taken from the context, see compute.WithAllocator and
+// exprs.WithExtensionIDSet.
+func EvaluateExpression(ctx context.Context, expression expr.Expression, batch arrow.Record) (arrow.Array, error) {
+	datum, err := evaluate(ctx, expression, batch)
+	if err != nil {
+		return nil, err
+	}
+
+	defer datum.Release()
+
+	return toArray(ctx, datum, int(batch.NumRows()))
+}
+
+// EvaluateScalar evaluates a substrait expression which references no column as a single value.
+func EvaluateScalar(ctx context.Context, expression expr.Expression) (scalar.Scalar, error) {
+	batch := array.NewRecord(emptySchema, nil, 1)
+	defer batch.Release()
+
+	datum, err := evaluate(ctx, expression, batch)
+	if err != nil {
+		return nil, err
+	}
+
+	defer datum.Release()
+
+	switch d := datum.(type) {
+	case *compute.ScalarDatum:
+		return d.Value, nil
+	case *compute.ArrayDatum:
+		values := d.MakeArray()
+		defer values.Release()
+
+		return scalar.GetScalar(values, 0)
+	}
+
+	return nil, fmt.Errorf("%w: unexpected datum kind: %s", arrow.ErrInvalid, datum.Kind())
+}
+
+func evaluate(ctx context.Context, expression expr.Expression, batch arrow.Record) (compute.Datum, error) {
+	switch e := expression.(type) {
+	case *expr.FieldReference:
+		return evaluateFieldReference(ctx, e, batch)
+	case *expr.ProtoLiteral:
+		if decimalType, ok := e.Type.(*types.DecimalType); ok {
+			return decimalLiteral(e, decimalType)
+		}
+
+		if interval, ok := e.Value.(*types.IntervalDayToSecond); ok {
+			// arrow adds durations rather than intervals to the timestamps.
+			microseconds := (int64(interval.Days)*86400+int64(interval.Seconds))*1_000_000 + int64(interval.Microseconds)
+			return compute.NewDatum(scalar.NewDurationScalar(arrow.Duration(microseconds), arrow.FixedWidthTypes.Duration_us)), nil
+		}
+
+		return exprs.ExecuteScalarExpression(ctx, emptySchema, e, compute.NewDatumWithoutOwning(batch))
+	case expr.Literal:
+		return exprs.ExecuteScalarExpression(ctx, emptySchema, e, compute.NewDatumWithoutOwning(batch))
+	case *expr.Cast:
+		input, err := evaluate(ctx, e.Input, batch)
+		if err != nil {
+			return nil, err
+		}
+
+		defer input.Release()
+
+		dataType, _, err := exprs.FromSubstraitType(e.Type, exprs.GetExtensionIDSet(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		return castDatum(ctx, input, dataType)
+	case *expr.ScalarFunction:
+		return evaluateScalarFunction(ctx, e, batch)
+	}
+
+	return nil, fmt.Errorf("%w: expression '%s' is not supported", arrow.ErrNotImplemented, expression)
+}
+
+func evaluateFieldReference(ctx context.Context, reference *expr.FieldReference, batch arrow.Record) (compute.Datum, error) {
+	if reference.Root != expr.RootReference {
+		return nil, fmt.Errorf("%w: only root field references are supported, got: '%s'", arrow.ErrNotImplemented, reference)
+	}
+
+	field, ok := reference.Reference.(*expr.StructFieldRef)
+	if !ok {
+		return nil, fmt.Errorf("%w: only field references are supported, got: '%s'", arrow.ErrNotImplemented, reference)
+	}
+
+	if field.Field < 0 || int64(field.Field) >= batch.NumCols() {
+		return nil, fmt.Errorf("%w: field reference %d is out of range, batch has %d columns", arrow.ErrIndex, field.Field, batch.NumCols())
+	}
+
+	column := batch.Column(int(field.Field))
+	column.Retain()
+	for segment := field.Child; segment != nil; segment = segment.GetChild() {
+		next, err := referenceSegment(ctx, column, segment)
+		column.Release()
+		if err != nil {
+			return nil, err
+		}
+
+		column = next
+	}
+
+	defer column.Release()
+
+	return compute.NewDatum(column), nil
+}
+
+func evaluateScalarFunction(ctx context.Context, function *expr.ScalarFunction, batch arrow.Record) (compute.Datum, error) {
+	args := make([]compute.Datum, 0, function.NArgs())
+	defer func() {
+		for _, arg := range args {
+			arg.Release()
+		}
+	}()
+
+	var options []string
+	for i := 0; i < function.NArgs(); i++ {
+		if option, ok := function.Arg(i).(types.Enum); ok {
+			options = append(options, string(option))
+			continue
+		}
+
+		argument, ok := function.Arg(i).(expr.Expression)
+		if !ok {
+			return nil, fmt.Errorf("%w: argument %d of function '%s' is not an expression", arrow.ErrNotImplemented, i, function.ID().Name)
+		}
+
+		arg, err := evaluate(ctx, argument, batch)
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, arg)
+	}
+
+	name, _, _ := strings.Cut(function.ID().Name, ":")
+	switch name {
+	case "not":
+		return compute.CallFunction(ctx, "xor", nil, args[0], compute.NewDatum(true))
+	case "and", "or":
+		return foldFunction(ctx, arrowFunctions[name], args)
+	case "between":
+		return between(ctx, args)
+	case "extract":
+		return callGoFunction(ctx, func(ctx context.Context, args []arrow.Array) (arrow.Array, error) {
+			return extract(ctx, options[0], args)
+		}, args, int(batch.NumRows()))
+	}
+
+	if goFunction, ok := goFunctions[name]; ok {
+		return callGoFunction(ctx, goFunction, args, int(batch.NumRows()))
+	}
+
+	arrowName, ok := arrowFunctions[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: function '%s' is not supported", arrow.ErrNotImplemented, function.ID().Name)
+	}
+
+	for i, arg := range args {
+		storage := storageDatum(arg)
+		arg.Release()
+		args[i] = storage
+	}
+
+	return compute.CallFunction(ctx, arrowName, nil, args...)
+}
+
+// castDatum casts datum to dataType, arrow does not cast the extension types which are thus cast through their storage
+// type.
+func castDatum(ctx context.Context, datum compute.Datum, dataType arrow.DataType) (compute.Datum, error) {
+	storage := storageDatum(datum)
+	defer storage.Release()
+
+	extensionType, ok := dataType.(arrow.ExtensionType)
+	if !ok {
+		return compute.CastDatum(ctx, storage, compute.SafeCastOptions(dataType))
+	}
+
+	cast, err := compute.CastDatum(ctx, storage, compute.SafeCastOptions(extensionType.StorageType()))
+	if err != nil {
+		return nil, err
+	}
+
+	defer cast.Release()
+
+	switch c := cast.(type) {
+	case *compute.ArrayDatum:
+		values := c.MakeArray()
+		defer values.Release()
+
+		extension := array.NewExtensionArrayWithStorage(extensionType, values)
+		defer extension.Release()
+
+		return compute.NewDatum(extension), nil
+	case *compute.ScalarDatum:
+		return compute.NewDatum(scalar.NewExtensionScalar(c.Value, extensionType)), nil
+	}
+
+	return nil, fmt.Errorf("%w: unexpected datum kind: %s", arrow.ErrInvalid, cast.Kind())
+}
+
+// storageDatum returns the values of an extension datum as their storage type, other datums are returned as is.
+func storageDatum(datum compute.Datum) compute.Datum {
+	switch d := datum.(type) {
+	case *compute.ArrayDatum:
+		if _, ok := d.Type().(arrow.ExtensionType); ok {
+			values := d.MakeArray()
+			defer values.Release()
+
+			return compute.NewDatum(values.(array.ExtensionArray).Storage())
+		}
+	case *compute.ScalarDatum:
+		if extension, ok := d.Value.(*scalar.Extension); ok {
+			return compute.NewDatum(extension.Value)
+		}
+	}
+
+	return compute.NewDatum(datum)
+}
+
+// decimalLiteral converts a decimal literal, whose value substrait keeps as the 16 bytes of a little-endian 128 bits
+// integer which arrow does not read.
+func decimalLiteral(literal *expr.ProtoLiteral, decimalType *types.DecimalType) (compute.Datum, error) {
+	value, ok := literal.Value.([]byte)
+	if !ok || len(value) != arrow.Decimal128SizeBytes {
+		return nil, fmt.Errorf("%w: decimal literal '%s' is not valid", arrow.ErrInvalid, literal)
+	}
+
+	number := decimal128.New(int64(binary.LittleEndian.Uint64(value[8:])), binary.LittleEndian.Uint64(value[:8]))
+	return compute.NewDatum(scalar.NewDecimal128Scalar(number, &arrow.Decimal128Type{Precision: decimalType.Precision, Scale: decimalType.Scale})), nil
+}
+
+// foldFunction applies a binary arrow function over a variadic list of arguments, from left to right.
+func foldFunction(ctx context.Context, name string, args []compute.Datum) (compute.Datum, error) {
+	result := compute.NewDatum(args[0])
+	for _, arg := range args[1:] {
+		next, err := compute.CallFunction(ctx, name, nil, result, arg)
+		result.Release()
+		if err != nil {
+			return nil, err
+		}
+
+		result = next
+	}
+
+	return result, nil
+}
+
+func between(ctx context.Context, args []compute.Datum) (compute.Datum, error) {
+	low, err := compute.CallFunction(ctx, "greater_equal", nil, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	defer low.Release()
+
+	high, err := compute.CallFunction(ctx, "less_equal", nil, args[0], args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	defer high.Release()
+
+	return compute.CallFunction(ctx, "and_kleene", nil, low, high)
+}
+
+func callGoFunction(ctx context.Context, function func(context.Context, []arrow.Array) (arrow.Array, error), args []compute.Datum, length int) (compute.Datum, error) {
+	arrays := make([]arrow.Array, 0, len(args))
+	defer func() {
+		for _, array := range arrays {
+			array.Release()
+		}
+	}()
+
+	for _, arg := range args {
+		array, err := toArray(ctx, arg, length)
+		if err != nil {
+			return nil, err
+		}
+
+		arrays = append(arrays, array)
+	}
+
+	result, err := function(ctx, arrays)
+	if err != nil {
+		return nil, err
+	}
+
+	defer result.Release()
+
+	return compute.NewDatum(result), nil
+}
+
+// toArray materializes the datum as an array of the given length, broadcasting scalars.
+func toArray(ctx context.Context, datum compute.Datum, length int) (arrow.Array, error) {
+	switch d := datum.(type) {
+	case *compute.ArrayDatum:
+		return d.MakeArray(), nil
+	case *compute.ScalarDatum:
+		return scalar.MakeArrayFromScalar(d.Value, length, compute.GetAllocator(ctx))
+	}
+
+	return nil, fmt.Errorf("%w: unexpected datum kind: %s", arrow.ErrInvalid, datum.Kind())
+}
@@ -0,0 +1,213 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/apache/arrow/go/v13/arrow/array"
+	"github.com/apache/arrow/go/v13/arrow/compute"
+	"regexp"
+	"strings"
+	"time"
+)
+
+func isNull(ctx context.Context, args []arrow.Array) (arrow.Array, error) {
+	return booleanArray(ctx, args[0].Len(), func(row int) (bool, bool) {
+		return args[0].IsNull(row), true
+	}), nil
+}
+
+func isNotNull(ctx context.Context, args []arrow.Array) (arrow.Array, error) {
+	return booleanArray(ctx, args[0].Len(), func(row int) (bool, bool) {
+		return args[0].IsValid(row), true
+	}), nil
+}
+
+// isNotDistinctFrom is an equality considering two nulls as equal, it never returns null.
+func isNotDistinctFrom(ctx context.Context, args []arrow.Array) (arrow.Array, error) {
+	left, right := args[0], args[1]
+	if !arrow.TypeEqual(left.DataType(), right.DataType()) {
+		return nil, fmt.Errorf("%w: cannot compare values of type: '%s' and '%s'", arrow.ErrInvalid, left.DataType(), right.DataType())
+	}
+
+	return booleanArray(ctx, left.Len(), func(row int) (bool, bool) {
+		return CompareValues(left, row, right, row) == 0, true
+	}), nil
+}
+
+// like matches strings against a sql pattern where '%' matches any sequence of characters and '_' any single one.
+func like(ctx context.Context, args []arrow.Array) (arrow.Array, error) {
+	values, ok := args[0].(*array.String)
+	if !ok {
+		return nil, fmt.Errorf("%w: like expects strings, got: '%s'", arrow.ErrInvalid, args[0].DataType())
+	}
+
+	patterns, ok := args[1].(*array.String)
+	if !ok {
+		return nil, fmt.Errorf("%w: like expects a string pattern, got: '%s'", arrow.ErrInvalid, args[1].DataType())
+	}
+
+	compiled := make(map[string]*regexp.Regexp)
+	var err error
+	result := booleanArray(ctx, values.Len(), func(row int) (bool, bool) {
+		if values.IsNull(row) || patterns.IsNull(row) || err != nil {
+			return false, false
+		}
+
+		pattern := patterns.Value(row)
+		expression, ok := compiled[pattern]
+		if !ok {
+			expression, err = likeToRegexp(pattern)
+			if err != nil {
+				return false, false
+			}
+
+			compiled[pattern] = expression
+		}
+
+		return expression.MatchString(values.Value(row)), true
+	})
+
+	if err != nil {
+		result.Release()
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func likeToRegexp(pattern string) (*regexp.Regexp, error) {
+	var builder strings.Builder
+	builder.WriteString("(?s)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			builder.WriteString(".*")
+		case '_':
+			builder.WriteString(".")
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	builder.WriteString("$")
+
+	return regexp.Compile(builder.String())
+}
+
+// extract returns a component of timestamps, dates or times, the optional second argument is the time zone in which
+// the components of the timestamps are extracted.
+func extract(ctx context.Context, component string, args []arrow.Array) (arrow.Array, error) {
+	var value func(row int) time.Time
+	switch values := args[0].(type) {
+	case *array.Timestamp:
+		unit := values.DataType().(*arrow.TimestampType).Unit
+		value = func(row int) time.Time { return values.Value(row).ToTime(unit) }
+	case *array.Date32:
+		value = func(row int) time.Time { return values.Value(row).ToTime() }
+	case *array.Time32:
+		unit := values.DataType().(*arrow.Time32Type).Unit
+		value = func(row int) time.Time { return values.Value(row).ToTime(unit) }
+	case *array.Time64:
+		unit := values.DataType().(*arrow.Time64Type).Unit
+		value = func(row int) time.Time { return values.Value(row).ToTime(unit) }
+	default:
+		return nil, fmt.Errorf("%w: extract expects timestamps, dates or times, got: '%s'", arrow.ErrInvalid, args[0].DataType())
+	}
+
+	locations := make(map[string]*time.Location)
+	builder := array.NewInt64Builder(compute.GetAllocator(ctx))
+	defer builder.Release()
+
+	builder.Reserve(args[0].Len())
+	for row := 0; row < args[0].Len(); row++ {
+		if args[0].IsNull(row) {
+			builder.UnsafeAppendBoolToBitmap(false)
+			continue
+		}
+
+		t := value(row)
+		if len(args) > 1 && args[1].IsValid(row) {
+			timezone := args[1].(*array.String).Value(row)
+			location, ok := locations[timezone]
+			if !ok {
+				var err error
+				if location, err = time.LoadLocation(timezone); err != nil {
+					return nil, fmt.Errorf("%w: timezone '%s' is not valid: %s", arrow.ErrInvalid, timezone, err)
+				}
+
+				locations[timezone] = location
+			}
+
+			t = t.In(location)
+		}
+
+		part, err := timeComponent(t, component)
+		if err != nil {
+			return nil, err
+		}
+
+		builder.UnsafeAppend(part)
+	}
+
+	return builder.NewArray(), nil
+}
+
+func timeComponent(t time.Time, component string) (int64, error) {
+	switch component {
+	case "YEAR":
+		return int64(t.Year()), nil
+	case "ISO_YEAR":
+		year, _ := t.ISOWeek()
+		return int64(year), nil
+	case "QUARTER":
+		return int64(t.Month()-1)/3 + 1, nil
+	case "MONTH":
+		return int64(t.Month()), nil
+	case "DAY":
+		return int64(t.Day()), nil
+	case "DAY_OF_YEAR":
+		return int64(t.YearDay()), nil
+	case "MONDAY_DAY_OF_WEEK":
+		return int64(t.Weekday()+6)%7 + 1, nil
+	case "SUNDAY_DAY_OF_WEEK":
+		return int64(t.Weekday()) + 1, nil
+	case "ISO_WEEK":
+		_, week := t.ISOWeek()
+		return int64(week), nil
+	case "HOUR":
+		return int64(t.Hour()), nil
+	case "MINUTE":
+		return int64(t.Minute()), nil
+	case "SECOND":
+		return int64(t.Second()), nil
+	case "MILLISECOND":
+		return int64(t.Nanosecond() / 1_000_000), nil
+	case "MICROSECOND":
+		return int64(t.Nanosecond()/1_000) % 1_000, nil
+	case "SUBSECOND":
+		return int64(t.Nanosecond() / 1_000), nil
+	case "UNIX_TIME":
+		return t.Unix(), nil
+	}
+
+	return 0, fmt.Errorf("%w: component '%s' of extract is not supported", arrow.ErrNotImplemented, component)
+}
+
+// booleanArray builds a boolean array of the given length, value returns the value of a row and whether it is valid.
+func booleanArray(ctx context.Context, length int, value func(row int) (bool, bool)) arrow.Array {
+	builder := array.NewBooleanBuilder(compute.GetAllocator(ctx))
+	defer builder.Release()
+
+	builder.Reserve(length)
+	for row := 0; row < length; row++ {
+		v, valid := value(row)
+		if valid {
+			builder.UnsafeAppend(v)
+		} else {
+			builder.UnsafeAppendBoolToBitmap(false)
+		}
+	}
+
+	return builder.NewArray()
+}
@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/apache/arrow/go/v13/arrow/array"
+	"github.com/apache/arrow/go/v13/arrow/bitutil"
+	"github.com/apache/arrow/go/v13/arrow/compute"
+	"github.com/apache/arrow/go/v13/arrow/memory"
+	"github.com/substrait-io/substrait-go/expr"
+)
+
+// referenceSegment evaluates a segment of a field reference over column, the returned array is owned by the caller.
+func referenceSegment(ctx context.Context, column arrow.Array, segment expr.ReferenceSegment) (arrow.Array, error) {
+	switch s := segment.(type) {
+	case *expr.StructFieldRef:
+		return structField(ctx, column, s.Field)
+	case *expr.ListElementRef:
+		return listElement(ctx, column, s.Offset)
+	}
+
+	return nil, fmt.Errorf("%w: reference segment '%s' is not supported", arrow.ErrNotImplemented, segment)
+}
+
+// structField returns a field of the structures of column, it is null wherever the structure itself is null.
+func structField(ctx context.Context, column arrow.Array, field int32) (arrow.Array, error) {
+	structs, ok := column.(*array.Struct)
+	if !ok || field < 0 || int(field) >= structs.NumField() {
+		return nil, fmt.Errorf("%w: field %d cannot be referenced in a column of type: '%s'", arrow.ErrInvalid, field, column.DataType())
+	}
+
+	child := structs.Field(int(field))
+	if structs.NullN() == 0 {
+		child.Retain()
+		return child, nil
+	}
+
+	data := child.Data()
+	validity := memory.NewResizableBuffer(compute.GetAllocator(ctx))
+	defer validity.Release()
+
+	validity.Resize(int(bitutil.BytesForBits(int64(data.Offset() + data.Len()))))
+	for i := 0; i < child.Len(); i++ {
+		bitutil.SetBitTo(validity.Bytes(), data.Offset()+i, structs.IsValid(i) && child.IsValid(i))
+	}
+
+	buffers := append([]*memory.Buffer{validity}, data.Buffers()[1:]...)
+	combined := array.NewData(data.DataType(), data.Len(), buffers, data.Children(), array.UnknownNullCount, data.Offset())
+	defer combined.Release()
+
+	return array.MakeFromData(combined), nil
+}
+
+// listElement returns the element at the 0-based offset of the lists of column, it is null wherever the list is null
+// or has no such element.
+func listElement(ctx context.Context, column arrow.Array, offset int32) (arrow.Array, error) {
+	lists, ok := column.(array.ListLike)
+	if !ok {
+		return nil, fmt.Errorf("%w: element %d cannot be referenced in a column of type: '%s'", arrow.ErrInvalid, offset, column.DataType())
+	}
+
+	builder := array.NewInt64Builder(compute.GetAllocator(ctx))
+	defer builder.Release()
+
+	for i := 0; i < lists.Len(); i++ {
+		start, end := lists.ValueOffsets(i)
+		if lists.IsNull(i) || offset < 0 || int64(offset) >= end-start {
+			builder.AppendNull()
+			continue
+		}
+
+		builder.Append(start + int64(offset))
+	}
+
+	indices := builder.NewArray()
+	defer indices.Release()
+
+	return takeArray(ctx, lists.ListValues(), indices)
+}
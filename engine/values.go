@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/apache/arrow/go/v13/arrow/array"
+	"math"
+	"strings"
+)
+
+// CompareValues compares the value at row i of left with the value at row j of right, both arrays are expected to
+// share the same data type. Nulls are considered equal to each other and lower than any other value.
+func CompareValues(left arrow.Array, i int, right arrow.Array, j int) int {
+	leftNull, rightNull := left.IsNull(i), right.IsNull(j)
+	switch {
+	case leftNull && rightNull:
+		return 0
+	case leftNull:
+		return -1
+	case rightNull:
+		return 1
+	}
+
+	switch l := left.(type) {
+	case *array.Boolean:
+		return compareOrdered(boolToInt(l.Value(i)), boolToInt(right.(*array.Boolean).Value(j)))
+	case *array.Int8:
+		return compareOrdered(l.Value(i), right.(*array.Int8).Value(j))
+	case *array.Int16:
+		return compareOrdered(l.Value(i), right.(*array.Int16).Value(j))
+	case *array.Int32:
+		return compareOrdered(l.Value(i), right.(*array.Int32).Value(j))
+	case *array.Int64:
+		return compareOrdered(l.Value(i), right.(*array.Int64).Value(j))
+	case *array.Uint8:
+		return compareOrdered(l.Value(i), right.(*array.Uint8).Value(j))
+	case *array.Uint16:
+		return compareOrdered(l.Value(i), right.(*array.Uint16).Value(j))
+	case *array.Uint32:
+		return compareOrdered(l.Value(i), right.(*array.Uint32).Value(j))
+	case *array.Uint64:
+		return compareOrdered(l.Value(i), right.(*array.Uint64).Value(j))
+	case *array.Float32:
+		return compareOrdered(l.Value(i), right.(*array.Float32).Value(j))
+	case *array.Float64:
+		return compareOrdered(l.Value(i), right.(*array.Float64).Value(j))
+	case *array.String:
+		return strings.Compare(l.Value(i), right.(*array.String).Value(j))
+	case *array.Binary:
+		return bytes.Compare(l.Value(i), right.(*array.Binary).Value(j))
+	case *array.FixedSizeBinary:
+		return bytes.Compare(l.Value(i), right.(*array.FixedSizeBinary).Value(j))
+	case *array.Decimal128:
+		return l.Value(i).Cmp(right.(*array.Decimal128).Value(j))
+	case *array.Timestamp:
+		return compareOrdered(l.Value(i), right.(*array.Timestamp).Value(j))
+	case *array.Date32:
+		return compareOrdered(l.Value(i), right.(*array.Date32).Value(j))
+	case *array.Time32:
+		return compareOrdered(l.Value(i), right.(*array.Time32).Value(j))
+	case *array.Time64:
+		return compareOrdered(l.Value(i), right.(*array.Time64).Value(j))
+	case *array.Duration:
+		return compareOrdered(l.Value(i), right.(*array.Duration).Value(j))
+	case *array.Dictionary:
+		r := right.(*array.Dictionary)
+		return CompareValues(l.Dictionary(), l.GetValueIndex(i), r.Dictionary(), r.GetValueIndex(j))
+	case array.ExtensionArray:
+		return CompareValues(l.Storage(), i, right.(array.ExtensionArray).Storage(), j)
+	}
+
+	return strings.Compare(left.ValueStr(i), right.ValueStr(j))
+}
+
+type ordered interface {
+	~int8 | ~int16 | ~int32 | ~int64 | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~float32 | ~float64
+}
+
+func compareOrdered[T ordered](left T, right T) int {
+	switch {
+	case left < right:
+		return -1
+	case left > right:
+		return 1
+	}
+
+	return 0
+}
+
+func boolToInt(value bool) int8 {
+	if value {
+		return 1
+	}
+
+	return 0
+}
+
+// appendKey appends an unambiguous binary encoding of the value at the given row to key, it is used to build hash
+// keys for grouping, joining and set operations.
+func appendKey(key []byte, column arrow.Array, row int) []byte {
+	if column.IsNull(row) {
+		return append(key, 0)
+	}
+
+	key = append(key, 1)
+	switch c := column.(type) {
+	case *array.Boolean:
+		return append(key, byte(boolToInt(c.Value(row))))
+	case *array.Int8:
+		return binary.LittleEndian.AppendUint64(key, uint64(c.Value(row)))
+	case *array.Int16:
+		return binary.LittleEndian.AppendUint64(key, uint64(c.Value(row)))
+	case *array.Int32:
+		return binary.LittleEndian.AppendUint64(key, uint64(c.Value(row)))
+	case *array.Int64:
+		return binary.LittleEndian.AppendUint64(key, uint64(c.Value(row)))
+	case *array.Uint8:
+		return binary.LittleEndian.AppendUint64(key, uint64(c.Value(row)))
+	case *array.Uint16:
+		return binary.LittleEndian.AppendUint64(key, uint64(c.Value(row)))
+	case *array.Uint32:
+		return binary.LittleEndian.AppendUint64(key, uint64(c.Value(row)))
+	case *array.Uint64:
+		return binary.LittleEndian.AppendUint64(key, c.Value(row))
+	case *array.Float32:
+		return binary.LittleEndian.AppendUint64(key, math.Float64bits(float64(c.Value(row))))
+	case *array.Float64:
+		return binary.LittleEndian.AppendUint64(key, math.Float64bits(c.Value(row)))
+	case *array.String:
+		value := c.Value(row)
+		key = binary.LittleEndian.AppendUint32(key, uint32(len(value)))
+		return append(key, value...)
+	case *array.Binary:
+		value := c.Value(row)
+		key = binary.LittleEndian.AppendUint32(key, uint32(len(value)))
+		return append(key, value...)
+	case *array.FixedSizeBinary:
+		return append(key, c.Value(row)...)
+	case *array.Decimal128:
+		key = binary.LittleEndian.AppendUint64(key, c.Value(row).LowBits())
+		return binary.LittleEndian.AppendUint64(key, uint64(c.Value(row).HighBits()))
+	case *array.Timestamp:
+		return binary.LittleEndian.AppendUint64(key, uint64(c.Value(row)))
+	case *array.Date32:
+		return binary.LittleEndian.AppendUint64(key, uint64(c.Value(row)))
+	case *array.Time32:
+		return binary.LittleEndian.AppendUint64(key, uint64(c.Value(row)))
+	case *array.Time64:
+		return binary.LittleEndian.AppendUint64(key, uint64(c.Value(row)))
+	case *array.Duration:
+		return binary.LittleEndian.AppendUint64(key, uint64(c.Value(row)))
+	case *array.Dictionary:
+		// the key is made of the value rather than of its index, which differs between the dictionaries of two batches.
+		return appendKey(key[:len(key)-1], c.Dictionary(), c.GetValueIndex(row))
+	case array.ExtensionArray:
+		return appendKey(key[:len(key)-1], c.Storage(), row)
+	}
+
+	value := column.ValueStr(row)
+	key = binary.LittleEndian.AppendUint32(key, uint32(len(value)))
+	return append(key, value...)
+}
+
+// rowKey returns the hash key of the given row over the provided columns and whether any of its values is null.
+func rowKey(key []byte, columns []arrow.Array, row int) ([]byte, bool) {
+	hasNull := false
+	for _, column := range columns {
+		hasNull = hasNull || column.IsNull(row)
+		key = appendKey(key, column, row)
+	}
+
+	return key, hasNull
+}
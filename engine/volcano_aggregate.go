@@ -0,0 +1,701 @@
+package engine
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/apache/arrow/go/v13/arrow/array"
+	"github.com/apache/arrow/go/v13/arrow/compute"
+	"github.com/apache/arrow/go/v13/arrow/compute/exprs"
+	"github.com/apache/arrow/go/v13/arrow/memory"
+	"github.com/substrait-io/substrait-go/expr"
+	"github.com/substrait-io/substrait-go/types"
+	"strings"
+)
+
+// AggregateMeasure is an aggregate function computed for every group, only the rows for which Filter evaluates to
+// true are aggregated when it is set.
+type AggregateMeasure struct {
+	Function *expr.AggregateFunction
+	Filter   expr.Expression
+}
+
+// VolcanoHashAggregate groups the rows of its child by the value of the grouping expressions using a hash table and
+// computes the measures for every group. The output batch holds the grouping columns followed by the measures.
+type VolcanoHashAggregate struct {
+	child     VolcanoOperator
+	ctx       context.Context
+	names     []string
+	groupings []expr.Expression
+	measures  []AggregateMeasure
+	done      bool
+}
+
+func NewVolcanoHashAggregate(ctx context.Context, child *VolcanoOperator, names []string, groupings []expr.Expression, measures []AggregateMeasure) *VolcanoHashAggregate {
+	return &VolcanoHashAggregate{child: *child, ctx: ctx, names: names, groupings: groupings, measures: measures}
+}
+
+func (aggregate *VolcanoHashAggregate) Open() error {
+	return aggregate.child.Open()
+}
+
+func (aggregate *VolcanoHashAggregate) Next() (ColumnarBatch, error) {
+	if aggregate.done {
+		return nil, EOB
+	}
+
+	aggregate.done = true
+
+	state, err := newAggregateState(aggregate.ctx, aggregate.groupings, aggregate.measures)
+	if err != nil {
+		return nil, err
+	}
+
+	defer state.release()
+
+	for {
+		batch, err := aggregate.child.Next()
+		if err == EOB {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = state.update(*batch)
+		(*batch).Release()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if state.groupCount == 0 {
+		return nil, EOB
+	}
+
+	columns, err := state.result()
+	if err != nil {
+		return nil, err
+	}
+
+	defer releaseArrays(columns)
+
+	fields := make([]arrow.Field, len(columns))
+	for i, column := range columns {
+		fields[i] = arrow.Field{Name: aggregate.names[i], Type: column.DataType(), Nullable: true}
+	}
+
+	var record arrow.Record
+	record = array.NewRecord(arrow.NewSchema(fields, nil), columns, int64(state.groupCount))
+
+	return &record, nil
+}
+
+func (aggregate *VolcanoHashAggregate) Close() error {
+	return aggregate.child.Close()
+}
+
+type aggregateState struct {
+	ctx          context.Context
+	groupings    []expr.Expression
+	measures     []AggregateMeasure
+	outputTypes  []arrow.DataType
+	accumulators []accumulator
+	distinct     []map[string]struct{}
+	groups       map[string]int
+	groupCount   int
+	keyChunks    [][]arrow.Array
+}
+
+func newAggregateState(ctx context.Context, groupings []expr.Expression, measures []AggregateMeasure) (*aggregateState, error) {
+	state := aggregateState{
+		ctx:          ctx,
+		groupings:    groupings,
+		measures:     measures,
+		outputTypes:  make([]arrow.DataType, len(measures)),
+		accumulators: make([]accumulator, len(measures)),
+		distinct:     make([]map[string]struct{}, len(measures)),
+		groups:       make(map[string]int),
+		keyChunks:    make([][]arrow.Array, len(groupings)),
+	}
+
+	for i, measure := range measures {
+		outputType, _, err := exprs.FromSubstraitType(measure.Function.GetType(), exprs.GetExtensionIDSet(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		state.outputTypes[i] = outputType
+		if measure.Function.Invocation() == types.AggInvocationDistinct {
+			state.distinct[i] = make(map[string]struct{})
+		}
+	}
+
+	// without any grouping expression a single group always exists, even when the input is empty.
+	if len(groupings) == 0 {
+		state.groupCount = 1
+	}
+
+	return &state, nil
+}
+
+func (state *aggregateState) update(batch arrow.Record) error {
+	rows := int(batch.NumRows())
+
+	keys := make([]arrow.Array, 0, len(state.groupings))
+	defer func() { releaseArrays(keys) }()
+
+	for _, grouping := range state.groupings {
+		key, err := EvaluateExpression(state.ctx, grouping, batch)
+		if err != nil {
+			return err
+		}
+
+		keys = append(keys, key)
+	}
+
+	groups := make([]int, rows)
+	if len(keys) > 0 {
+		var newGroups []int64
+		var buffer []byte
+		for row := 0; row < rows; row++ {
+			buffer, _ = rowKey(buffer[:0], keys, row)
+			group, ok := state.groups[string(buffer)]
+			if !ok {
+				group = state.groupCount
+				state.groups[string(buffer)] = group
+				state.groupCount += 1
+				newGroups = append(newGroups, int64(row))
+			}
+
+			groups[row] = group
+		}
+
+		if len(newGroups) > 0 {
+			indices := newIndices(state.ctx, newGroups, nil)
+			chunks, err := takeColumns(state.ctx, keys, indices)
+			indices.Release()
+			if err != nil {
+				return err
+			}
+
+			for i, chunk := range chunks {
+				state.keyChunks[i] = append(state.keyChunks[i], chunk)
+			}
+		}
+	}
+
+	for i, measure := range state.measures {
+		err := state.updateMeasure(i, measure, batch, groups)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (state *aggregateState) updateMeasure(index int, measure AggregateMeasure, batch arrow.Record, groups []int) error {
+	selected := make([]bool, len(groups))
+	for row := range selected {
+		selected[row] = true
+	}
+
+	if measure.Filter != nil {
+		condition, err := EvaluateExpression(state.ctx, measure.Filter, batch)
+		if err != nil {
+			return err
+		}
+
+		mask := condition.(*array.Boolean)
+		for row := range selected {
+			selected[row] = mask.IsValid(row) && mask.Value(row)
+		}
+
+		condition.Release()
+	}
+
+	var values arrow.Array
+	if measure.Function.NArgs() > 0 {
+		argument, ok := measure.Function.Arg(0).(expr.Expression)
+		if !ok {
+			return fmt.Errorf("argument of aggregate function '%s' is not an expression", measure.Function.ID().Name)
+		}
+
+		var err error
+		values, err = EvaluateExpression(state.ctx, argument, batch)
+		if err != nil {
+			return err
+		}
+
+		defer values.Release()
+	}
+
+	if seen := state.distinct[index]; seen != nil && values != nil {
+		var buffer []byte
+		for row, group := range groups {
+			if !selected[row] || values.IsNull(row) {
+				continue
+			}
+
+			buffer = binary.LittleEndian.AppendUint64(buffer[:0], uint64(group))
+			buffer = appendKey(buffer, values, row)
+			if _, ok := seen[string(buffer)]; ok {
+				selected[row] = false
+				continue
+			}
+
+			seen[string(buffer)] = struct{}{}
+		}
+	}
+
+	if state.accumulators[index] == nil {
+		acc, err := newAccumulator(measure.Function, values)
+		if err != nil {
+			return err
+		}
+
+		state.accumulators[index] = acc
+	}
+
+	return state.accumulators[index].update(state.ctx, values, groups, selected, state.groupCount)
+}
+
+func (state *aggregateState) result() ([]arrow.Array, error) {
+	columns := make([]arrow.Array, 0, len(state.keyChunks)+len(state.measures))
+	for _, chunks := range state.keyChunks {
+		column, err := array.Concatenate(chunks, compute.GetAllocator(state.ctx))
+		if err != nil {
+			releaseArrays(columns)
+			return nil, err
+		}
+
+		columns = append(columns, column)
+	}
+
+	mem := compute.GetAllocator(state.ctx)
+	for i, measure := range state.measures {
+		acc := state.accumulators[i]
+		if acc == nil {
+			// the input was empty, the accumulator is created against a typed null input.
+			var err error
+			acc, err = newAccumulator(measure.Function, nil)
+			if err != nil {
+				releaseArrays(columns)
+				return nil, err
+			}
+		}
+
+		values := acc.result(mem, state.groupCount)
+		if !arrow.TypeEqual(values.DataType(), state.outputTypes[i]) {
+			// results are truncated to the declared output type, such as the average of integers being an integer.
+			options := compute.SafeCastOptions(state.outputTypes[i])
+			options.AllowFloatTruncate = true
+
+			casted, err := compute.CastArray(state.ctx, values, options)
+			values.Release()
+			if err != nil {
+				releaseArrays(columns)
+				return nil, err
+			}
+
+			values = casted
+		}
+
+		columns = append(columns, values)
+	}
+
+	return columns, nil
+}
+
+func (state *aggregateState) release() {
+	for _, chunks := range state.keyChunks {
+		releaseArrays(chunks)
+	}
+}
+
+// accumulator maintains the state of an aggregate function for every group.
+type accumulator interface {
+	// update folds the selected rows of values into the state of the group they belong to.
+	update(ctx context.Context, values arrow.Array, groups []int, selected []bool, groupCount int) error
+	// result builds the column holding the aggregated value of every group.
+	result(mem memory.Allocator, groupCount int) arrow.Array
+}
+
+func newAccumulator(function *expr.AggregateFunction, values arrow.Array) (accumulator, error) {
+	name, _, _ := strings.Cut(function.ID().Name, ":")
+	if name == "count" {
+		return &countAccumulator{}, nil
+	}
+
+	if values == nil {
+		return &nullAccumulator{}, nil
+	}
+
+	kind, ok := valueKindOf(values.DataType())
+	if !ok && (name == "min" || name == "max" || name == "any_value") {
+		return &valueMinMaxAccumulator{name: name, dataType: values.DataType()}, nil
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("aggregate function '%s' does not support values of type: '%s'", function.ID().Name, values.DataType())
+	}
+
+	switch name {
+	case "sum", "sum0":
+		switch kind {
+		case signedKind:
+			return &sumAccumulator[int64]{kind: kind, zero: name == "sum0"}, nil
+		case unsignedKind:
+			return &sumAccumulator[uint64]{kind: kind, zero: name == "sum0"}, nil
+		case floatKind:
+			return &sumAccumulator[float64]{kind: kind, zero: name == "sum0"}, nil
+		}
+	case "avg":
+		if kind != stringKind {
+			return &avgAccumulator{}, nil
+		}
+	case "min", "max", "any_value":
+		switch kind {
+		case signedKind:
+			return &minMaxAccumulator[int64]{kind: kind, name: name}, nil
+		case unsignedKind:
+			return &minMaxAccumulator[uint64]{kind: kind, name: name}, nil
+		case floatKind:
+			return &minMaxAccumulator[float64]{kind: kind, name: name}, nil
+		case stringKind:
+			return &minMaxAccumulator[string]{kind: kind, name: name}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("aggregate function '%s' is not supported for type: '%s'", function.ID().Name, values.DataType())
+}
+
+type valueKind int
+
+const (
+	signedKind valueKind = iota
+	unsignedKind
+	floatKind
+	stringKind
+)
+
+func valueKindOf(dataType arrow.DataType) (valueKind, bool) {
+	switch dataType.ID() {
+	case arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64, arrow.BOOL:
+		return signedKind, true
+	case arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64:
+		return unsignedKind, true
+	case arrow.FLOAT16, arrow.FLOAT32, arrow.FLOAT64:
+		return floatKind, true
+	case arrow.STRING:
+		return stringKind, true
+	}
+
+	return 0, false
+}
+
+var kindTypes = map[valueKind]arrow.DataType{
+	signedKind:   arrow.PrimitiveTypes.Int64,
+	unsignedKind: arrow.PrimitiveTypes.Uint64,
+	floatKind:    arrow.PrimitiveTypes.Float64,
+	stringKind:   arrow.BinaryTypes.String,
+}
+
+// widen casts values to the widest type of its kind so that accumulators can work on a single representation.
+func widen[T int64 | uint64 | float64 | string](ctx context.Context, values arrow.Array, kind valueKind) (arrow.Array, func(int) T, error) {
+	widened := values
+	if !arrow.TypeEqual(values.DataType(), kindTypes[kind]) {
+		var err error
+		widened, err = compute.CastArray(ctx, values, compute.SafeCastOptions(kindTypes[kind]))
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		widened.Retain()
+	}
+
+	var value any
+	switch w := widened.(type) {
+	case *array.Int64:
+		value = w.Value
+	case *array.Uint64:
+		value = w.Value
+	case *array.Float64:
+		value = w.Value
+	case *array.String:
+		value = w.Value
+	}
+
+	return widened, value.(func(int) T), nil
+}
+
+func buildValues[T int64 | uint64 | float64 | string](mem memory.Allocator, kind valueKind, values []T, valid []bool) arrow.Array {
+	builder := array.NewBuilder(mem, kindTypes[kind])
+	defer builder.Release()
+
+	for i, value := range values {
+		if !valid[i] {
+			builder.AppendNull()
+			continue
+		}
+
+		switch b := builder.(type) {
+		case *array.Int64Builder:
+			b.Append(any(value).(int64))
+		case *array.Uint64Builder:
+			b.Append(any(value).(uint64))
+		case *array.Float64Builder:
+			b.Append(any(value).(float64))
+		case *array.StringBuilder:
+			b.Append(any(value).(string))
+		}
+	}
+
+	return builder.NewArray()
+}
+
+func grow[T any](values []T, size int) []T {
+	if len(values) >= size {
+		return values
+	}
+
+	return append(values, make([]T, size-len(values))...)
+}
+
+type countAccumulator struct {
+	counts []int64
+}
+
+func (acc *countAccumulator) update(_ context.Context, values arrow.Array, groups []int, selected []bool, groupCount int) error {
+	acc.counts = grow(acc.counts, groupCount)
+	for row, group := range groups {
+		if selected[row] && (values == nil || values.IsValid(row)) {
+			acc.counts[group] += 1
+		}
+	}
+
+	return nil
+}
+
+func (acc *countAccumulator) result(mem memory.Allocator, groupCount int) arrow.Array {
+	acc.counts = grow(acc.counts, groupCount)
+
+	builder := array.NewInt64Builder(mem)
+	defer builder.Release()
+
+	builder.AppendValues(acc.counts, nil)
+	return builder.NewArray()
+}
+
+type sumAccumulator[T int64 | uint64 | float64] struct {
+	kind  valueKind
+	zero  bool
+	sums  []T
+	valid []bool
+}
+
+func (acc *sumAccumulator[T]) update(ctx context.Context, values arrow.Array, groups []int, selected []bool, groupCount int) error {
+	acc.sums, acc.valid = grow(acc.sums, groupCount), grow(acc.valid, groupCount)
+
+	widened, value, err := widen[T](ctx, values, acc.kind)
+	if err != nil {
+		return err
+	}
+
+	defer widened.Release()
+
+	for row, group := range groups {
+		if selected[row] && widened.IsValid(row) {
+			acc.sums[group] += value(row)
+			acc.valid[group] = true
+		}
+	}
+
+	return nil
+}
+
+func (acc *sumAccumulator[T]) result(mem memory.Allocator, groupCount int) arrow.Array {
+	acc.sums, acc.valid = grow(acc.sums, groupCount), grow(acc.valid, groupCount)
+	if acc.zero {
+		for i := range acc.valid {
+			acc.valid[i] = true
+		}
+	}
+
+	return buildValues(mem, acc.kind, acc.sums, acc.valid)
+}
+
+type avgAccumulator struct {
+	sums   []float64
+	counts []int64
+}
+
+func (acc *avgAccumulator) update(ctx context.Context, values arrow.Array, groups []int, selected []bool, groupCount int) error {
+	acc.sums, acc.counts = grow(acc.sums, groupCount), grow(acc.counts, groupCount)
+
+	widened, value, err := widen[float64](ctx, values, floatKind)
+	if err != nil {
+		return err
+	}
+
+	defer widened.Release()
+
+	for row, group := range groups {
+		if selected[row] && widened.IsValid(row) {
+			acc.sums[group] += value(row)
+			acc.counts[group] += 1
+		}
+	}
+
+	return nil
+}
+
+func (acc *avgAccumulator) result(mem memory.Allocator, groupCount int) arrow.Array {
+	acc.sums, acc.counts = grow(acc.sums, groupCount), grow(acc.counts, groupCount)
+
+	valid := make([]bool, groupCount)
+	averages := make([]float64, groupCount)
+	for i, count := range acc.counts {
+		if count > 0 {
+			valid[i] = true
+			averages[i] = acc.sums[i] / float64(count)
+		}
+	}
+
+	return buildValues(mem, floatKind, averages, valid)
+}
+
+type minMaxAccumulator[T int64 | uint64 | float64 | string] struct {
+	kind   valueKind
+	name   string
+	values []T
+	valid  []bool
+}
+
+func (acc *minMaxAccumulator[T]) update(ctx context.Context, values arrow.Array, groups []int, selected []bool, groupCount int) error {
+	acc.values, acc.valid = grow(acc.values, groupCount), grow(acc.valid, groupCount)
+
+	widened, value, err := widen[T](ctx, values, acc.kind)
+	if err != nil {
+		return err
+	}
+
+	defer widened.Release()
+
+	for row, group := range groups {
+		if !selected[row] || widened.IsNull(row) {
+			continue
+		}
+
+		v := value(row)
+		switch {
+		case !acc.valid[group]:
+		case acc.name == "min" && v < acc.values[group]:
+		case acc.name == "max" && v > acc.values[group]:
+		default:
+			continue
+		}
+
+		if acc.kind == stringKind {
+			// the value references the memory of the batch, it is copied so that the batch can be released.
+			v = any(strings.Clone(any(v).(string))).(T)
+		}
+
+		acc.values[group] = v
+		acc.valid[group] = true
+	}
+
+	return nil
+}
+
+func (acc *minMaxAccumulator[T]) result(mem memory.Allocator, groupCount int) arrow.Array {
+	acc.values, acc.valid = grow(acc.values, groupCount), grow(acc.valid, groupCount)
+	return buildValues(mem, acc.kind, acc.values, acc.valid)
+}
+
+// valueMinMaxAccumulator computes min and max over the types which have no native accumulator, such as decimals,
+// timestamps or enums, by comparing their values with CompareValues. The value of every group is kept in an array
+// which is rebuilt out of the previous values and the values of each batch.
+type valueMinMaxAccumulator struct {
+	name     string
+	dataType arrow.DataType
+	values   arrow.Array
+}
+
+func (acc *valueMinMaxAccumulator) update(ctx context.Context, values arrow.Array, groups []int, selected []bool, groupCount int) error {
+	candidates := values
+	previous := 0
+	if acc.values != nil {
+		concatenated, err := array.Concatenate([]arrow.Array{acc.values, values}, compute.GetAllocator(ctx))
+		if err != nil {
+			return err
+		}
+
+		defer concatenated.Release()
+
+		candidates = concatenated
+		previous = acc.values.Len()
+	}
+
+	best, valid := make([]int64, groupCount), make([]bool, groupCount)
+	for group := 0; group < previous; group++ {
+		best[group], valid[group] = int64(group), acc.values.IsValid(group)
+	}
+
+	for row, group := range groups {
+		if !selected[row] || values.IsNull(row) {
+			continue
+		}
+
+		candidate := previous + row
+		switch {
+		case !valid[group]:
+		case acc.name == "min" && CompareValues(candidates, candidate, candidates, int(best[group])) < 0:
+		case acc.name == "max" && CompareValues(candidates, candidate, candidates, int(best[group])) > 0:
+		default:
+			continue
+		}
+
+		best[group], valid[group] = int64(candidate), true
+	}
+
+	indices := newIndices(ctx, best, valid)
+	defer indices.Release()
+
+	taken, err := takeArray(ctx, candidates, indices)
+	if err != nil {
+		return err
+	}
+
+	if acc.values != nil {
+		acc.values.Release()
+	}
+
+	acc.values = taken
+	return nil
+}
+
+func (acc *valueMinMaxAccumulator) result(mem memory.Allocator, groupCount int) arrow.Array {
+	if acc.values == nil {
+		return array.MakeArrayOfNull(mem, acc.dataType, groupCount)
+	}
+
+	// the values are handed over to the caller which releases them.
+	values := acc.values
+	acc.values = nil
+	return values
+}
+
+// nullAccumulator is used for functions that never received any input, every group is null.
+type nullAccumulator struct{}
+
+func (acc *nullAccumulator) update(_ context.Context, _ arrow.Array, _ []int, _ []bool, _ int) error {
+	return nil
+}
+
+func (acc *nullAccumulator) result(mem memory.Allocator, groupCount int) arrow.Array {
+	return array.MakeArrayOfNull(mem, arrow.Null, groupCount)
+}
@@ -13,8 +13,17 @@ type CloseableIterator interface {
 	Close()
 }
 
+// FallibleIterator is a CloseableIterator which may stop before its end on an error, returned by Err once Next
+// returned false.
+type FallibleIterator interface {
+	CloseableIterator
+	Err() error
+}
+
 var EOB = errors.New("EOB")
 
+// VolcanoOperator is a pull based operator, batches returned by Next are owned by the caller which is responsible
+// for releasing them.
 type VolcanoOperator interface {
 	Open() error
 	Next() (ColumnarBatch, error)
@@ -25,6 +34,12 @@ type VolcanoEngine struct {
 }
 
 func (engine *VolcanoEngine) Process(operator *VolcanoOperator) (*CloseableIterator, error) {
+	err := (*operator).Open()
+	if err != nil {
+		_ = (*operator).Close()
+		return nil, err
+	}
+
 	var iterator CloseableIterator
 	iterator = &volcanoIterator{
 		root: operator,
@@ -33,20 +48,28 @@ func (engine *VolcanoEngine) Process(operator *VolcanoOperator) (*CloseableItera
 	return &iterator, nil
 }
 
+// volcanoIterator is the FallibleIterator over the batches of an operator tree, the error an operator failed on being
+// returned by Err.
 type volcanoIterator struct {
 	root    *VolcanoOperator
 	current ColumnarBatch
+	err     error
 }
 
 func (vi *volcanoIterator) Next() bool {
+	if vi.err != nil {
+		return false
+	}
+
 	batch, err := (*vi.root).Next()
 	for err == nil && (*batch).NumRows() == 0 {
+		(*batch).Release()
 		batch, err = (*vi.root).Next()
 	}
 
 	if err != nil {
-		if err == EOB {
-			return false
+		if err != EOB {
+			vi.err = err
 		}
 
 		return false
@@ -60,6 +83,11 @@ func (vi *volcanoIterator) Value() ColumnarBatch {
 	return vi.current
 }
 
+// Err returns the error which stopped the iterator before the end of its batches.
+func (vi *volcanoIterator) Err() error {
+	return vi.err
+}
+
 func (vi *volcanoIterator) Close() {
 	_ = (*vi.root).Close()
 }
@@ -78,7 +106,14 @@ func (scan *VolcanoScan) Open() error {
 
 func (scan *VolcanoScan) Next() (ColumnarBatch, error) {
 	if scan.source.Next() {
-		return scan.source.Value(), nil
+		batch := scan.source.Value()
+		(*batch).Retain()
+
+		return batch, nil
+	}
+
+	if fallible, ok := scan.source.(FallibleIterator); ok && fallible.Err() != nil {
+		return nil, fallible.Err()
 	}
 
 	return nil, EOB
@@ -91,10 +126,12 @@ func (scan *VolcanoScan) Close() error {
 
 type VolcanoFilter struct {
 	child     VolcanoOperator
-	condition func(ColumnarBatch) ColumnarBatch
+	condition func(ColumnarBatch) (ColumnarBatch, error)
 }
 
-func NewVolcanoFilter(child *VolcanoOperator, condition func(ColumnarBatch) ColumnarBatch) *VolcanoFilter {
+// NewVolcanoFilter creates a filter applying condition to every batch of child, condition must return a new batch
+// as the input batch is released once it has been applied.
+func NewVolcanoFilter(child *VolcanoOperator, condition func(ColumnarBatch) (ColumnarBatch, error)) *VolcanoFilter {
 	return &VolcanoFilter{child: *child, condition: condition}
 }
 
@@ -112,7 +149,9 @@ func (filter *VolcanoFilter) Next() (ColumnarBatch, error) {
 		return nil, err
 	}
 
-	return filter.condition(batch), nil
+	defer (*batch).Release()
+
+	return filter.condition(batch)
 }
 
 func (filter *VolcanoFilter) Close() error {
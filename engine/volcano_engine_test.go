@@ -0,0 +1,216 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/apache/arrow/go/v13/arrow/array"
+	"github.com/apache/arrow/go/v13/arrow/compute"
+	"github.com/apache/arrow/go/v13/arrow/compute/exprs"
+	"github.com/apache/arrow/go/v13/arrow/memory"
+	"github.com/substrait-io/substrait-go/expr"
+	"github.com/substrait-io/substrait-go/extensions"
+	"github.com/substrait-io/substrait-go/plan"
+	"github.com/substrait-io/substrait-go/types"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const (
+	booleanFunctionsURI    = "https://github.com/substrait-io/substrait/blob/main/extensions/functions_boolean.yaml"
+	comparisonFunctionsURI = "https://github.com/substrait-io/substrait/blob/main/extensions/functions_comparison.yaml"
+)
+
+// failingIterator returns its batches and then stops on err.
+type failingIterator struct {
+	batches []arrow.Record
+	current arrow.Record
+	err     error
+}
+
+func (iterator *failingIterator) Next() bool {
+	if len(iterator.batches) == 0 {
+		return false
+	}
+
+	iterator.current, iterator.batches = iterator.batches[0], iterator.batches[1:]
+	return true
+}
+
+func (iterator *failingIterator) Value() ColumnarBatch {
+	return &iterator.current
+}
+
+func (iterator *failingIterator) Close() {}
+
+func (iterator *failingIterator) Err() error {
+	return iterator.err
+}
+
+func TestVolcanoIteratorErr(t *testing.T) {
+	batch := newInt64Record(t, []string{"id"}, [][]any{{1, 2}})
+	defer batch.Release()
+
+	var source CloseableIterator
+	source = &failingIterator{batches: []arrow.Record{batch}, err: errors.New("cold file can't be read")}
+
+	var scan VolcanoOperator
+	scan = NewVolcanoScan(&source)
+
+	volcanoEngine := VolcanoEngine{}
+	iterator, err := volcanoEngine.Process(&scan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer (*iterator).Close()
+
+	rows := int64(0)
+	for (*iterator).Next() {
+		rows += (*(*iterator).Value()).NumRows()
+		(*(*iterator).Value()).Release()
+	}
+
+	if rows != 2 {
+		t.Errorf("expected the 2 rows read before the error, got: %d", rows)
+	}
+
+	fallible, ok := (*iterator).(FallibleIterator)
+	if !ok || fallible.Err() == nil || fallible.Err().Error() != "cold file can't be read" {
+		t.Errorf("expected the error of the source to be returned, got: %v", fallible)
+	}
+}
+
+// newInt64Record returns a record of the long columns named names, holding the int values of columns and a null for
+// each nil one.
+func newInt64Record(t *testing.T, names []string, columns [][]any) arrow.Record {
+	t.Helper()
+
+	fields := make([]arrow.Field, len(names))
+	arrays := make([]arrow.Array, len(names))
+	defer func() { releaseArrays(arrays) }()
+
+	for index, name := range names {
+		fields[index] = arrow.Field{Name: name, Type: arrow.PrimitiveTypes.Int64, Nullable: true}
+		builder := array.NewInt64Builder(memory.DefaultAllocator)
+		for _, value := range columns[index] {
+			if value == nil {
+				builder.AppendNull()
+			} else {
+				builder.Append(int64(value.(int)))
+			}
+		}
+
+		arrays[index] = builder.NewArray()
+		builder.Release()
+	}
+
+	return array.NewRecord(arrow.NewSchema(fields, nil), arrays, int64(arrays[0].Len()))
+}
+
+// newValues returns an operator emitting a batch of the long columns named names for each of batches, see
+// newInt64Record.
+func newValues(t *testing.T, names []string, batches ...[][]any) *VolcanoOperator {
+	t.Helper()
+
+	records := make([]arrow.Record, len(batches))
+	for index, columns := range batches {
+		records[index] = newInt64Record(t, names, columns)
+	}
+
+	var operator VolcanoOperator
+	operator = NewVolcanoValues(records)
+
+	return &operator
+}
+
+// readRows opens operator and returns its rows, the values of each joined by commas, in the order they were returned.
+func readRows(t *testing.T, operator *VolcanoOperator) []string {
+	t.Helper()
+
+	if err := (*operator).Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer (*operator).Close()
+
+	batches, err := drain(*operator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer releaseRecords(batches)
+
+	var rows []string
+	for _, batch := range batches {
+		for row := 0; row < int(batch.NumRows()); row++ {
+			values := make([]string, batch.NumCols())
+			for index, column := range batch.Columns() {
+				values[index] = "null"
+				if column.IsValid(row) {
+					values[index] = column.ValueStr(row)
+				}
+			}
+
+			rows = append(rows, strings.Join(values, ","))
+		}
+	}
+
+	return rows
+}
+
+// sortedRows returns the rows of operator sorted, for the operators which don't define the order of their rows.
+func sortedRows(t *testing.T, operator *VolcanoOperator) []string {
+	t.Helper()
+
+	rows := readRows(t, operator)
+	sort.Strings(rows)
+
+	return rows
+}
+
+// testContext returns the context the test expressions are evaluated with.
+func testContext() context.Context {
+	extensionSet := exprs.NewExtensionSet(expr.NewEmptyExtensionRegistry(&extensions.DefaultCollection), exprs.DefaultExtensionIDRegistry)
+	return exprs.WithExtensionIDSet(compute.WithAllocator(context.Background(), memory.DefaultAllocator), extensionSet)
+}
+
+// column returns a reference to the column at index of a row of width nullable long columns.
+func column(t *testing.T, index int32, width int) *expr.FieldReference {
+	t.Helper()
+
+	columnTypes := make([]types.Type, width)
+	for i := range columnTypes {
+		columnTypes[i] = &types.Int64Type{Nullability: types.NullabilityNullable}
+	}
+
+	reference, err := expr.NewRootFieldRef(expr.NewStructFieldRef(index), &types.StructType{Nullability: types.NullabilityRequired, Types: columnTypes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return reference
+}
+
+// comparison returns the substrait comparison function name applied to args.
+func comparison(t *testing.T, name string, args ...types.FuncArg) expr.Expression {
+	t.Helper()
+
+	function, err := plan.NewBuilderDefault().ScalarFn(comparisonFunctionsURI, name, nil, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return function
+}
+
+// int64Schema returns the schema of the nullable long columns named names.
+func int64Schema(names ...string) *arrow.Schema {
+	fields := make([]arrow.Field, len(names))
+	for index, name := range names {
+		fields[index] = arrow.Field{Name: name, Type: arrow.PrimitiveTypes.Int64, Nullable: true}
+	}
+
+	return arrow.NewSchema(fields, nil)
+}
@@ -0,0 +1,396 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/apache/arrow/go/v13/arrow/array"
+	"github.com/substrait-io/substrait-go/expr"
+	"github.com/substrait-io/substrait-go/plan"
+	"strings"
+)
+
+// VolcanoJoin joins every batch of its left child with the materialized right child. The condition is evaluated
+// against the concatenation of the left and right columns, its equality conjuncts between a left and a right column
+// are used to build a hash table over the right rows, otherwise every pair of rows is tested.
+type VolcanoJoin struct {
+	left        VolcanoOperator
+	right       VolcanoOperator
+	ctx         context.Context
+	joinType    plan.JoinType
+	condition   expr.Expression
+	leftSchema  *arrow.Schema
+	rightSchema *arrow.Schema
+	leftKeys    []expr.Expression
+	rightKeys   []expr.Expression
+	build       arrow.Record
+	table       map[string][]int64
+	matched     []bool
+	done        bool
+}
+
+func NewVolcanoJoin(ctx context.Context, left *VolcanoOperator, right *VolcanoOperator, joinType plan.JoinType, condition expr.Expression, leftSchema *arrow.Schema, rightSchema *arrow.Schema) (*VolcanoJoin, error) {
+	switch joinType {
+	case plan.JoinTypeInner, plan.JoinTypeLeft, plan.JoinTypeRight, plan.JoinTypeOuter, plan.JoinTypeSemi, plan.JoinTypeAnti, plan.JoinTypeSingle:
+	default:
+		return nil, fmt.Errorf("join type: '%s' is not supported", joinType)
+	}
+
+	join := VolcanoJoin{
+		left:        *left,
+		right:       *right,
+		ctx:         ctx,
+		joinType:    joinType,
+		condition:   condition,
+		leftSchema:  leftSchema,
+		rightSchema: rightSchema,
+	}
+
+	join.leftKeys, join.rightKeys = equiJoinKeys(condition, int32(len(leftSchema.Fields())))
+
+	return &join, nil
+}
+
+func (join *VolcanoJoin) Open() error {
+	err := join.left.Open()
+	if err != nil {
+		return err
+	}
+
+	return join.right.Open()
+}
+
+func (join *VolcanoJoin) Next() (ColumnarBatch, error) {
+	if join.build == nil {
+		err := join.buildTable()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for !join.done {
+		batch, err := join.left.Next()
+		if err == EOB {
+			join.done = true
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		record, err := join.probe(*batch)
+		(*batch).Release()
+		if err != nil {
+			return nil, err
+		}
+
+		return &record, nil
+	}
+
+	if join.matched != nil && (join.joinType == plan.JoinTypeRight || join.joinType == plan.JoinTypeOuter) {
+		var rightIndices []int64
+		for row, matched := range join.matched {
+			if !matched {
+				rightIndices = append(rightIndices, int64(row))
+			}
+		}
+
+		join.matched = nil
+
+		empty := newEmptyRecord(join.ctx, join.leftSchema)
+		defer empty.Release()
+
+		record, err := join.assemble(empty, make([]int64, len(rightIndices)), make([]bool, len(rightIndices)), rightIndices, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		return &record, nil
+	}
+
+	return nil, EOB
+}
+
+func (join *VolcanoJoin) Close() error {
+	if join.build != nil {
+		join.build.Release()
+		join.build = nil
+	}
+
+	err := join.left.Close()
+	if err != nil {
+		return err
+	}
+
+	return join.right.Close()
+}
+
+func (join *VolcanoJoin) buildTable() error {
+	batches, err := drain(join.right)
+	if err != nil {
+		return err
+	}
+
+	defer releaseRecords(batches)
+
+	if len(batches) == 0 {
+		join.build = newEmptyRecord(join.ctx, join.rightSchema)
+	} else {
+		join.build, err = Concatenate(join.ctx, batches)
+		if err != nil {
+			return err
+		}
+	}
+
+	join.matched = make([]bool, join.build.NumRows())
+	if len(join.rightKeys) == 0 {
+		return nil
+	}
+
+	keys, err := evaluateAll(join.ctx, join.rightKeys, join.build)
+	if err != nil {
+		return err
+	}
+
+	defer releaseArrays(keys)
+
+	join.table = make(map[string][]int64)
+
+	var buffer []byte
+	for row := 0; row < int(join.build.NumRows()); row++ {
+		var hasNull bool
+		buffer, hasNull = rowKey(buffer[:0], keys, row)
+		if !hasNull {
+			join.table[string(buffer)] = append(join.table[string(buffer)], int64(row))
+		}
+	}
+
+	return nil
+}
+
+// probe joins a batch of the left child with the build side.
+func (join *VolcanoJoin) probe(batch arrow.Record) (arrow.Record, error) {
+	var leftCandidates, rightCandidates []int64
+	if join.table != nil {
+		keys, err := evaluateAll(join.ctx, join.leftKeys, batch)
+		if err != nil {
+			return nil, err
+		}
+
+		var buffer []byte
+		for row := 0; row < int(batch.NumRows()); row++ {
+			var hasNull bool
+			buffer, hasNull = rowKey(buffer[:0], keys, row)
+			if hasNull {
+				continue
+			}
+
+			for _, match := range join.table[string(buffer)] {
+				leftCandidates = append(leftCandidates, int64(row))
+				rightCandidates = append(rightCandidates, match)
+			}
+		}
+
+		releaseArrays(keys)
+	} else {
+		for row := int64(0); row < batch.NumRows(); row++ {
+			for match := int64(0); match < join.build.NumRows(); match++ {
+				leftCandidates = append(leftCandidates, row)
+				rightCandidates = append(rightCandidates, match)
+			}
+		}
+	}
+
+	matches, err := join.evaluateCondition(batch, leftCandidates, rightCandidates)
+	if err != nil {
+		return nil, err
+	}
+
+	leftMatched := make([]bool, batch.NumRows())
+	var leftIndices, rightIndices []int64
+	var rightValid []bool
+	for i, matched := range matches {
+		if !matched {
+			continue
+		}
+
+		left, right := leftCandidates[i], rightCandidates[i]
+		if join.joinType == plan.JoinTypeSingle && leftMatched[left] {
+			return nil, fmt.Errorf("single join matched more than one row for the left row: %d", left)
+		}
+
+		leftMatched[left] = true
+		join.matched[right] = true
+		leftIndices = append(leftIndices, left)
+		rightIndices = append(rightIndices, right)
+		rightValid = append(rightValid, true)
+	}
+
+	switch join.joinType {
+	case plan.JoinTypeSemi, plan.JoinTypeAnti:
+		var indices []int64
+		for row, matched := range leftMatched {
+			if matched == (join.joinType == plan.JoinTypeSemi) {
+				indices = append(indices, int64(row))
+			}
+		}
+
+		selection := newIndices(join.ctx, indices, nil)
+		defer selection.Release()
+
+		return take(join.ctx, batch, selection)
+	case plan.JoinTypeLeft, plan.JoinTypeOuter, plan.JoinTypeSingle:
+		for row, matched := range leftMatched {
+			if !matched {
+				leftIndices = append(leftIndices, int64(row))
+				rightIndices = append(rightIndices, 0)
+				rightValid = append(rightValid, false)
+			}
+		}
+	}
+
+	return join.assemble(batch, leftIndices, nil, rightIndices, rightValid)
+}
+
+func (join *VolcanoJoin) evaluateCondition(batch arrow.Record, leftCandidates []int64, rightCandidates []int64) ([]bool, error) {
+	matches := make([]bool, len(leftCandidates))
+	if len(matches) == 0 {
+		return matches, nil
+	}
+
+	candidates, err := join.assemble(batch, leftCandidates, nil, rightCandidates, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer candidates.Release()
+
+	condition, err := EvaluateExpression(join.ctx, join.condition, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	defer condition.Release()
+
+	mask := condition.(*array.Boolean)
+	for i := range matches {
+		matches[i] = mask.IsValid(i) && mask.Value(i)
+	}
+
+	return matches, nil
+}
+
+// assemble builds the joined record out of the selected left and right rows, invalid indices produce null values.
+func (join *VolcanoJoin) assemble(batch arrow.Record, leftIndices []int64, leftValid []bool, rightIndices []int64, rightValid []bool) (arrow.Record, error) {
+	leftSelection := newIndices(join.ctx, leftIndices, leftValid)
+	defer leftSelection.Release()
+
+	leftColumns, err := takeColumns(join.ctx, batch.Columns(), leftSelection)
+	if err != nil {
+		return nil, err
+	}
+
+	defer releaseArrays(leftColumns)
+
+	rightSelection := newIndices(join.ctx, rightIndices, rightValid)
+	defer rightSelection.Release()
+
+	rightColumns, err := takeColumns(join.ctx, join.build.Columns(), rightSelection)
+	if err != nil {
+		return nil, err
+	}
+
+	defer releaseArrays(rightColumns)
+
+	fields := append(append([]arrow.Field{}, batch.Schema().Fields()...), join.build.Schema().Fields()...)
+	columns := append(append([]arrow.Array{}, leftColumns...), rightColumns...)
+
+	return array.NewRecord(arrow.NewSchema(fields, nil), columns, int64(len(leftIndices))), nil
+}
+
+// equiJoinKeys extracts the equality conjuncts of the condition comparing a left column with a right column.
+func equiJoinKeys(condition expr.Expression, leftWidth int32) ([]expr.Expression, []expr.Expression) {
+	var leftKeys, rightKeys []expr.Expression
+	for _, conjunct := range conjuncts(condition) {
+		function, ok := conjunct.(*expr.ScalarFunction)
+		if !ok || function.NArgs() != 2 {
+			continue
+		}
+
+		if name, _, _ := strings.Cut(function.ID().Name, ":"); name != "equal" {
+			continue
+		}
+
+		first, firstOk := rootField(function.Arg(0))
+		second, secondOk := rootField(function.Arg(1))
+		if !firstOk || !secondOk {
+			continue
+		}
+
+		if first >= leftWidth && second < leftWidth {
+			first, second = second, first
+		}
+
+		if first < leftWidth && second >= leftWidth {
+			leftKeys = append(leftKeys, fieldReference(first))
+			rightKeys = append(rightKeys, fieldReference(second-leftWidth))
+		}
+	}
+
+	return leftKeys, rightKeys
+}
+
+// conjuncts flattens the nested and functions of the condition.
+func conjuncts(condition expr.Expression) []expr.Expression {
+	function, ok := condition.(*expr.ScalarFunction)
+	if !ok {
+		return []expr.Expression{condition}
+	}
+
+	if name, _, _ := strings.Cut(function.ID().Name, ":"); name != "and" {
+		return []expr.Expression{condition}
+	}
+
+	var result []expr.Expression
+	for i := 0; i < function.NArgs(); i++ {
+		if argument, ok := function.Arg(i).(expr.Expression); ok {
+			result = append(result, conjuncts(argument)...)
+		}
+	}
+
+	return result
+}
+
+func rootField(argument any) (int32, bool) {
+	reference, ok := argument.(*expr.FieldReference)
+	if !ok || reference.Root != expr.RootReference {
+		return 0, false
+	}
+
+	field, ok := reference.Reference.(*expr.StructFieldRef)
+	if !ok || field.Child != nil {
+		return 0, false
+	}
+
+	return field.Field, true
+}
+
+func fieldReference(index int32) expr.Expression {
+	return &expr.FieldReference{Root: expr.RootReference, Reference: &expr.StructFieldRef{Field: index}}
+}
+
+func evaluateAll(ctx context.Context, expressions []expr.Expression, batch arrow.Record) ([]arrow.Array, error) {
+	columns := make([]arrow.Array, 0, len(expressions))
+	for _, expression := range expressions {
+		column, err := EvaluateExpression(ctx, expression, batch)
+		if err != nil {
+			releaseArrays(columns)
+			return nil, err
+		}
+
+		columns = append(columns, column)
+	}
+
+	return columns, nil
+}
@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/substrait-io/substrait-go/expr"
+	"github.com/substrait-io/substrait-go/extensions"
+	"github.com/substrait-io/substrait-go/plan"
+	"github.com/substrait-io/substrait-go/types"
+	"testing"
+)
+
+func TestVolcanoJoinTypes(t *testing.T) {
+	// the null keys of either side never match, the left rows are spread over two batches.
+	left := [][][]any{{{1, 2}, {10, 20}}, {{nil, 3}, {30, 40}}}
+	right := [][]any{{1, 1, nil, 4}, {100, 101, 102, 103}}
+
+	tests := []struct {
+		joinType plan.JoinType
+		expected string
+	}{
+		{plan.JoinTypeInner, "[1,10,1,100 1,10,1,101]"},
+		{plan.JoinTypeLeft, "[1,10,1,100 1,10,1,101 2,20,null,null 3,40,null,null null,30,null,null]"},
+		{plan.JoinTypeRight, "[1,10,1,100 1,10,1,101 null,null,4,103 null,null,null,102]"},
+		{plan.JoinTypeOuter, "[1,10,1,100 1,10,1,101 2,20,null,null 3,40,null,null null,30,null,null null,null,4,103 null,null,null,102]"},
+		{plan.JoinTypeSemi, "[1,10]"},
+		{plan.JoinTypeAnti, "[2,20 3,40 null,30]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.joinType.String(), func(t *testing.T) {
+			condition := comparison(t, "equal", column(t, 0, 4), column(t, 2, 4))
+			join, err := NewVolcanoJoin(testContext(), newValues(t, []string{"id", "value"}, left...), newValues(t, []string{"id", "value"}, right), test.joinType, condition, int64Schema("id", "value"), int64Schema("id", "value"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var operator VolcanoOperator
+			operator = join
+
+			if rows := sortedRows(t, &operator); fmt.Sprint(rows) != test.expected {
+				t.Errorf("expected rows: %s, got: %v", test.expected, rows)
+			}
+		})
+	}
+}
+
+func TestVolcanoJoinConditions(t *testing.T) {
+	left := [][]any{{1, 2, 3}, {1, 2, 3}}
+	right := [][]any{{1, 2, 3}, {2, 2, 2}}
+
+	// the equality between the keys is hashed, the other conjunct is evaluated against the matching pairs.
+	keyed := comparison(t, "equal", column(t, 0, 4), column(t, 2, 4))
+	variant, ok := extensions.DefaultCollection.GetScalarFunc(extensions.ID{URI: booleanFunctionsURI, Name: "and:bool"})
+	if !ok {
+		t.Fatal("function: 'and:bool' is not declared")
+	}
+
+	registry := expr.NewEmptyExtensionRegistry(&extensions.DefaultCollection)
+	and, err := expr.NewCustomScalarFunc(registry, variant, &types.BooleanType{Nullability: types.NullabilityNullable}, nil, keyed, comparison(t, "lt", column(t, 1, 4), column(t, 3, 4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		condition expr.Expression
+		expected  string
+	}{
+		{"hashed", and, "[1,1,1,2]"},
+		// without equality between the keys every pair of rows is tested.
+		{"nestedLoop", comparison(t, "lt", column(t, 0, 4), column(t, 2, 4)), "[1,1,2,2 1,1,3,2 2,2,3,2]"},
+		{"cross", expr.NewPrimitiveLiteral(true, false), "[1,1,1,2 1,1,2,2 1,1,3,2 2,2,1,2 2,2,2,2 2,2,3,2 3,3,1,2 3,3,2,2 3,3,3,2]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			join, err := NewVolcanoJoin(testContext(), newValues(t, []string{"a", "b"}, left), newValues(t, []string{"c", "d"}, right), plan.JoinTypeInner, test.condition, int64Schema("a", "b"), int64Schema("c", "d"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var operator VolcanoOperator
+			operator = join
+
+			if rows := sortedRows(t, &operator); fmt.Sprint(rows) != test.expected {
+				t.Errorf("expected rows: %s, got: %v", test.expected, rows)
+			}
+		})
+	}
+}
+
+func TestVolcanoJoinEmptyAndSingle(t *testing.T) {
+	condition := comparison(t, "equal", column(t, 0, 2), column(t, 1, 2))
+
+	// the right side being empty, the left rows of an outer join are returned alone.
+	join, err := NewVolcanoJoin(testContext(), newValues(t, []string{"a"}, [][]any{{1, 2}}), newValues(t, []string{"b"}), plan.JoinTypeOuter, condition, int64Schema("a"), int64Schema("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var operator VolcanoOperator
+	operator = join
+	if rows := sortedRows(t, &operator); fmt.Sprint(rows) != "[1,null 2,null]" {
+		t.Errorf("expected rows: [1,null 2,null], got: %v", rows)
+	}
+
+	// a single join fails when a left row matches more than one right row.
+	join, err = NewVolcanoJoin(testContext(), newValues(t, []string{"a"}, [][]any{{1}}), newValues(t, []string{"b"}, [][]any{{1, 1}}), plan.JoinTypeSingle, condition, int64Schema("a"), int64Schema("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := join.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer join.Close()
+	if _, err := join.Next(); err == nil {
+		t.Errorf("expected a single join matching two rows to fail")
+	}
+}
@@ -0,0 +1,71 @@
+package engine
+
+// VolcanoLimit skips the first offset rows of its child and then returns at most count rows, a negative count
+// means that every remaining row is returned. The child is closed as soon as count rows have been returned so that
+// upstream operators, down to the store scan, stop producing batches that would be discarded.
+type VolcanoLimit struct {
+	child  VolcanoOperator
+	offset int64
+	count  int64
+	closed bool
+}
+
+func NewVolcanoLimit(child *VolcanoOperator, offset int64, count int64) *VolcanoLimit {
+	return &VolcanoLimit{child: *child, offset: offset, count: count}
+}
+
+func (limit *VolcanoLimit) Open() error {
+	return limit.child.Open()
+}
+
+func (limit *VolcanoLimit) Next() (ColumnarBatch, error) {
+	for limit.count != 0 {
+		batch, err := limit.child.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		rows := (*batch).NumRows()
+		if limit.offset >= rows {
+			limit.offset -= rows
+			(*batch).Release()
+			continue
+		}
+
+		end := rows
+		if limit.count >= 0 && limit.offset+limit.count < rows {
+			end = limit.offset + limit.count
+		}
+
+		record := (*batch).NewSlice(limit.offset, end)
+		(*batch).Release()
+
+		if limit.count > 0 {
+			limit.count -= end - limit.offset
+		}
+
+		limit.offset = 0
+
+		return &record, nil
+	}
+
+	err := limit.closeChild()
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, EOB
+}
+
+func (limit *VolcanoLimit) Close() error {
+	return limit.closeChild()
+}
+
+func (limit *VolcanoLimit) closeChild() error {
+	if limit.closed {
+		return nil
+	}
+
+	limit.closed = true
+	return limit.child.Close()
+}
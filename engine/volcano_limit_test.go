@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+)
+
+// trackedOperator counts the batches pulled out of its child and whether it was closed.
+type trackedOperator struct {
+	VolcanoOperator
+	pulled int
+	closed bool
+}
+
+func (operator *trackedOperator) Next() (ColumnarBatch, error) {
+	operator.pulled += 1
+	return operator.VolcanoOperator.Next()
+}
+
+func (operator *trackedOperator) Close() error {
+	operator.closed = true
+	return operator.VolcanoOperator.Close()
+}
+
+func TestVolcanoLimit(t *testing.T) {
+	batches := [][][]any{{{1, 2, 3}}, {{4, 5}}, {{6, 7, 8}}}
+	tests := []struct {
+		offset   int64
+		count    int64
+		expected string
+		pulled   int
+	}{
+		{0, -1, "[1 2 3 4 5 6 7 8]", 4},
+		{0, 0, "[]", 0},
+		{2, 2, "[3 4]", 2},
+		{3, 2, "[4 5]", 2},
+		{4, -1, "[5 6 7 8]", 4},
+		{7, 5, "[8]", 4},
+		{9, 1, "[]", 4},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%d-%d", test.offset, test.count), func(t *testing.T) {
+			child := &trackedOperator{VolcanoOperator: *newValues(t, []string{"id"}, batches...)}
+
+			var source VolcanoOperator
+			source = child
+
+			var operator VolcanoOperator
+			operator = NewVolcanoLimit(&source, test.offset, test.count)
+
+			rows := readRows(t, &operator)
+			if fmt.Sprint(rows) != test.expected {
+				t.Errorf("expected rows: %s, got: %v", test.expected, rows)
+			}
+
+			// the child stops being pulled once the rows are returned.
+			if child.pulled != test.pulled || !child.closed {
+				t.Errorf("expected %d batches to be pulled and the child to be closed, got: %d %v", test.pulled, child.pulled, child.closed)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"context"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/apache/arrow/go/v13/arrow/array"
+	"github.com/substrait-io/substrait-go/expr"
+	"github.com/substrait-io/substrait-go/types"
+)
+
+// VolcanoProject evaluates a list of substrait expressions against every batch of its child, each expression
+// producing one column of the output batch named after the matching entry of names.
+type VolcanoProject struct {
+	child       VolcanoOperator
+	ctx         context.Context
+	names       []string
+	expressions []expr.Expression
+}
+
+func NewVolcanoProject(ctx context.Context, child *VolcanoOperator, names []string, expressions []expr.Expression) *VolcanoProject {
+	return &VolcanoProject{child: *child, ctx: ctx, names: names, expressions: expressions}
+}
+
+func (project *VolcanoProject) Open() error {
+	return project.child.Open()
+}
+
+func (project *VolcanoProject) Next() (ColumnarBatch, error) {
+	batch, err := project.child.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	defer (*batch).Release()
+
+	fields := make([]arrow.Field, len(project.expressions))
+	columns := make([]arrow.Array, 0, len(project.expressions))
+	defer func() { releaseArrays(columns) }()
+
+	for i, expression := range project.expressions {
+		column, err := EvaluateExpression(project.ctx, expression, *batch)
+		if err != nil {
+			return nil, err
+		}
+
+		columns = append(columns, column)
+		fields[i] = arrow.Field{
+			Name:     project.names[i],
+			Type:     column.DataType(),
+			Nullable: isNullable(expression),
+		}
+	}
+
+	var record arrow.Record
+	record = array.NewRecord(arrow.NewSchema(fields, nil), columns, (*batch).NumRows())
+
+	return &record, nil
+}
+
+func (project *VolcanoProject) Close() error {
+	return project.child.Close()
+}
+
+// isNullable reports whether the expression may produce nulls, expressions of unknown type are considered nullable.
+func isNullable(expression expr.Expression) bool {
+	dataType := expression.GetType()
+	return dataType == nil || dataType.GetNullability() != types.NullabilityRequired
+}
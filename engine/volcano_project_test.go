@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/substrait-io/substrait-go/expr"
+	"github.com/substrait-io/substrait-go/plan"
+	"testing"
+)
+
+func TestVolcanoProject(t *testing.T) {
+	sum, err := plan.NewBuilderDefault().ScalarFn("https://github.com/substrait-io/substrait/blob/main/extensions/functions_arithmetic.yaml", "add", nil, column(t, 0, 2), column(t, 1, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{"b", "a", "total", "constant"}
+	expressions := []expr.Expression{column(t, 1, 2), column(t, 0, 2), sum, expr.NewPrimitiveLiteral(int64(7), false)}
+
+	var operator VolcanoOperator
+	operator = NewVolcanoProject(testContext(), newValues(t, []string{"a", "b"}, [][]any{{1, 2}, {10, nil}}, [][]any{{3}, {30}}), names, expressions)
+
+	// the expressions are evaluated against each batch, a null operand making a null result.
+	if rows := readRows(t, &operator); fmt.Sprint(rows) != "[10,1,11,7 null,2,null,7 30,3,33,7]" {
+		t.Errorf("expected rows: [10,1,11,7 null,2,null,7 30,3,33,7], got: %v", rows)
+	}
+
+	var single VolcanoOperator
+	single = NewVolcanoProject(testContext(), newValues(t, []string{"a", "b"}, [][]any{{1}, {2}}), names, expressions)
+	if err := single.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer single.Close()
+
+	batch, err := single.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer (*batch).Release()
+
+	// the columns are named after names, the literal being the only one which can't be null.
+	expected := arrow.NewSchema([]arrow.Field{
+		{Name: "b", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+		{Name: "a", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+		{Name: "total", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+		{Name: "constant", Type: arrow.PrimitiveTypes.Int64},
+	}, nil)
+
+	if !(*batch).Schema().Equal(expected) {
+		t.Errorf("expected schema: %s, got: %s", expected, (*batch).Schema())
+	}
+}
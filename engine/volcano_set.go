@@ -0,0 +1,210 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/apache/arrow/go/v13/arrow/array"
+	"github.com/substrait-io/substrait-go/plan"
+)
+
+// VolcanoSet implements the substrait set operations. The first input is the primary one: union operations stream
+// every input in order while minus and intersection operations materialize the secondary inputs and then stream the
+// rows of the primary input. Output batches use the names of the set relation.
+type VolcanoSet struct {
+	inputs  []VolcanoOperator
+	ctx     context.Context
+	op      plan.SetOp
+	names   []string
+	current int
+	seen    map[string]struct{}
+	counts  map[string][]int64
+}
+
+func NewVolcanoSet(ctx context.Context, inputs []*VolcanoOperator, op plan.SetOp, names []string) (*VolcanoSet, error) {
+	switch op {
+	case plan.SetOpUnionAll, plan.SetOpUnionDistinct, plan.SetOpMinusPrimary, plan.SetOpMinusMultiset, plan.SetOpIntersectionPrimary, plan.SetOpIntersectionMultiset:
+	default:
+		return nil, fmt.Errorf("set operation: '%s' is not supported", op)
+	}
+
+	operators := make([]VolcanoOperator, len(inputs))
+	for i, input := range inputs {
+		operators[i] = *input
+	}
+
+	return &VolcanoSet{inputs: operators, ctx: ctx, op: op, names: names, seen: make(map[string]struct{})}, nil
+}
+
+func (set *VolcanoSet) Open() error {
+	for _, input := range set.inputs {
+		err := input.Open()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (set *VolcanoSet) Next() (ColumnarBatch, error) {
+	if set.op != plan.SetOpUnionAll && set.op != plan.SetOpUnionDistinct && set.counts == nil {
+		err := set.countSecondaryInputs()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for set.current < len(set.inputs) {
+		batch, err := set.inputs[set.current].Next()
+		if err == EOB {
+			if set.op != plan.SetOpUnionAll && set.op != plan.SetOpUnionDistinct {
+				return nil, EOB
+			}
+
+			set.current += 1
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		record, err := set.selectRows(*batch)
+		(*batch).Release()
+		if err != nil {
+			return nil, err
+		}
+
+		return &record, nil
+	}
+
+	return nil, EOB
+}
+
+func (set *VolcanoSet) Close() error {
+	for _, input := range set.inputs {
+		err := input.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// countSecondaryInputs counts the occurrences of every row of the secondary inputs.
+func (set *VolcanoSet) countSecondaryInputs() error {
+	set.counts = make(map[string][]int64)
+
+	secondaries := len(set.inputs) - 1
+	for i, input := range set.inputs[1:] {
+		batches, err := drain(input)
+		if err != nil {
+			return err
+		}
+
+		var buffer []byte
+		for _, batch := range batches {
+			for row := 0; row < int(batch.NumRows()); row++ {
+				buffer, _ = rowKey(buffer[:0], batch.Columns(), row)
+				counts, ok := set.counts[string(buffer)]
+				if !ok {
+					counts = make([]int64, secondaries)
+					set.counts[string(buffer)] = counts
+				}
+
+				counts[i] += 1
+			}
+		}
+
+		releaseRecords(batches)
+	}
+
+	return nil
+}
+
+// selectRows keeps the rows of batch that belong to the result of the set operation.
+func (set *VolcanoSet) selectRows(batch arrow.Record) (arrow.Record, error) {
+	var indices []int64
+	var buffer []byte
+	for row := 0; row < int(batch.NumRows()); row++ {
+		if set.op == plan.SetOpUnionAll {
+			indices = append(indices, int64(row))
+			continue
+		}
+
+		buffer, _ = rowKey(buffer[:0], batch.Columns(), row)
+		if set.accept(string(buffer)) {
+			indices = append(indices, int64(row))
+		}
+	}
+
+	selection := newIndices(set.ctx, indices, nil)
+	defer selection.Release()
+
+	selected, err := take(set.ctx, batch, selection)
+	if err != nil {
+		return nil, err
+	}
+
+	defer selected.Release()
+
+	fields := make([]arrow.Field, len(selected.Schema().Fields()))
+	for i, field := range selected.Schema().Fields() {
+		fields[i] = arrow.Field{Name: set.names[i], Type: field.Type, Nullable: field.Nullable}
+	}
+
+	return array.NewRecord(arrow.NewSchema(fields, nil), selected.Columns(), selected.NumRows()), nil
+}
+
+func (set *VolcanoSet) accept(key string) bool {
+	counts := set.counts[key]
+	switch set.op {
+	case plan.SetOpUnionDistinct, plan.SetOpMinusPrimary, plan.SetOpIntersectionPrimary:
+		if _, ok := set.seen[key]; ok {
+			return false
+		}
+
+		present := false
+		for _, count := range counts {
+			present = present || count > 0
+		}
+
+		if set.op == plan.SetOpMinusPrimary && present || set.op == plan.SetOpIntersectionPrimary && !present {
+			return false
+		}
+
+		set.seen[key] = struct{}{}
+		return true
+	case plan.SetOpMinusMultiset:
+		// every occurrence in a secondary input cancels one occurrence of the primary input.
+		for i, count := range counts {
+			if count > 0 {
+				counts[i] -= 1
+				return false
+			}
+		}
+
+		return true
+	case plan.SetOpIntersectionMultiset:
+		// a row is kept as many times as it occurs in every secondary input.
+		if len(counts) == 0 {
+			return false
+		}
+
+		for _, count := range counts {
+			if count == 0 {
+				return false
+			}
+		}
+
+		for i := range counts {
+			counts[i] -= 1
+		}
+
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,69 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/substrait-io/substrait-go/plan"
+	"testing"
+)
+
+func TestVolcanoSetOperations(t *testing.T) {
+	// the rows holding nulls are equal to each other, the primary input is spread over two batches.
+	primary := [][][]any{{{1, 1, 2}, {10, 10, 20}}, {{nil, nil, 3}, {nil, nil, 30}}}
+	secondary := [][]any{{1, nil, 4}, {10, nil, 40}}
+
+	tests := []struct {
+		op       plan.SetOp
+		expected string
+	}{
+		{plan.SetOpUnionAll, "[1,10 1,10 2,20 null,null null,null 3,30 1,10 null,null 4,40]"},
+		{plan.SetOpUnionDistinct, "[1,10 2,20 null,null 3,30 4,40]"},
+		{plan.SetOpMinusPrimary, "[2,20 3,30]"},
+		{plan.SetOpMinusMultiset, "[1,10 2,20 null,null 3,30]"},
+		{plan.SetOpIntersectionPrimary, "[1,10 null,null]"},
+		{plan.SetOpIntersectionMultiset, "[1,10 null,null]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.op.String(), func(t *testing.T) {
+			inputs := []*VolcanoOperator{newValues(t, []string{"id", "value"}, primary...), newValues(t, []string{"key", "amount"}, secondary)}
+			set, err := NewVolcanoSet(testContext(), inputs, test.op, []string{"a", "b"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var operator VolcanoOperator
+			operator = set
+
+			if rows := readRows(t, &operator); fmt.Sprint(rows) != test.expected {
+				t.Errorf("expected rows: %s, got: %v", test.expected, rows)
+			}
+		})
+	}
+}
+
+func TestVolcanoSetNames(t *testing.T) {
+	set, err := NewVolcanoSet(testContext(), []*VolcanoOperator{newValues(t, []string{"id"}, [][]any{{1}})}, plan.SetOpUnionAll, []string{"renamed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := set.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer set.Close()
+
+	batch, err := set.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer (*batch).Release()
+	if name := (*batch).Schema().Field(0).Name; name != "renamed" {
+		t.Errorf("expected the column to be named after the set relation, got: %s", name)
+	}
+
+	if _, err := NewVolcanoSet(testContext(), nil, plan.SetOp(0), nil); err == nil {
+		t.Errorf("expected an unknown set operation to be rejected")
+	}
+}
@@ -0,0 +1,307 @@
+package engine
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/substrait-io/substrait-go/expr"
+	"github.com/substrait-io/substrait-go/proto"
+	"github.com/substrait-io/substrait-go/types"
+	"sort"
+)
+
+// VolcanoSort materializes every batch of its child and returns them as a single batch ordered by the sort fields.
+type VolcanoSort struct {
+	child VolcanoOperator
+	ctx   context.Context
+	sorts []expr.SortField
+	done  bool
+}
+
+func NewVolcanoSort(ctx context.Context, child *VolcanoOperator, sorts []expr.SortField) *VolcanoSort {
+	return &VolcanoSort{child: *child, ctx: ctx, sorts: sorts}
+}
+
+func (s *VolcanoSort) Open() error {
+	return s.child.Open()
+}
+
+func (s *VolcanoSort) Next() (ColumnarBatch, error) {
+	if s.done {
+		return nil, EOB
+	}
+
+	s.done = true
+
+	batches, err := drain(s.child)
+	if err != nil {
+		return nil, err
+	}
+
+	defer releaseRecords(batches)
+
+	if len(batches) == 0 {
+		return nil, EOB
+	}
+
+	batch, err := Concatenate(s.ctx, batches)
+	if err != nil {
+		return nil, err
+	}
+
+	defer batch.Release()
+
+	keys, err := newSortKeys(s.ctx, s.sorts, batch)
+	if err != nil {
+		return nil, err
+	}
+
+	defer keys.release()
+
+	indices := make([]int64, batch.NumRows())
+	for i := range indices {
+		indices[i] = int64(i)
+	}
+
+	sort.SliceStable(indices, func(i, j int) bool {
+		return keys.compare(int(indices[i]), int(indices[j])) < 0
+	})
+
+	permutation := newIndices(s.ctx, indices, nil)
+	defer permutation.Release()
+
+	sorted, err := take(s.ctx, batch, permutation)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sorted, nil
+}
+
+func (s *VolcanoSort) Close() error {
+	return s.child.Close()
+}
+
+// VolcanoTopN returns the first limit rows of its child ordered by the sort fields as a single batch. Only the
+// current best rows are kept between batches, they are selected with a bounded heap so memory stays proportional to
+// limit instead of the size of the input.
+type VolcanoTopN struct {
+	child VolcanoOperator
+	ctx   context.Context
+	sorts []expr.SortField
+	limit int64
+	done  bool
+}
+
+func NewVolcanoTopN(ctx context.Context, child *VolcanoOperator, sorts []expr.SortField, limit int64) *VolcanoTopN {
+	return &VolcanoTopN{child: *child, ctx: ctx, sorts: sorts, limit: limit}
+}
+
+func (topN *VolcanoTopN) Open() error {
+	return topN.child.Open()
+}
+
+func (topN *VolcanoTopN) Next() (ColumnarBatch, error) {
+	if topN.done || topN.limit == 0 {
+		return nil, EOB
+	}
+
+	topN.done = true
+
+	var kept arrow.Record
+	defer func() {
+		if kept != nil {
+			kept.Release()
+		}
+	}()
+
+	for {
+		batch, err := topN.child.Next()
+		if err == EOB {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		candidates := []arrow.Record{*batch}
+		if kept != nil {
+			candidates = []arrow.Record{kept, *batch}
+		}
+
+		merged, err := Concatenate(topN.ctx, candidates)
+		(*batch).Release()
+		if err != nil {
+			return nil, err
+		}
+
+		selected, err := topN.selectRows(merged)
+		merged.Release()
+		if err != nil {
+			return nil, err
+		}
+
+		if kept != nil {
+			kept.Release()
+		}
+
+		kept = selected
+	}
+
+	if kept == nil {
+		return nil, EOB
+	}
+
+	result := kept
+	kept = nil
+
+	return &result, nil
+}
+
+func (topN *VolcanoTopN) Close() error {
+	return topN.child.Close()
+}
+
+// selectRows returns the first rows of batch in sort order, at most limit of them.
+func (topN *VolcanoTopN) selectRows(batch arrow.Record) (arrow.Record, error) {
+	keys, err := newSortKeys(topN.ctx, topN.sorts, batch)
+	if err != nil {
+		return nil, err
+	}
+
+	defer keys.release()
+
+	// the heap is ordered from the worst to the best row so the worst kept row is evicted first, ties are broken on
+	// the row index which keeps the selection stable.
+	rows := &rowHeap{compare: func(i int64, j int64) int {
+		if c := keys.compare(int(i), int(j)); c != 0 {
+			return c
+		}
+
+		return compareOrdered(i, j)
+	}}
+
+	for row := int64(0); row < batch.NumRows(); row++ {
+		if int64(rows.Len()) < topN.limit {
+			heap.Push(rows, row)
+			continue
+		}
+
+		if rows.compare(row, rows.indices[0]) < 0 {
+			rows.indices[0] = row
+			heap.Fix(rows, 0)
+		}
+	}
+
+	indices := make([]int64, rows.Len())
+	for i := len(indices) - 1; i >= 0; i-- {
+		indices[i] = heap.Pop(rows).(int64)
+	}
+
+	selection := newIndices(topN.ctx, indices, nil)
+	defer selection.Release()
+
+	return take(topN.ctx, batch, selection)
+}
+
+// rowHeap is a max heap of row indices according to compare.
+type rowHeap struct {
+	indices []int64
+	compare func(int64, int64) int
+}
+
+func (rows *rowHeap) Len() int {
+	return len(rows.indices)
+}
+
+func (rows *rowHeap) Less(i int, j int) bool {
+	return rows.compare(rows.indices[i], rows.indices[j]) > 0
+}
+
+func (rows *rowHeap) Swap(i int, j int) {
+	rows.indices[i], rows.indices[j] = rows.indices[j], rows.indices[i]
+}
+
+func (rows *rowHeap) Push(value any) {
+	rows.indices = append(rows.indices, value.(int64))
+}
+
+func (rows *rowHeap) Pop() any {
+	last := rows.indices[len(rows.indices)-1]
+	rows.indices = rows.indices[:len(rows.indices)-1]
+
+	return last
+}
+
+type sortKey struct {
+	column     arrow.Array
+	descending bool
+	nullsFirst bool
+}
+
+type sortKeys []sortKey
+
+func newSortKeys(ctx context.Context, sorts []expr.SortField, batch arrow.Record) (sortKeys, error) {
+	keys := make(sortKeys, 0, len(sorts))
+	for _, field := range sorts {
+		direction, ok := field.Kind.(types.SortDirection)
+		if !ok {
+			keys.release()
+			return nil, fmt.Errorf("sort field: '%s' uses a comparison function which is not supported", field.Expr)
+		}
+
+		column, err := EvaluateExpression(ctx, field.Expr, batch)
+		if err != nil {
+			keys.release()
+			return nil, err
+		}
+
+		key := sortKey{column: column}
+		switch proto.SortField_SortDirection(direction) {
+		case proto.SortField_SORT_DIRECTION_ASC_NULLS_FIRST:
+			key.nullsFirst = true
+		case proto.SortField_SORT_DIRECTION_DESC_NULLS_FIRST:
+			key.descending = true
+			key.nullsFirst = true
+		case proto.SortField_SORT_DIRECTION_DESC_NULLS_LAST:
+			key.descending = true
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// compare orders the rows i and j of the batch the keys have been evaluated against.
+func (keys sortKeys) compare(i int, j int) int {
+	for _, key := range keys {
+		leftNull, rightNull := key.column.IsNull(i), key.column.IsNull(j)
+		if leftNull != rightNull {
+			if leftNull == key.nullsFirst {
+				return -1
+			}
+
+			return 1
+		}
+
+		c := CompareValues(key.column, i, key.column, j)
+		if key.descending {
+			c = -c
+		}
+
+		if c != 0 {
+			return c
+		}
+	}
+
+	return 0
+}
+
+func (keys sortKeys) release() {
+	for _, key := range keys {
+		key.column.Release()
+	}
+}
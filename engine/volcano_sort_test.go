@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/substrait-io/substrait-go/expr"
+	"github.com/substrait-io/substrait-go/proto"
+	"github.com/substrait-io/substrait-go/types"
+	"testing"
+)
+
+// ranked holds rows tied on their rank, spread over three batches, the value telling them apart.
+var ranked = [][][]any{
+	{{2, 1, nil}, {0, 1, 2}},
+	{{1, 2, 3}, {3, 4, 5}},
+	{{nil, 1, 3}, {6, 7, 8}},
+}
+
+func sortField(t *testing.T, index int32, direction proto.SortField_SortDirection) expr.SortField {
+	return expr.SortField{Expr: column(t, index, 2), Kind: types.SortDirection(direction)}
+}
+
+func TestVolcanoSort(t *testing.T) {
+	tests := []struct {
+		name     string
+		sorts    []expr.SortField
+		expected string
+	}{
+		// the rows tied on their rank keep the order they were read in.
+		{"ascending", []expr.SortField{sortField(t, 0, proto.SortField_SORT_DIRECTION_ASC_NULLS_LAST)}, "[1,1 1,3 1,7 2,0 2,4 3,5 3,8 null,2 null,6]"},
+		{"descendingNullsFirst", []expr.SortField{sortField(t, 0, proto.SortField_SORT_DIRECTION_DESC_NULLS_FIRST)}, "[null,2 null,6 3,5 3,8 2,0 2,4 1,1 1,3 1,7]"},
+		{"twoKeys", []expr.SortField{sortField(t, 0, proto.SortField_SORT_DIRECTION_ASC_NULLS_FIRST), sortField(t, 1, proto.SortField_SORT_DIRECTION_DESC_NULLS_LAST)}, "[null,6 null,2 1,7 1,3 1,1 2,4 2,0 3,8 3,5]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var operator VolcanoOperator
+			operator = NewVolcanoSort(testContext(), newValues(t, []string{"rank", "value"}, ranked...), test.sorts)
+
+			if rows := readRows(t, &operator); fmt.Sprint(rows) != test.expected {
+				t.Errorf("expected rows: %s, got: %v", test.expected, rows)
+			}
+		})
+	}
+}
+
+func TestVolcanoTopN(t *testing.T) {
+	sorts := []expr.SortField{sortField(t, 0, proto.SortField_SORT_DIRECTION_ASC_NULLS_LAST)}
+
+	// the rows tied with the last one kept are selected in the order they were read in, like a sort followed by a limit.
+	for limit := int64(0); limit <= 10; limit++ {
+		var sorted VolcanoOperator
+		sorted = NewVolcanoSort(testContext(), newValues(t, []string{"rank", "value"}, ranked...), sorts)
+		sorted = NewVolcanoLimit(&sorted, 0, limit)
+
+		var topN VolcanoOperator
+		topN = NewVolcanoTopN(testContext(), newValues(t, []string{"rank", "value"}, ranked...), sorts, limit)
+
+		expected := readRows(t, &sorted)
+		if rows := readRows(t, &topN); fmt.Sprint(rows) != fmt.Sprint(expected) {
+			t.Errorf("expected the first %d rows: %v, got: %v", limit, expected, rows)
+		}
+	}
+}
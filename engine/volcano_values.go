@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"github.com/apache/arrow/go/v13/arrow"
+)
+
+// VolcanoValues emits a fixed list of batches, it backs inline tables such as substrait virtual tables.
+type VolcanoValues struct {
+	batches  []arrow.Record
+	position int
+}
+
+// NewVolcanoValues creates an operator emitting batches, it takes ownership of them.
+func NewVolcanoValues(batches []arrow.Record) *VolcanoValues {
+	return &VolcanoValues{batches: batches}
+}
+
+func (values *VolcanoValues) Open() error {
+	values.position = 0
+	return nil
+}
+
+func (values *VolcanoValues) Next() (ColumnarBatch, error) {
+	if values.position >= len(values.batches) {
+		return nil, EOB
+	}
+
+	batch := values.batches[values.position]
+	values.position += 1
+
+	batch.Retain()
+	return &batch, nil
+}
+
+func (values *VolcanoValues) Close() error {
+	releaseRecords(values.batches)
+	values.batches = nil
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"github.com/exsql-io/go-datastore/common"
+	"github.com/exsql-io/go-datastore/services"
+	"github.com/exsql-io/go-datastore/store"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"testing"
+	"time"
+)
+
+// BenchmarkLeafIngest measures the throughput of the records handed over to a leaf in messages of a single record over
+// an unbuffered channel, against the batches of a fetch over the bounded channel of a tailer, put by a single goroutine
+// or by the pipelines of 4 partitions.
+func BenchmarkLeafIngest(b *testing.B) {
+	benchmarks := []struct {
+		name       string
+		capacity   int
+		batchSize  int
+		partitions int
+	}{
+		{"unbuffered", 0, 1, 1},
+		{"batch", services.ChannelCapacity, 500, 1},
+		{"partitioned", services.ChannelCapacity, 500, 4},
+	}
+
+	for _, benchmark := range benchmarks {
+		b.Run(benchmark.name, func(b *testing.B) {
+			benchmarkLeafIngest(b, benchmark.capacity, benchmark.batchSize, benchmark.partitions)
+		})
+	}
+}
+
+func benchmarkLeafIngest(b *testing.B, capacity int, batchSize int, partitions int) {
+	schema, err := common.FromYaml("testdata/yaml/nested_schema.yaml")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	options := store.Options{Partitioned: partitions > 1}
+	leaf, err := services.NewLeaf("events", *schema, store.Json, options, "", services.BadRecordPolicy{}, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	defer (*leaf.Store).Close()
+
+	records := make([]*kgo.Record, b.N)
+	for offset := range records {
+		value := fmt.Sprintf(`{"eventId":"e%d","tags":["t%d"],"location":{"latitude":1.5,"longitude":2.5},"stops":[]}`, offset, offset%10)
+		partition := int32(offset / batchSize % partitions)
+		records[offset] = &kgo.Record{Partition: partition, Offset: int64(offset), Timestamp: time.UnixMilli(int64(offset)), Value: []byte(value)}
+	}
+
+	input := make(chan services.Message, capacity)
+	leaf.Start(&input)
+
+	b.ResetTimer()
+	start := time.Now()
+	for from := 0; from < len(records); from += batchSize {
+		to := from + batchSize
+		if to > len(records) {
+			to = len(records)
+		}
+
+		input <- services.Message{Partition: records[from].Partition, Records: records[from:to]}
+	}
+
+	// the last batches may still be put once sent.
+	for leaf.Counters().Put < int64(b.N) {
+		time.Sleep(100 * time.Microsecond)
+	}
+
+	b.StopTimer()
+	b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "records/s")
+}
@@ -0,0 +1,599 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/apache/arrow/go/v13/arrow/array"
+	"github.com/apache/arrow/go/v13/arrow/compute"
+	"github.com/apache/arrow/go/v13/arrow/compute/exprs"
+	"github.com/apache/arrow/go/v13/arrow/memory"
+	"github.com/exsql-io/go-datastore/engine"
+	"github.com/exsql-io/go-datastore/services"
+	"github.com/exsql-io/go-datastore/store"
+	"github.com/substrait-io/substrait-go/expr"
+	"github.com/substrait-io/substrait-go/plan"
+	"github.com/substrait-io/substrait-go/types"
+	"strings"
+)
+
+// convertedRel is the volcano operator tree produced for a substrait relation along with the names of its output
+// columns.
+type convertedRel struct {
+	operator *engine.VolcanoOperator
+	names    []string
+}
+
+// planConverter converts the relations of a plan, the store iterators opened by their scans being closed when the
+// conversion of the plan fails.
+type planConverter struct {
+	leafs     map[string]*services.Leaf
+	ctx       context.Context
+	iterators []*engine.CloseableIterator
+}
+
+func convertPlanToVolcanoOperator(leafs map[string]*services.Leaf, p *plan.Plan) (*engine.VolcanoOperator, error) {
+	root, err := extractRootFromPlan(p)
+	if err != nil {
+		return nil, err
+	}
+
+	converter := planConverter{
+		leafs: leafs,
+		ctx:   planContext(p),
+	}
+
+	converted, err := converter.convert(root.Input())
+	if err != nil {
+		converter.closeIterators()
+		return nil, err
+	}
+
+	// names of the root are given in depth-first order, they can only be applied when no column is a structure.
+	names := root.Names()
+	if len(names) != len(converted.names) {
+		return converted.operator, nil
+	}
+
+	return converter.selectColumns(converted.operator, identityMapping(len(names)), names), nil
+}
+
+// closeIterators closes the store iterators opened so far.
+func (converter *planConverter) closeIterators() {
+	for _, iterator := range converter.iterators {
+		(*iterator).Close()
+	}
+
+	converter.iterators = nil
+}
+
+// planContext returns the context the expressions of p are evaluated with.
+func planContext(p *plan.Plan) context.Context {
+	extensionSet := exprs.NewExtensionSet(p.ExtensionRegistry(), exprs.DefaultExtensionIDRegistry)
+	return exprs.WithExtensionIDSet(compute.WithAllocator(context.Background(), memory.DefaultAllocator), extensionSet)
+}
+
+func extractRootFromPlan(p *plan.Plan) (*plan.Root, error) {
+	if len(p.Relations()) != 1 {
+		return nil, fmt.Errorf("expecting only one relation part of the plan got: %d", len(p.Relations()))
+	}
+
+	relation := p.Relations()[0]
+	if !relation.IsRoot() {
+		return nil, errors.New("expecting the plan relation to be a root one")
+	}
+
+	return relation.Root(), nil
+}
+
+// convert recursively builds the volcano operator tree of the relation and applies its output mapping.
+func (converter *planConverter) convert(rel plan.Rel) (*convertedRel, error) {
+	var converted *convertedRel
+	var err error
+
+	switch r := rel.(type) {
+	case *plan.NamedTableReadRel:
+		converted, err = converter.convertNamedTableRead(r, nil)
+	case *plan.VirtualTableReadRel:
+		converted, err = converter.convertVirtualTableRead(r)
+	case *plan.FilterRel:
+		converted, err = converter.convertFilter(r)
+	case *plan.ProjectRel:
+		converted, err = converter.convertProject(r)
+	case *plan.AggregateRel:
+		converted, err = converter.convertAggregate(r)
+	case *plan.SortRel:
+		converted, err = converter.convertSort(r)
+	case *plan.FetchRel:
+		converted, err = converter.convertFetch(r)
+	case *plan.JoinRel:
+		converted, err = converter.convertJoin(r, r.Left(), r.Right(), r.Type(), r.Expr(), r.PostJoinFilter())
+	case *plan.CrossRel:
+		converted, err = converter.convertJoin(r, r.Left(), r.Right(), plan.JoinTypeInner, expr.NewPrimitiveLiteral(true, false), nil)
+	case *plan.SetRel:
+		converted, err = converter.convertSet(r)
+	default:
+		return nil, fmt.Errorf("relation: '%T' is not supported", rel)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := rel.OutputMapping()
+	if mapping == nil {
+		return converted, nil
+	}
+
+	names := make([]string, len(mapping))
+	for i, index := range mapping {
+		if int(index) >= len(converted.names) {
+			return nil, fmt.Errorf("output mapping index: %d is out of range, relation has %d columns", index, len(converted.names))
+		}
+
+		names[i] = converted.names[index]
+	}
+
+	return &convertedRel{operator: converter.selectColumns(converted.operator, mapping, names), names: names}, nil
+}
+
+// convertNamedTableRead scans the store of the table, the records of which can't match the filter of rel nor condition,
+// when set, being skipped. Both are still applied to the rows of the other records.
+func (converter *planConverter) convertNamedTableRead(rel *plan.NamedTableReadRel, condition expr.Expression) (*convertedRel, error) {
+	name := strings.Join(rel.Names(), ".")
+	leaf, ok := converter.leafs[name]
+	if !ok {
+		return nil, fmt.Errorf("table: '%s' does not exist", name)
+	}
+
+	var conditions []expr.Expression
+	for _, pushed := range []expr.Expression{rel.Filter(), rel.BestEffortFilter(), condition} {
+		if pushed != nil {
+			conditions = append(conditions, pushed)
+		}
+	}
+
+	var predicate *store.Predicate
+	if len(conditions) > 0 {
+		predicate = store.NewPredicate(converter.ctx, conditions...)
+	}
+
+	var names []string
+	for _, field := range (*leaf.Store).Schema().Fields() {
+		names = append(names, field.Name)
+	}
+
+	// the rows of a table are not ordered, the batches of the partitions of a store are thus read as they come.
+	columns, filters, projected := pushedProjection(rel, len(names))
+	iterator, err := (*leaf.Store).Iterator(store.Scan{Predicate: predicate, Columns: columns, Order: store.Any})
+	if err != nil {
+		return nil, err
+	}
+
+	converter.iterators = append(converter.iterators, iterator)
+
+	var operator engine.VolcanoOperator
+	operator = engine.NewVolcanoScan(iterator)
+	if !projected {
+		return converter.applyReadOptions(rel, &operator, names)
+	}
+
+	// the store returns the columns of the projection followed by the ones only the filters reference.
+	scan := &operator
+	for _, filter := range filters {
+		scan = converter.filter(scan, filter)
+	}
+
+	items := rel.Projection().Select()
+	mapping := make([]int32, len(items))
+	projectedNames := make([]string, len(items))
+	for i := range items {
+		mapping[i] = int32(i)
+		projectedNames[i] = names[items[i].Field()]
+	}
+
+	if len(columns) > len(items) {
+		scan = converter.selectColumns(scan, mapping, projectedNames)
+	}
+
+	return &convertedRel{operator: scan, names: projectedNames}, nil
+}
+
+// pushedProjection returns the columns of a table the store has to read for rel: the ones of its projection followed
+// by the other ones its filters reference, along with its filters referencing them instead. It returns false when rel
+// has no projection or when they can't be remapped, the columns then being read as a whole.
+func pushedProjection(rel plan.ReadRel, width int) ([]int, []expr.Expression, bool) {
+	if rel.Projection() == nil {
+		return nil, nil, false
+	}
+
+	var columns []int
+	positions := make(map[int32]int32)
+	items := rel.Projection().Select()
+	for i := range items {
+		field := items[i].Field()
+		if field < 0 || int(field) >= width || items[i].Child() != nil {
+			return nil, nil, false
+		}
+
+		if _, ok := positions[field]; !ok {
+			positions[field] = int32(len(columns))
+		}
+
+		columns = append(columns, int(field))
+	}
+
+	var filters []expr.Expression
+	for _, filter := range []expr.Expression{rel.Filter(), rel.BestEffortFilter()} {
+		if filter == nil {
+			continue
+		}
+
+		remapped := true
+		var visit expr.VisitFunc
+		visit = func(expression expr.Expression) expr.Expression {
+			reference, ok := expression.(*expr.FieldReference)
+			if !ok {
+				return expression.Visit(visit)
+			}
+
+			field, ok := reference.Reference.(*expr.StructFieldRef)
+			if !ok || reference.Root != expr.RootReference {
+				remapped = false
+				return expression
+			}
+
+			position, ok := positions[field.Field]
+			if !ok {
+				position = int32(len(columns))
+				positions[field.Field] = position
+				columns = append(columns, int(field.Field))
+			}
+
+			moved := *reference
+			moved.Reference = &expr.StructFieldRef{Field: position, Child: field.Child}
+			return &moved
+		}
+
+		filter = visit(filter)
+		if !remapped {
+			return nil, nil, false
+		}
+
+		filters = append(filters, filter)
+	}
+
+	return columns, filters, true
+}
+
+func (converter *planConverter) convertVirtualTableRead(rel *plan.VirtualTableReadRel) (*convertedRel, error) {
+	names := rel.BaseSchema().Names
+	values := rel.Values()
+
+	single := array.NewRecord(arrow.NewSchema(nil, nil), nil, 1)
+	defer single.Release()
+
+	fields := make([]arrow.Field, len(names))
+	columns := make([]arrow.Array, len(names))
+	for i := range names {
+		cells := make([]arrow.Array, len(values))
+		for j, row := range values {
+			cell, err := engine.EvaluateExpression(converter.ctx, row[i], single)
+			if err != nil {
+				return nil, err
+			}
+
+			cells[j] = cell
+		}
+
+		column, err := array.Concatenate(cells, memory.DefaultAllocator)
+		for _, cell := range cells {
+			cell.Release()
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		columns[i] = column
+		fields[i] = arrow.Field{Name: names[i], Type: column.DataType(), Nullable: true}
+	}
+
+	record := array.NewRecord(arrow.NewSchema(fields, nil), columns, int64(len(values)))
+	for _, column := range columns {
+		column.Release()
+	}
+
+	var operator engine.VolcanoOperator
+	operator = engine.NewVolcanoValues([]arrow.Record{record})
+
+	return converter.applyReadOptions(rel, &operator, names)
+}
+
+// applyReadOptions applies the filter and the projection mask of a read relation on top of its scan.
+func (converter *planConverter) applyReadOptions(rel plan.ReadRel, operator *engine.VolcanoOperator, names []string) (*convertedRel, error) {
+	if rel.Filter() != nil {
+		operator = converter.filter(operator, rel.Filter())
+	}
+
+	if rel.BestEffortFilter() != nil {
+		operator = converter.filter(operator, rel.BestEffortFilter())
+	}
+
+	if rel.Projection() != nil {
+		var mapping []int32
+		var projected []string
+		items := rel.Projection().Select()
+		for i := range items {
+			field := items[i].Field()
+			if field < 0 || int(field) >= len(names) {
+				return nil, fmt.Errorf("projection field: %d is out of range, relation has %d columns", field, len(names))
+			}
+
+			mapping = append(mapping, field)
+			projected = append(projected, names[field])
+		}
+
+		operator = converter.selectColumns(operator, mapping, projected)
+		names = projected
+	}
+
+	return &convertedRel{operator: operator, names: names}, nil
+}
+
+func (converter *planConverter) convertFilter(rel *plan.FilterRel) (*convertedRel, error) {
+	// the condition is pushed down to the scan of a table when it references the columns of the table itself.
+	var input *convertedRel
+	var err error
+	if read, ok := rel.Input().(*plan.NamedTableReadRel); ok && read.Projection() == nil && read.OutputMapping() == nil {
+		input, err = converter.convertNamedTableRead(read, rel.Condition())
+	} else {
+		input, err = converter.convert(rel.Input())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &convertedRel{operator: converter.filter(input.operator, rel.Condition()), names: input.names}, nil
+}
+
+func (converter *planConverter) convertProject(rel *plan.ProjectRel) (*convertedRel, error) {
+	input, err := converter.convert(rel.Input())
+	if err != nil {
+		return nil, err
+	}
+
+	// a project relation outputs every input column followed by the computed expressions.
+	names := append([]string{}, input.names...)
+	expressions := make([]expr.Expression, 0, len(names)+len(rel.Expressions()))
+	for i := range input.names {
+		expressions = append(expressions, fieldReference(int32(i)))
+	}
+
+	for i, expression := range rel.Expressions() {
+		names = append(names, expressionName(expression, input.names, i))
+		expressions = append(expressions, expression)
+	}
+
+	var operator engine.VolcanoOperator
+	operator = engine.NewVolcanoProject(converter.ctx, input.operator, names, expressions)
+
+	return &convertedRel{operator: &operator, names: names}, nil
+}
+
+func (converter *planConverter) convertAggregate(rel *plan.AggregateRel) (*convertedRel, error) {
+	if len(rel.Groupings()) > 1 {
+		return nil, errors.New("aggregate relations with more than one grouping set are not supported")
+	}
+
+	input, err := converter.convert(rel.Input())
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	var groupings []expr.Expression
+	if len(rel.Groupings()) == 1 {
+		groupings = rel.Groupings()[0]
+		for i, grouping := range groupings {
+			names = append(names, expressionName(grouping, input.names, i))
+		}
+	}
+
+	measures := make([]engine.AggregateMeasure, len(rel.Measures()))
+	for i, measure := range rel.Measures() {
+		name, _, _ := strings.Cut(measure.Measure().ID().Name, ":")
+		names = append(names, name)
+		measures[i] = engine.AggregateMeasure{Function: measure.Measure(), Filter: measure.Filter()}
+	}
+
+	var operator engine.VolcanoOperator
+	operator = engine.NewVolcanoHashAggregate(converter.ctx, input.operator, names, groupings, measures)
+
+	return &convertedRel{operator: &operator, names: names}, nil
+}
+
+func (converter *planConverter) convertSort(rel *plan.SortRel) (*convertedRel, error) {
+	input, err := converter.convert(rel.Input())
+	if err != nil {
+		return nil, err
+	}
+
+	var operator engine.VolcanoOperator
+	operator = engine.NewVolcanoSort(converter.ctx, input.operator, rel.Sorts())
+
+	return &convertedRel{operator: &operator, names: input.names}, nil
+}
+
+func (converter *planConverter) convertFetch(rel *plan.FetchRel) (*convertedRel, error) {
+	// a bounded fetch over a sort only needs the first offset + count rows in order, they are selected with a top-n.
+	if sort, ok := rel.Input().(*plan.SortRel); ok && sort.OutputMapping() == nil && rel.Count() >= 0 {
+		input, err := converter.convert(sort.Input())
+		if err != nil {
+			return nil, err
+		}
+
+		var topN engine.VolcanoOperator
+		topN = engine.NewVolcanoTopN(converter.ctx, input.operator, sort.Sorts(), rel.Offset()+rel.Count())
+
+		var operator engine.VolcanoOperator
+		operator = engine.NewVolcanoLimit(&topN, rel.Offset(), rel.Count())
+
+		return &convertedRel{operator: &operator, names: input.names}, nil
+	}
+
+	input, err := converter.convert(rel.Input())
+	if err != nil {
+		return nil, err
+	}
+
+	var operator engine.VolcanoOperator
+	operator = engine.NewVolcanoLimit(input.operator, rel.Offset(), rel.Count())
+
+	return &convertedRel{operator: &operator, names: input.names}, nil
+}
+
+func (converter *planConverter) convertJoin(rel plan.Rel, leftRel plan.Rel, rightRel plan.Rel, joinType plan.JoinType, condition expr.Expression, postJoinFilter expr.Expression) (*convertedRel, error) {
+	left, err := converter.convert(leftRel)
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := converter.convert(rightRel)
+	if err != nil {
+		return nil, err
+	}
+
+	leftSchema, err := converter.arrowSchema(leftRel, left.names)
+	if err != nil {
+		return nil, err
+	}
+
+	rightSchema, err := converter.arrowSchema(rightRel, right.names)
+	if err != nil {
+		return nil, err
+	}
+
+	join, err := engine.NewVolcanoJoin(converter.ctx, left.operator, right.operator, joinType, condition, leftSchema, rightSchema)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rel.ToProto().String(), err)
+	}
+
+	var operator engine.VolcanoOperator
+	operator = join
+
+	names := append(append([]string{}, left.names...), right.names...)
+	if joinType == plan.JoinTypeSemi || joinType == plan.JoinTypeAnti {
+		names = left.names
+	}
+
+	if postJoinFilter != nil && !isTrueLiteral(postJoinFilter) {
+		return &convertedRel{operator: converter.filter(&operator, postJoinFilter), names: names}, nil
+	}
+
+	return &convertedRel{operator: &operator, names: names}, nil
+}
+
+func (converter *planConverter) convertSet(rel *plan.SetRel) (*convertedRel, error) {
+	var inputs []*engine.VolcanoOperator
+	var names []string
+	for i, inputRel := range rel.Inputs() {
+		input, err := converter.convert(inputRel)
+		if err != nil {
+			return nil, err
+		}
+
+		if i == 0 {
+			names = input.names
+		}
+
+		inputs = append(inputs, input.operator)
+	}
+
+	set, err := engine.NewVolcanoSet(converter.ctx, inputs, rel.Op(), names)
+	if err != nil {
+		return nil, err
+	}
+
+	var operator engine.VolcanoOperator
+	operator = set
+
+	return &convertedRel{operator: &operator, names: names}, nil
+}
+
+func (converter *planConverter) filter(child *engine.VolcanoOperator, condition expr.Expression) *engine.VolcanoOperator {
+	ctx := converter.ctx
+
+	var operator engine.VolcanoOperator
+	operator = engine.NewVolcanoFilter(child, func(batch engine.ColumnarBatch) (engine.ColumnarBatch, error) {
+		selector, err := engine.EvaluateExpression(ctx, condition, *batch)
+		if err != nil {
+			return nil, err
+		}
+
+		defer selector.Release()
+
+		filtered, err := engine.FilterRecord(ctx, *batch, selector)
+		if err != nil {
+			return nil, err
+		}
+
+		return &filtered, nil
+	})
+
+	return &operator
+}
+
+// selectColumns returns the columns of child located at the indices of mapping renamed after names.
+func (converter *planConverter) selectColumns(child *engine.VolcanoOperator, mapping []int32, names []string) *engine.VolcanoOperator {
+	expressions := make([]expr.Expression, len(mapping))
+	for i, index := range mapping {
+		expressions[i] = fieldReference(index)
+	}
+
+	var operator engine.VolcanoOperator
+	operator = engine.NewVolcanoProject(converter.ctx, child, names, expressions)
+
+	return &operator
+}
+
+// arrowSchema returns the arrow schema matching the output of rel, it is used when no batch is available to infer it.
+func (converter *planConverter) arrowSchema(rel plan.Rel, names []string) (*arrow.Schema, error) {
+	recordType := rel.Remap(rel.RecordType())
+	if len(recordType.Types) != len(names) {
+		return nil, fmt.Errorf("relation has %d columns but %d names", len(recordType.Types), len(names))
+	}
+
+	return exprs.ToArrowSchema(types.NamedStruct{Names: names, Struct: recordType}, exprs.GetExtensionIDSet(converter.ctx))
+}
+
+// expressionName names the output column of an expression, direct field references keep the name of their column.
+func expressionName(expression expr.Expression, inputNames []string, index int) string {
+	if reference, ok := expression.(*expr.FieldReference); ok {
+		if field, ok := reference.Reference.(*expr.StructFieldRef); ok && field.Child == nil && int(field.Field) < len(inputNames) {
+			return inputNames[field.Field]
+		}
+	}
+
+	return fmt.Sprintf("expr_%d", index)
+}
+
+func fieldReference(index int32) expr.Expression {
+	return &expr.FieldReference{Root: expr.RootReference, Reference: &expr.StructFieldRef{Field: index}}
+}
+
+func identityMapping(size int) []int32 {
+	mapping := make([]int32, size)
+	for i := range mapping {
+		mapping[i] = int32(i)
+	}
+
+	return mapping
+}
+
+func isTrueLiteral(expression expr.Expression) bool {
+	literal, ok := expression.(*expr.PrimitiveLiteral[bool])
+	return ok && literal.Value
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"github.com/exsql-io/go-datastore/engine"
+	"github.com/exsql-io/go-datastore/store"
+	"github.com/substrait-io/substrait-go/plan"
+	"sync/atomic"
+	"testing"
+)
+
+// countingStore counts the iterators of its store which are not closed yet.
+type countingStore struct {
+	store.Store
+	open *atomic.Int64
+}
+
+func (counting countingStore) Iterator(scan store.Scan) (*engine.CloseableIterator, error) {
+	iterator, err := counting.Store.Iterator(scan)
+	if err != nil {
+		return nil, err
+	}
+
+	counting.open.Add(1)
+
+	var counted engine.CloseableIterator
+	counted = &countingIterator{CloseableIterator: *iterator, open: counting.open}
+
+	return &counted, nil
+}
+
+type countingIterator struct {
+	engine.CloseableIterator
+	open *atomic.Int64
+}
+
+func (iterator *countingIterator) Close() {
+	iterator.open.Add(-1)
+	iterator.CloseableIterator.Close()
+}
+
+func TestConvertPlanClosesIteratorsOnError(t *testing.T) {
+	leafs := testLeafs(t)
+	open := &atomic.Int64{}
+
+	var counting store.Store
+	counting = countingStore{Store: *leafs["trips"].Store, open: open}
+	leafs["trips"].Store = &counting
+
+	schema := (*leafs["trips"].Store).NamedStruct()
+	builder := plan.NewBuilderDefault()
+
+	// the scans opened for the relations converted before the failing one are closed.
+	cross, err := builder.Cross(builder.NamedScan([]string{"trips"}, schema), builder.NamedScan([]string{"missing"}, schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := builder.Set(plan.SetOpUnionAll, builder.NamedScan([]string{"trips"}, schema), builder.NamedScan([]string{"trips"}, schema), builder.NamedScan([]string{"missing"}, schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rel := range []plan.Rel{cross, set} {
+		names := make([]string, len(rel.RecordType().Types))
+		for i := range names {
+			names[i] = fmt.Sprintf("c%d", i)
+		}
+
+		p, err := builder.Plan(rel, names)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := convertPlanToVolcanoOperator(leafs, p); err == nil {
+			t.Errorf("expected the conversion of: %T to fail", rel)
+		}
+
+		if count := open.Load(); count != 0 {
+			t.Errorf("expected the iterators opened for: %T to be closed, got: %d open", rel, count)
+		}
+	}
+}
@@ -1,27 +1,21 @@
 package main
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"github.com/apache/arrow/go/v13/arrow"
-	"github.com/apache/arrow/go/v13/arrow/compute"
-	"github.com/apache/arrow/go/v13/arrow/compute/exprs"
-	"github.com/apache/arrow/go/v13/arrow/memory"
 	"github.com/exsql-io/go-datastore/engine"
 	"github.com/exsql-io/go-datastore/services"
+	"github.com/exsql-io/go-datastore/store"
 	"github.com/goccy/go-json"
 	"github.com/labstack/echo/v4"
-	"github.com/substrait-io/substrait-go/expr"
-	"github.com/substrait-io/substrait-go/plan"
-	"github.com/substrait-io/substrait-go/types"
-	"golang.org/x/exp/slices"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
-	"vitess.io/vitess/go/vt/sqlparser"
+	"sync"
+	"time"
 )
 
 func main() {
@@ -34,30 +28,43 @@ func main() {
 	var leafs = make(map[string]*services.Leaf)
 
 	for _, stream := range configuration.Streams {
-		tailer, err := services.NewTailer(configuration.InstanceId, configuration.Brokers, stream.Topic)
+		schema, inputFormatType := stream.Schema, stream.Format
+		deadLetters, err := services.NewDeadLetterWriter(configuration.InstanceId, configuration.Brokers, stream.BadRecords)
 		if err != nil {
 			panic(err)
 		}
 
-		tailer.Start()
-
-		tailers[stream.Topic] = tailer
+		leaf, err := services.NewLeaf(stream.Topic, schema, inputFormatType, stream.Options, configuration.DataDirectory, stream.BadRecords, deadLetters)
+		if err != nil {
+			panic(err)
+		}
 
-		schema, inputFormatType := stream.Schema, stream.Format
-		leaf, err := services.NewLeaf(stream.Topic, schema, inputFormatType, tailer.Channel)
+		// the tailer resumes after the records the store of the leaf was restored with, or the offsets committed by the
+		// group the topic is consumed in.
+		tailer, err := newTailer(configuration, stream, leaf, (*leaf.Store).Offsets())
 		if err != nil {
 			panic(err)
 		}
 
-		leaf.Start()
+		tailer.Start()
+		leaf.Start(tailer.Channel)
 
+		tailers[stream.Topic] = tailer
 		leafs[stream.Topic] = leaf
 	}
 
 	volcanoEngine := engine.VolcanoEngine{}
 
 	e := echo.New()
-	e.GET("/streams/:name", func(context echo.Context) error { return getStream(leafs, context) })
+	e.GET("/streams/:name", func(context echo.Context) error { return getStream(&volcanoEngine, leafs, context) })
+	e.GET("/admin/streams/:name/retention", func(context echo.Context) error { return getRetention(leafs, context) })
+	e.GET("/admin/streams/:name/counters", func(context echo.Context) error { return getCounters(leafs, context) })
+	e.POST("/admin/streams/:name/rewind", func(context echo.Context) error {
+		return postRewind(configuration, tailers, leafs, context)
+	})
+	e.POST("/admin/streams/:name/restart", func(context echo.Context) error {
+		return postRestart(configuration, tailers, leafs, context)
+	})
 	e.POST("/streams/sql", func(echoContext echo.Context) error {
 		body, err := io.ReadAll(echoContext.Request().Body)
 		if err != nil {
@@ -69,11 +76,16 @@ func main() {
 		err = json.Unmarshal(body, &message)
 		if err != nil {
 			log.Println(err.Error())
-			return err
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
 		}
 
 		p, err := planFromSql(leafs, message["query"])
 		if err != nil {
+			var sqlError *SqlError
+			if errors.As(err, &sqlError) {
+				return echo.NewHTTPError(http.StatusBadRequest, sqlError)
+			}
+
 			return err
 		}
 
@@ -93,222 +105,316 @@ func main() {
 	e.Logger.Fatal(e.Start(":1323"))
 }
 
-func getStream(leafs map[string]*services.Leaf, context echo.Context) error {
+func getStream(volcanoEngine *engine.VolcanoEngine, leafs map[string]*services.Leaf, context echo.Context) error {
 	name := context.Param("name")
-	leaf := leafs[name]
+	leaf, ok := leafs[name]
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("stream: '%s' does not exist", name))
+	}
 
-	iterator, err := (*leaf.Store).Iterator()
+	offset, err := int64QueryParam(context, "offset", 0)
 	if err != nil {
 		return err
 	}
 
-	defer (*iterator).Close()
+	limit, err := int64QueryParam(context, "limit", -1)
+	if err != nil {
+		return err
+	}
+
+	storeScan, err := scanQueryParams(context)
+	if err != nil {
+		return err
+	}
+
+	source, err := (*leaf.Store).Iterator(storeScan)
+	if err != nil {
+		return err
+	}
+
+	var scan engine.VolcanoOperator
+	scan = engine.NewVolcanoScan(source)
+
+	operator := &scan
+	if offset > 0 || limit >= 0 {
+		var bounded engine.VolcanoOperator
+		bounded = engine.NewVolcanoLimit(&scan, offset, limit)
+		operator = &bounded
+	}
+
+	iterator, err := volcanoEngine.Process(operator)
+	if err != nil {
+		return err
+	}
 
 	return iteratorResponse(iterator, context)
 }
 
-func iteratorResponse(iterator *engine.CloseableIterator, context echo.Context) error {
-	defer (*iterator).Close()
+// getRetention responds with the retention state of the store of the stream.
+func getRetention(leafs map[string]*services.Leaf, context echo.Context) error {
+	name := context.Param("name")
+	leaf, ok := leafs[name]
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("stream: '%s' does not exist", name))
+	}
 
-	context.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	context.Response().WriteHeader(http.StatusOK)
+	return context.JSON(http.StatusOK, (*leaf.Store).RetentionState())
+}
 
-	writer := context.Response()
-	for (*iterator).Next() {
-		batch := (*iterator).Value()
+// getCounters responds with the outcomes of the records of the stream and of the errors met consuming it.
+func getCounters(leafs map[string]*services.Leaf, context echo.Context) error {
+	name := context.Param("name")
+	leaf, ok := leafs[name]
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("stream: '%s' does not exist", name))
+	}
 
-		count := (*batch).NumRows()
-		for i := int64(0); i < count; i++ {
-			record := (*batch).NewSlice(i, i+1)
-			bytes, err := record.MarshalJSON()
-			if err != nil {
-				return err
-			}
+	return context.JSON(http.StatusOK, leaf.Counters())
+}
 
-			_, err = writer.Write(bytes[1 : len(bytes)-1])
-			if err != nil {
-				return err
-			}
+// rewindLock serializes the rewinds and the restarts of the streams, which replace their tailer.
+var rewindLock sync.Mutex
 
-			writer.Flush()
-			record.Release()
-		}
+// postRewind rewinds the stream to the start position held by the request body: the store of its leaf is reset and
+// rebuilt from the records of a new tailer reading its topic from there. The streams consumed in a consumer group can't
+// be rewound as the group resumes them from their committed offsets, they are restarted instead, see postRestart.
+func postRewind(configuration *Configuration, tailers map[string]*services.Tailer, leafs map[string]*services.Leaf, context echo.Context) error {
+	name := context.Param("name")
+	leaf, ok := leafs[name]
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("stream: '%s' does not exist", name))
+	}
 
-		(*batch).Release()
+	var start services.Start
+	if err := json.NewDecoder(context.Request().Body).Decode(&start); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
 	}
 
-	return nil
-}
+	if err := start.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
 
-func convertPlanToVolcanoOperator(leafs map[string]*services.Leaf, p *plan.Plan) (*engine.VolcanoOperator, error) {
-	filter, err := extractFilterFromPlan(p)
-	if err != nil {
-		return nil, err
+	rewindLock.Lock()
+	defer rewindLock.Unlock()
+
+	tailer := tailers[name]
+	if tailer.Group != "" {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("stream: '%s' is consumed in group: '%s' and can't be rewound, it can be restarted instead", name, tailer.Group))
 	}
 
-	s := leafs[filter.Input().(*plan.NamedTableReadRel).Names()[0]].Store
-	iterator, err := (*s).Iterator()
+	rewound, err := services.NewTailer(configuration.InstanceId, configuration.Brokers, name, nil, start)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var scanOperator engine.VolcanoOperator
-	scanOperator = engine.NewVolcanoScan(iterator)
+	// the leaf keeps reading the current tailer when its store can't be reset, which is thus only stopped once the leaf
+	// reads the new one.
+	if err := leaf.Rewind(rewound.Channel); err != nil {
+		rewound.Stop()
+		return err
+	}
+
+	tailer.Stop()
+	rewound.Start()
+	tailers[name] = rewound
 
-	extensionSet := exprs.NewExtensionSet(p.ExtensionRegistry(), exprs.DefaultExtensionIDRegistry)
-	extended := &expr.Extended{
-		Extensions: extensionSet.GetSubstraitRegistry().Set,
-		ReferredExpr: []expr.ExpressionReference{
-			expr.NewExpressionReference([]string{"out"}, filter.Condition()),
-		},
-		BaseSchema: (*s).NamedStruct(),
+	return context.JSON(http.StatusOK, (*leaf.Store).RetentionState())
+}
+
+// postRestart replaces the tailer of the stream by a new one, which resumes its topic without resetting the store of its
+// leaf, and responds with the counters of the leaf. The streams consumed in a consumer group re-join it, the tailers of
+// which resume after the offsets committed by the group, and the other ones resume after the last records received by
+// the leaf. It resumes a stream the tailer of which stopped on a fatal error, once its cause is fixed.
+func postRestart(configuration *Configuration, tailers map[string]*services.Tailer, leafs map[string]*services.Leaf, context echo.Context) error {
+	name := context.Param("name")
+	leaf, ok := leafs[name]
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("stream: '%s' does not exist", name))
 	}
 
-	ctx := exprs.WithExtensionIDSet(compute.WithAllocator(context.Background(), memory.DefaultAllocator), extensionSet)
+	rewindLock.Lock()
+	defer rewindLock.Unlock()
 
-	var filterOperator engine.VolcanoOperator
-	filterOperator = engine.NewVolcanoFilter(&scanOperator, func(batch engine.ColumnarBatch) engine.ColumnarBatch {
-		var records arrow.Record
-		records = *batch
+	for _, stream := range configuration.Streams {
+		if stream.Topic != name {
+			continue
+		}
 
-		recordDatum := compute.NewDatum(records)
-		selector, _ := exprs.ExecuteScalarSubstrait(ctx, extended, recordDatum)
-		dtm := selector.(*compute.ArrayDatum)
+		restarted, err := newTailer(configuration, stream, leaf, leaf.Received())
+		if err != nil {
+			return err
+		}
 
-		filtered, _ := compute.FilterRecordBatch(ctx, *batch, dtm.MakeArray(), compute.DefaultFilterOptions())
-		return &filtered
-	})
+		leaf.Resume(restarted.Channel)
+		tailers[name].Stop()
+		restarted.Start()
+		tailers[name] = restarted
 
-	return &filterOperator, nil
+		return context.JSON(http.StatusOK, leaf.Counters())
+	}
+
+	return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("stream: '%s' is not configured", name))
 }
 
-func extractFilterFromPlan(p *plan.Plan) (*plan.FilterRel, error) {
-	if len(p.Relations()) != 1 {
-		return nil, fmt.Errorf("expecting only one relation part of the plan got: %d", len(p.Relations()))
+// newTailer returns the tailer of the topic of stream read by leaf, in the consumer group of the stream, or resuming
+// after offsets, the last offset of each partition already consumed, when the stream is consumed without group.
+func newTailer(configuration *Configuration, stream Stream, leaf *services.Leaf, offsets map[int32]int64) (*services.Tailer, error) {
+	if group := configuration.GroupId(stream); group != "" {
+		return services.NewGroupTailer(configuration.InstanceId, configuration.Brokers, stream.Topic, group, stream.Start, leaf)
 	}
 
-	relation := p.Relations()[0]
-	if !relation.IsRoot() {
-		return nil, errors.New("expecting the plan relation to be a root one")
+	return services.NewTailer(configuration.InstanceId, configuration.Brokers, stream.Topic, offsets, stream.Start)
+}
+
+// scanQueryParams returns the scan of a stream described by the query parameters: order, forward, backward or any, the
+// partitions read, partition, which may be repeated, and the bounds of the offsets, fromOffset and toOffset, in each
+// partition read, and of the timestamps, fromTimestamp and toTimestamp, of its rows. The lower bounds are inclusive and
+// the upper bounds exclusive.
+func scanQueryParams(context echo.Context) (store.Scan, error) {
+	scan := store.Scan{Order: store.Order(context.QueryParam("order"))}
+	if scan.Order != "" && scan.Order != store.Forward && scan.Order != store.Backward && scan.Order != store.Any {
+		return store.Scan{}, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid value: '%s' for query parameter: 'order'", scan.Order))
 	}
 
-	root := relation.Root()
-	rel := root.Input()
+	for _, value := range context.QueryParams()["partition"] {
+		partition, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || partition < 0 {
+			return store.Scan{}, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid value: '%s' for query parameter: 'partition'", value))
+		}
 
-	switch r := rel.(type) {
-	case *plan.FilterRel:
-		return r, nil
+		scan.Partitions = append(scan.Partitions, int32(partition))
 	}
 
-	log.Printf("%+v\n", rel)
+	if context.QueryParam("fromOffset") != "" || context.QueryParam("toOffset") != "" {
+		from, err := int64QueryParam(context, "fromOffset", 0)
+		if err != nil {
+			return store.Scan{}, err
+		}
 
-	return nil, errors.New("not implemented")
-}
+		to, err := int64QueryParam(context, "toOffset", 0)
+		if err != nil {
+			return store.Scan{}, err
+		}
 
-func planFromSql(leafs map[string]*services.Leaf, sql string) (*plan.Plan, error) {
-	statement, err := sqlparser.Parse(sql)
-	if err != nil {
-		return nil, err
-	}
-
-	switch stm := statement.(type) {
-	case *sqlparser.Select:
-		switch condition := stm.Where.Expr.(type) {
-		case *sqlparser.ComparisonExpr:
-			leaf := leafs[stm.From[0].(*sqlparser.AliasedTableExpr).Expr.(sqlparser.TableName).Name.String()]
-			builder := plan.NewBuilderDefault()
-			rel, err := buildFilter(leaf, builder, condition)
-			if err != nil {
-				return nil, err
-			}
+		scan.Offsets = &store.OffsetRange{From: from, To: to}
+	}
 
-			p, err := builder.Plan(rel, toColumnNames(stm.SelectExprs))
-			if err != nil {
-				return nil, err
-			}
+	if context.QueryParam("fromTimestamp") != "" || context.QueryParam("toTimestamp") != "" {
+		from, err := timeQueryParam(context, "fromTimestamp")
+		if err != nil {
+			return store.Scan{}, err
+		}
 
-			return p, nil
+		to, err := timeQueryParam(context, "toTimestamp")
+		if err != nil {
+			return store.Scan{}, err
 		}
+
+		scan.Timestamps = &store.TimeRange{From: from, To: to}
 	}
 
-	return nil, errors.New("not implemented")
+	return scan, nil
 }
 
-func buildFilter(leaf *services.Leaf, builder plan.Builder, comparison *sqlparser.ComparisonExpr) (*plan.FilterRel, error) {
-	scan := builder.NamedScan([]string{leaf.Name}, (*leaf.Store).NamedStruct())
+// timeQueryParam returns the time held by the query parameter name, in RFC 3339 or in epoch milliseconds, or the zero
+// time when it is not set.
+func timeQueryParam(context echo.Context, name string) (time.Time, error) {
+	value := context.QueryParam(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
 
-	condition, err := toCondition(builder, scan, comparison)
-	if err != nil {
-		return nil, err
+	if milliseconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(milliseconds), nil
 	}
 
-	filter, err := builder.Filter(scan, condition)
+	parsed, err := time.Parse(time.RFC3339Nano, value)
 	if err != nil {
-		return nil, err
+		return time.Time{}, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid value: '%s' for query parameter: '%s'", value, name))
 	}
 
-	return filter, nil
+	return parsed, nil
 }
 
-func toCondition(builder plan.Builder, scan *plan.NamedTableReadRel, comparison *sqlparser.ComparisonExpr) (*expr.ScalarFunction, error) {
-	left, err := toArg(builder, scan, comparison.Left)
-	if err != nil {
-		return nil, err
+// int64QueryParam returns the value of the query parameter name, or defaultValue when it is not set.
+func int64QueryParam(context echo.Context, name string, defaultValue int64) (int64, error) {
+	value := context.QueryParam(name)
+	if value == "" {
+		return defaultValue, nil
 	}
 
-	right, err := toArg(builder, scan, comparison.Right)
-	if err != nil {
-		return nil, err
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || parsed < defaultValue {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid value: '%s' for query parameter: '%s'", value, name))
+	}
+
+	return parsed, nil
+}
+
+// iteratorResponse streams the rows of iterator as json. Its first batch is pulled before the status is written, so a
+// query failing right away is answered with its error. The status being sent once the rows are streamed, a failure
+// afterward aborts the response for the client not to mistake the rows it received for the whole result.
+func iteratorResponse(iterator *engine.CloseableIterator, context echo.Context) error {
+	defer (*iterator).Close()
+
+	next := (*iterator).Next()
+	if err := iteratorErr(iterator); !next && err != nil {
+		return err
 	}
 
-	fn, err := builder.ScalarFn(
-		"https://github.com/substrait-io/substrait/blob/main/extensions/functions_comparison.yaml",
-		"equal",
-		nil,
-		left,
-		right,
-	)
+	context.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	context.Response().WriteHeader(http.StatusOK)
 
-	if err != nil {
-		return nil, err
+	writer := context.Response()
+	for ; next; next = (*iterator).Next() {
+		batch := (*iterator).Value()
+		err := writeRows(writer, *batch)
+		(*batch).Release()
+		if err != nil {
+			abortResponse(err)
+		}
 	}
 
-	return fn, nil
+	if err := iteratorErr(iterator); err != nil {
+		abortResponse(err)
+	}
+
+	return nil
 }
 
-func toArg(builder plan.Builder, scan *plan.NamedTableReadRel, sqlExpr sqlparser.Expr) (types.FuncArg, error) {
-	switch value := sqlExpr.(type) {
-	case *sqlparser.Literal:
-		switch value.Type {
-		case sqlparser.StrVal:
-			return expr.NewPrimitiveLiteral(value.Val, false), nil
-		case sqlparser.IntVal:
-			i, err := strconv.ParseInt(value.Val, 10, 32)
-			if err != nil {
-				return nil, err
-			}
+// writeRows writes each row of batch as a json object.
+func writeRows(writer *echo.Response, batch arrow.Record) error {
+	count := batch.NumRows()
+	for i := int64(0); i < count; i++ {
+		record := batch.NewSlice(i, i+1)
+		bytes, err := record.MarshalJSON()
+		record.Release()
+		if err != nil {
+			return err
+		}
 
-			return expr.NewPrimitiveLiteral(int32(i), false), nil
+		_, err = writer.Write(bytes[1 : len(bytes)-1])
+		if err != nil {
+			return err
 		}
-	case *sqlparser.ColName:
-		index := slices.Index(scan.BaseSchema().Names, value.Name.String())
-		return builder.RootFieldRef(scan, int32(index))
+
+		writer.Flush()
 	}
 
-	return nil, errors.New("not implemented")
+	return nil
 }
 
-func toColumnNames(selectExprs sqlparser.SelectExprs) []string {
-	columns := make([]string, len(selectExprs))
-	for _, e := range selectExprs {
-		switch column := e.(type) {
-		case *sqlparser.Nextval:
-			switch literal := column.Expr.(type) {
-			case *sqlparser.Literal:
-				columns = append(columns, literal.Val)
-			}
-		}
+// iteratorErr returns the error iterator stopped on, if it may stop on any.
+func iteratorErr(iterator *engine.CloseableIterator) error {
+	if fallible, ok := (*iterator).(engine.FallibleIterator); ok {
+		return fallible.Err()
 	}
 
-	return columns
+	return nil
+}
+
+// abortResponse logs err and aborts the response being streamed, the connection being closed without ending it.
+func abortResponse(err error) {
+	log.Println(err.Error())
+	panic(http.ErrAbortHandler)
 }
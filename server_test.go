@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/apache/arrow/go/v13/arrow/array"
+	"github.com/apache/arrow/go/v13/arrow/memory"
+	"github.com/exsql-io/go-datastore/engine"
+	"github.com/exsql-io/go-datastore/services"
+	"github.com/exsql-io/go-datastore/store"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// failingIterator returns its batches and then stops on err.
+type failingIterator struct {
+	batches []arrow.Record
+	current arrow.Record
+	err     error
+}
+
+func (iterator *failingIterator) Next() bool {
+	if len(iterator.batches) == 0 {
+		return false
+	}
+
+	iterator.current, iterator.batches = iterator.batches[0], iterator.batches[1:]
+	iterator.current.Retain()
+	return true
+}
+
+func (iterator *failingIterator) Value() engine.ColumnarBatch {
+	return &iterator.current
+}
+
+func (iterator *failingIterator) Close() {}
+
+func (iterator *failingIterator) Err() error {
+	return iterator.err
+}
+
+func TestIteratorResponseErrors(t *testing.T) {
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.PrimitiveTypes.Int64}}, nil))
+	builder.Field(0).(*array.Int64Builder).AppendValues([]int64{1, 2}, nil)
+	batch := builder.NewRecord()
+	builder.Release()
+	defer batch.Release()
+
+	// a query failing before its first batch is answered with its error.
+	context, recorder := newTestContext()
+	var iterator engine.CloseableIterator
+	iterator = &failingIterator{err: errors.New("segment can't be read")}
+	if err := iteratorResponse(&iterator, context); err == nil || err.Error() != "segment can't be read" {
+		t.Errorf("expected the error of the iterator, got: %v", err)
+	}
+
+	if context.Response().Committed || recorder.Body.Len() != 0 {
+		t.Errorf("expected no response to be written, got: %s", recorder.Body.String())
+	}
+
+	// a query failing once its rows are streamed aborts the response.
+	context, recorder = newTestContext()
+	iterator = &failingIterator{batches: []arrow.Record{batch}, err: errors.New("segment can't be read")}
+	func() {
+		defer func() {
+			if recovered := recover(); recovered != http.ErrAbortHandler {
+				t.Errorf("expected the response to be aborted, got: %v", recovered)
+			}
+		}()
+
+		_ = iteratorResponse(&iterator, context)
+	}()
+
+	if recorder.Code != http.StatusOK || recorder.Body.String() != `{"id":1}`+"\n"+`{"id":2}`+"\n" {
+		t.Errorf("expected the rows streamed before the error, got: %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	// a query succeeding streams all its rows.
+	context, recorder = newTestContext()
+	iterator = &failingIterator{batches: []arrow.Record{batch}}
+	if err := iteratorResponse(&iterator, context); err != nil || recorder.Body.Len() == 0 {
+		t.Errorf("expected the rows to be streamed, got: %v %q", err, recorder.Body.String())
+	}
+}
+
+func newTestContext() (echo.Context, *httptest.ResponseRecorder) {
+	recorder := httptest.NewRecorder()
+	return echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/streams/events", nil), recorder), recorder
+}
+
+func TestScanQueryParams(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected store.Scan
+	}{
+		{"", store.Scan{}},
+		{"partition=2&fromOffset=10&toOffset=20", store.Scan{Partitions: []int32{2}, Offsets: &store.OffsetRange{From: 10, To: 20}}},
+		{"partition=1&partition=0&order=backward", store.Scan{Order: store.Backward, Partitions: []int32{1, 0}}},
+		{"order=any", store.Scan{Order: store.Any}},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, "/streams/events?"+test.query, nil)
+		scan, err := scanQueryParams(echo.New().NewContext(request, httptest.NewRecorder()))
+		if err != nil {
+			t.Errorf("expected query: '%s' to be accepted, got: %v", test.query, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(scan, test.expected) {
+			t.Errorf("expected query: '%s' to describe scan: %+v, got: %+v", test.query, test.expected, scan)
+		}
+	}
+
+	for _, query := range []string{"partition=-1", "partition=one", "partition=0&partition=2147483648", "fromOffset=-1", "order=sideways"} {
+		request := httptest.NewRequest(http.MethodGet, "/streams/events?"+query, nil)
+		_, err := scanQueryParams(echo.New().NewContext(request, httptest.NewRecorder()))
+
+		var httpError *echo.HTTPError
+		if !errors.As(err, &httpError) || httpError.Code != http.StatusBadRequest {
+			t.Errorf("expected query: '%s' to be rejected with a bad request, got: %v", query, err)
+		}
+	}
+}
+
+// failingResetStore is a store which can't be reset.
+type failingResetStore struct {
+	store.Store
+}
+
+func (store *failingResetStore) Reset() error {
+	return errors.New("store can't be reset")
+}
+
+func TestPostRewind(t *testing.T) {
+	leaf := testLeafs(t)["trips"]
+	configuration := &Configuration{InstanceId: "test", Brokers: []string{"127.0.0.1:1"}}
+
+	tailer, err := services.NewTailer(configuration.InstanceId, configuration.Brokers, "trips", nil, services.Start{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tailer.Start()
+	leaf.Start(tailer.Channel)
+
+	tailers := map[string]*services.Tailer{"trips": tailer}
+	leafs := map[string]*services.Leaf{"trips": leaf}
+
+	reset := leaf.Store
+	var failing store.Store = &failingResetStore{Store: *reset}
+	leaf.Store = &failing
+
+	context, _ := newAdminContext("rewind", "trips", `{"position":"earliest"}`)
+	if err := postRewind(configuration, tailers, leafs, context); err == nil {
+		t.Errorf("expected the rewind to fail")
+	}
+
+	if tailers["trips"] != tailer || !tailer.IsRunning() {
+		t.Errorf("expected the tailer to keep running after a failed rewind")
+	}
+
+	leaf.Store = reset
+	context, recorder := newAdminContext("rewind", "trips", `{"position":"earliest"}`)
+	if err := postRewind(configuration, tailers, leafs, context); err != nil || recorder.Code != http.StatusOK {
+		t.Fatalf("expected the rewind to succeed, got: %d %v", recorder.Code, err)
+	}
+
+	rewound := tailers["trips"]
+	defer rewound.Stop()
+
+	if rewound == tailer || tailer.IsRunning() || !rewound.IsRunning() {
+		t.Errorf("expected the tailer to be replaced by a running one")
+	}
+}
+
+func newAdminContext(action string, name string, body string) (echo.Context, *httptest.ResponseRecorder) {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/admin/streams/"+name+"/"+action, strings.NewReader(body))
+	context := echo.New().NewContext(request, recorder)
+	context.SetParamNames("name")
+	context.SetParamValues(name)
+
+	return context, recorder
+}
+
+func TestPostRestart(t *testing.T) {
+	leaf := testLeafs(t)["trips"]
+	configuration := &Configuration{InstanceId: "test", Brokers: []string{"127.0.0.1:1"}, ConsumerGroups: true, Streams: []Stream{{Topic: "trips"}}}
+
+	tailer, err := newTailer(configuration, configuration.Streams[0], leaf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tailer.Start()
+	leaf.Start(tailer.Channel)
+
+	tailers := map[string]*services.Tailer{"trips": tailer}
+	leafs := map[string]*services.Leaf{"trips": leaf, "events": testLeafs(t)["events"]}
+
+	context, _ := newAdminContext("restart", "events", "")
+	var httpError *echo.HTTPError
+	if err := postRestart(configuration, tailers, leafs, context); !errors.As(err, &httpError) || httpError.Code != http.StatusNotFound {
+		t.Errorf("expected the restart of a stream which is not configured to fail, got: %v", err)
+	}
+
+	context, recorder := newAdminContext("restart", "trips", "")
+	if err := postRestart(configuration, tailers, leafs, context); err != nil || recorder.Code != http.StatusOK {
+		t.Fatalf("expected the restart to succeed, got: %d %v", recorder.Code, err)
+	}
+
+	restarted := tailers["trips"]
+	defer restarted.Stop()
+
+	if restarted == tailer || tailer.IsRunning() || !restarted.IsRunning() || restarted.Group != "test.trips" {
+		t.Errorf("expected the tailer to be replaced by a running one of group: 'test.trips'")
+	}
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/goccy/go-json"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type BadRecordAction string
+
+const (
+	// Skip drops the records which can't be decoded.
+	Skip BadRecordAction = "skip"
+	// NullFill puts a row holding the key columns of the record in place of it, its other columns being null.
+	NullFill BadRecordAction = "nullFill"
+	// DeadLetter writes the records to a dead-letter topic or file.
+	DeadLetter BadRecordAction = "deadLetter"
+)
+
+// BadRecordPolicy is what a leaf does with the records its store can't decode, its zero value skips them. The records
+// are dead-lettered to Topic when set, and appended to the file at Path otherwise.
+type BadRecordPolicy struct {
+	Action BadRecordAction `yaml:"action" json:"action"`
+	Topic  string          `yaml:"topic" json:"topic,omitempty"`
+	Path   string          `yaml:"path" json:"path,omitempty"`
+}
+
+// Validate checks that policy can be applied by a leaf.
+func (policy BadRecordPolicy) Validate() error {
+	switch policy.Action {
+	case "", Skip, NullFill:
+		if policy.Topic != "" || policy.Path != "" {
+			return errors.New(fmt.Sprintf("action: '%s' takes no dead-letter topic or path", policy.Action))
+		}
+	case DeadLetter:
+		if (policy.Topic == "") == (policy.Path == "") {
+			return errors.New(fmt.Sprintf("action: '%s' requires either a topic or a path", policy.Action))
+		}
+	default:
+		return errors.New(fmt.Sprintf("unsupported action: '%s', expecting '%s', '%s' or '%s'", policy.Action, Skip, NullFill, DeadLetter))
+	}
+
+	return nil
+}
+
+// DeadLetterWriter writes the records a leaf can't decode along with the error they were rejected with.
+type DeadLetterWriter interface {
+	Write(record *kgo.Record, cause error) error
+	Close() error
+}
+
+// NewDeadLetterWriter returns the writer of the dead-letter topic or file of policy, or nil when it does not dead-letter
+// the records.
+func NewDeadLetterWriter(id string, brokers []string, policy BadRecordPolicy) (DeadLetterWriter, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case policy.Action != DeadLetter:
+		return nil, nil
+	case policy.Topic != "":
+		client, err := kgo.NewClient(kgo.SeedBrokers(brokers...), kgo.ClientID(id), kgo.DefaultProduceTopic(policy.Topic))
+		if err != nil {
+			return nil, err
+		}
+
+		return &deadLetterTopic{client: client}, nil
+	}
+
+	file, err := os.OpenFile(policy.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &deadLetterFile{file: file}, nil
+}
+
+// deadLetterTopic produces the records to the dead-letter topic as they were received, the topic, the partition and the
+// offset they were received from and the error they were rejected with being added as headers.
+type deadLetterTopic struct {
+	client *kgo.Client
+}
+
+func (deadLetters *deadLetterTopic) Write(record *kgo.Record, cause error) error {
+	headers := append([]kgo.RecordHeader{}, record.Headers...)
+	headers = append(headers,
+		kgo.RecordHeader{Key: "topic", Value: []byte(record.Topic)},
+		kgo.RecordHeader{Key: "partition", Value: []byte(strconv.Itoa(int(record.Partition)))},
+		kgo.RecordHeader{Key: "offset", Value: []byte(strconv.FormatInt(record.Offset, 10))},
+		kgo.RecordHeader{Key: "error", Value: []byte(cause.Error())},
+	)
+
+	deadLetter := &kgo.Record{Key: record.Key, Value: record.Value, Headers: headers, Timestamp: record.Timestamp}
+	return deadLetters.client.ProduceSync(context.Background(), deadLetter).FirstErr()
+}
+
+func (deadLetters *deadLetterTopic) Close() error {
+	deadLetters.client.Close()
+	return nil
+}
+
+// deadLetterFile appends the records to the dead-letter file as json lines, their key and value being base64 encoded.
+// The lines are written by the pipelines of the partitions concurrently.
+type deadLetterFile struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+type deadLetter struct {
+	Topic     string    `json:"topic"`
+	Partition int32     `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Timestamp time.Time `json:"timestamp"`
+	Key       []byte    `json:"key"`
+	Value     []byte    `json:"value"`
+	Error     string    `json:"error"`
+}
+
+func (deadLetters *deadLetterFile) Write(record *kgo.Record, cause error) error {
+	line, err := json.Marshal(deadLetter{
+		Topic:     record.Topic,
+		Partition: record.Partition,
+		Offset:    record.Offset,
+		Timestamp: record.Timestamp,
+		Key:       record.Key,
+		Value:     record.Value,
+		Error:     cause.Error(),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	deadLetters.lock.Lock()
+	defer deadLetters.lock.Unlock()
+
+	_, err = deadLetters.file.Write(append(line, '\n'))
+	return err
+}
+
+func (deadLetters *deadLetterFile) Close() error {
+	return deadLetters.file.Close()
+}
+
+// Counters counts the outcomes of the records received by a leaf and of the errors its tailers met.
+type Counters struct {
+	Put             int64 `json:"put"`
+	DecodeErrors    int64 `json:"decodeErrors"`
+	Skipped         int64 `json:"skipped"`
+	NullFilled      int64 `json:"nullFilled"`
+	DeadLettered    int64 `json:"deadLettered"`
+	RetriableErrors int64 `json:"retriableErrors"`
+	FatalErrors     int64 `json:"fatalErrors"`
+	StoreErrors     int64 `json:"storeErrors"`
+}
+
+// counters are the Counters of a leaf, updated as it processes its input and read concurrently.
+type counters struct {
+	put             atomic.Int64
+	decodeErrors    atomic.Int64
+	skipped         atomic.Int64
+	nullFilled      atomic.Int64
+	deadLettered    atomic.Int64
+	retriableErrors atomic.Int64
+	fatalErrors     atomic.Int64
+	storeErrors     atomic.Int64
+}
+
+func (counters *counters) snapshot() Counters {
+	return Counters{
+		Put:             counters.put.Load(),
+		DecodeErrors:    counters.decodeErrors.Load(),
+		Skipped:         counters.skipped.Load(),
+		NullFilled:      counters.nullFilled.Load(),
+		DeadLettered:    counters.deadLettered.Load(),
+		RetriableErrors: counters.retriableErrors.Load(),
+		FatalErrors:     counters.fatalErrors.Load(),
+		StoreErrors:     counters.storeErrors.Load(),
+	}
+}
@@ -2,12 +2,23 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/apache/arrow/go/v13/arrow/memory"
 	"github.com/exsql-io/go-datastore/common"
 	"github.com/exsql-io/go-datastore/store"
+	"github.com/goccy/go-json"
+	"github.com/twmb/franz-go/pkg/kgo"
 	"log"
+	"path/filepath"
+	"sync"
+	"time"
 )
 
+// EvictionInterval is the period at which the records out of the retention of the store of a leaf are evicted, on top
+// of the evictions made as records are sealed.
+var EvictionInterval = 10 * time.Second
+
 type Leaf struct {
 	Name      string
 	Schema    common.Schema
@@ -15,48 +26,339 @@ type Leaf struct {
 	Store     *store.Store
 	input     *chan Message
 	context   context.Context
+	// durable is set when the store is persisted, the offsets of its records can only then be committed.
+	durable bool
+	rewinds chan rewind
+	// key lists the key columns of the store, which the rows null-filled in place of bad records keep.
+	key         []string
+	policy      BadRecordPolicy
+	deadLetters DeadLetterWriter
+	counters    counters
+	// pipelines holds the channel of the goroutine putting the records of each partition when the store is partitioned,
+	// they are only accessed by the goroutine processing the input of the leaf.
+	partitioned bool
+	pipelines   map[int32]chan []*kgo.Record
+	pipelined   sync.WaitGroup
+	// received holds the last offset received of each partition, the records received again once the input is replaced
+	// are skipped. It is written by the goroutine processing the input of the leaf, and guarded by receivedLock.
+	receivedLock sync.Mutex
+	received     map[int32]int64
+}
+
+// rewind is a request to put the records received from input into the store of a leaf from then on, after resetting it
+// when reset is set, the result of which is sent to done.
+type rewind struct {
+	input *chan Message
+	reset bool
+	done  chan error
 }
 
-func NewLeaf(name string, schema common.Schema, inputFormatType store.InputFormatType, input *chan Message) (*Leaf, error) {
+// NewLeaf returns a leaf which store is kept in memory, or in a sub-directory of directory named after the leaf when
+// directory is set. The records the store can't decode are handled according to policy, deadLetters writing them when
+// it dead-letters them.
+func NewLeaf(name string, schema common.Schema, inputFormatType store.InputFormatType, options store.Options, directory string, policy BadRecordPolicy, deadLetters DeadLetterWriter) (*Leaf, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	if policy.Action == DeadLetter && deadLetters == nil {
+		return nil, errors.New(fmt.Sprintf("action: '%s' requires a dead-letter writer", policy.Action))
+	}
+
 	ctx := context.Background()
 	allocator := memory.DefaultAllocator
-	s, err := store.NewInMemoryStore(&allocator, inputFormatType, &schema)
+
+	var s *store.Store
+	var err error
+	if directory == "" {
+		s, err = store.NewInMemoryStore(&allocator, inputFormatType, &schema, options)
+	} else {
+		s, err = store.NewDiskStore(&allocator, inputFormatType, &schema, options, filepath.Join(directory, name))
+	}
+
 	if err != nil {
 		return nil, err
 	}
 
 	leaf := Leaf{
-		Name:      name,
-		Schema:    schema,
-		IsRunning: false,
-		input:     input,
-		context:   ctx,
-		Store:     s,
+		Name:        name,
+		Schema:      schema,
+		IsRunning:   false,
+		context:     ctx,
+		Store:       s,
+		durable:     directory != "",
+		rewinds:     make(chan rewind),
+		key:         options.Key,
+		policy:      policy,
+		deadLetters: deadLetters,
+		partitioned: options.Partitioned,
+		pipelines:   make(map[int32]chan []*kgo.Record),
+		received:    make(map[int32]int64),
 	}
 
 	return &leaf, nil
 }
 
-func (leaf *Leaf) Start() {
-	go leaf.process()
+// Start puts the batches of records received from input into the store of the leaf, in order.
+func (leaf *Leaf) Start(input *chan Message) {
+	leaf.input = input
 	leaf.IsRunning = true
+	go leaf.process()
 }
 
 func (leaf *Leaf) Stop() {
 }
 
+// Rewind resets the store of the running leaf and puts the records received from input into it from then on, the
+// records received from the previous input which were not put yet are dropped.
+func (leaf *Leaf) Rewind(input *chan Message) error {
+	done := make(chan error)
+	leaf.rewinds <- rewind{input: input, reset: true, done: done}
+
+	return <-done
+}
+
+// Resume puts the records received from input into the store of the running leaf from then on, the records of each
+// partition up to the last offset received from the previous input being skipped. The records received from the
+// previous input which were not put yet are dropped.
+func (leaf *Leaf) Resume(input *chan Message) {
+	done := make(chan error)
+	leaf.rewinds <- rewind{input: input, done: done}
+
+	<-done
+}
+
+// Received returns the last offset of each partition received by the leaf since its store was last reset.
+func (leaf *Leaf) Received() map[int32]int64 {
+	leaf.receivedLock.Lock()
+	defer leaf.receivedLock.Unlock()
+
+	received := make(map[int32]int64, len(leaf.received))
+	for partition, offset := range leaf.received {
+		received[partition] = offset
+	}
+
+	return received
+}
+
+// Assigned is called with the partitions of the topic of the leaf assigned to its tailer.
+func (leaf *Leaf) Assigned(partitions []int32) {
+	log.Printf("leaf: '%s' was assigned partitions: %v", leaf.Name, partitions)
+}
+
+// Revoked is called with the partitions of the topic of the leaf revoked from its tailer, the rows the store holds of
+// them are kept.
+func (leaf *Leaf) Revoked(partitions []int32) {
+	log.Printf("leaf: '%s' was revoked partitions: %v", leaf.Name, partitions)
+}
+
+// Offsets returns the last offset of each partition the store of the leaf holds durably, none when it is kept in
+// memory.
+func (leaf *Leaf) Offsets() map[int32]int64 {
+	if !leaf.durable {
+		return nil
+	}
+
+	return (*leaf.Store).Offsets()
+}
+
 func (leaf *Leaf) process() {
+	ticker := time.NewTicker(EvictionInterval)
+	defer ticker.Stop()
+
 	for leaf.IsRunning {
-		message := <-*leaf.input
-		if len(message.Errors) > 0 {
-			for _, err := range message.Errors {
-				log.Fatalln(err)
+		select {
+		case now := <-ticker.C:
+			// the eviction is attempted again at the next tick.
+			if err := (*leaf.Store).Evict(now); err != nil {
+				leaf.counters.storeErrors.Add(1)
+				log.Printf("leaf: '%s' can't evict records: %s", leaf.Name, err)
+			}
+		case request := <-leaf.rewinds:
+			leaf.drainPipelines()
+			var err error
+			if request.reset {
+				err = leaf.reset()
+			}
+
+			if err == nil {
+				leaf.input = request.input
+			}
+
+			request.done <- err
+		case message := <-*leaf.input:
+			if len(message.Errors) > 0 {
+				leaf.failed(message)
+				continue
+			}
+
+			records := leaf.receive(message.Partition, message.Records)
+			if len(records) == 0 {
+				continue
+			}
+
+			if leaf.partitioned {
+				leaf.pipeline(message.Partition) <- records
+				continue
+			}
+
+			for _, record := range records {
+				leaf.put(record)
 			}
 		}
+	}
+}
+
+// reset resets the store of the leaf, the records of every partition are then received again.
+func (leaf *Leaf) reset() error {
+	if err := (*leaf.Store).Reset(); err != nil {
+		return err
+	}
+
+	leaf.receivedLock.Lock()
+	defer leaf.receivedLock.Unlock()
 
-		err := (*leaf.Store).Put(message.Record.Offset, message.Record.Key, message.Record.Value)
-		if err != nil {
-			log.Fatalln(err)
+	leaf.received = make(map[int32]int64)
+	return nil
+}
+
+// receive returns the records, in offset order, of partition following the last one received, and records the offset
+// of the last of them.
+func (leaf *Leaf) receive(partition int32, records []*kgo.Record) []*kgo.Record {
+	leaf.receivedLock.Lock()
+	defer leaf.receivedLock.Unlock()
+
+	if last, ok := leaf.received[partition]; ok {
+		for len(records) > 0 && records[0].Offset <= last {
+			records = records[1:]
+		}
+	}
+
+	if len(records) > 0 {
+		leaf.received[partition] = records[len(records)-1].Offset
+	}
+
+	return records
+}
+
+// pipeline returns the channel of the goroutine putting the records of partition into the partitioned store, which is
+// started when partition is first received. The partitions are decoded in parallel, each in the order of its offsets,
+// the channels buffering up to ChannelCapacity batches before blocking the input of the leaf.
+func (leaf *Leaf) pipeline(partition int32) chan []*kgo.Record {
+	pipeline, ok := leaf.pipelines[partition]
+	if ok {
+		return pipeline
+	}
+
+	pipeline = make(chan []*kgo.Record, ChannelCapacity)
+	leaf.pipelines[partition] = pipeline
+	leaf.pipelined.Add(1)
+	go func() {
+		defer leaf.pipelined.Done()
+		for records := range pipeline {
+			for _, record := range records {
+				leaf.put(record)
+			}
+		}
+	}()
+
+	return pipeline
+}
+
+// drainPipelines waits for the records sent to the pipelines to be put, and stops their goroutines.
+func (leaf *Leaf) drainPipelines() {
+	for partition, pipeline := range leaf.pipelines {
+		close(pipeline)
+		delete(leaf.pipelines, partition)
+	}
+
+	leaf.pipelined.Wait()
+}
+
+// Counters returns the outcomes of the records received by the leaf so far.
+func (leaf *Leaf) Counters() Counters {
+	return leaf.counters.snapshot()
+}
+
+// failed counts and logs the errors the tailer met.
+func (leaf *Leaf) failed(message Message) {
+	for _, err := range message.Errors {
+		if message.Fatal {
+			leaf.counters.fatalErrors.Add(1)
+		} else {
+			leaf.counters.retriableErrors.Add(1)
+		}
+
+		log.Printf("leaf: '%s' input failed: %s", leaf.Name, err)
+	}
+
+	if message.Fatal {
+		log.Printf("leaf: '%s' input stopped, the stream has to be restarted or rewound to be resumed", leaf.Name)
+	}
+}
+
+// put puts record into the store, the records it can't decode are handled according to the bad record policy of the
+// leaf. The other errors are logged, the row put is then held by the store which retries persisting it as the next
+// records are sealed.
+func (leaf *Leaf) put(record *kgo.Record) {
+	err := (*leaf.Store).Put(record.Partition, record.Offset, record.Timestamp, record.Key, record.Value)
+	var decodeError *store.DecodeError
+	switch {
+	case err == nil:
+		leaf.counters.put.Add(1)
+		return
+	case !errors.As(err, &decodeError):
+		leaf.counters.storeErrors.Add(1)
+		log.Printf("leaf: '%s' can't persist records: %s", leaf.Name, err)
+		return
+	}
+
+	leaf.counters.decodeErrors.Add(1)
+	switch leaf.policy.Action {
+	case NullFill:
+		filled, fillErr := leaf.nullFilled(record.Value)
+		if fillErr == nil {
+			fillErr = (*leaf.Store).Put(record.Partition, record.Offset, record.Timestamp, record.Key, filled)
+		}
+
+		if fillErr == nil {
+			leaf.counters.nullFilled.Add(1)
+			return
+		}
+
+		err = errors.New(fmt.Sprintf("%s, and it can't be null-filled: %s", err, fillErr))
+	case DeadLetter:
+		deadLetterErr := leaf.deadLetters.Write(record, err)
+		if deadLetterErr == nil {
+			leaf.counters.deadLettered.Add(1)
+			return
+		}
+
+		err = errors.New(fmt.Sprintf("%s, and it can't be dead-lettered: %s", err, deadLetterErr))
+	}
+
+	leaf.counters.skipped.Add(1)
+	log.Printf("leaf: '%s' skipped record at partition: %d offset: %d: %s", leaf.Name, record.Partition, record.Offset, err)
+}
+
+// nullFilled returns the value of the row put in place of value: its key columns, the other ones being null. The rows
+// of the records which are not keyed by columns are fully null.
+func (leaf *Leaf) nullFilled(value []byte) ([]byte, error) {
+	if len(leaf.key) == 0 {
+		return []byte("{}"), nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(value, &fields); err != nil {
+		return nil, err
+	}
+
+	filled := make(map[string]json.RawMessage, len(leaf.key))
+	for _, name := range leaf.key {
+		if field, ok := fields[name]; ok {
+			filled[name] = field
 		}
 	}
+
+	return json.Marshal(filled)
 }
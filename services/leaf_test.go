@@ -0,0 +1,192 @@
+package services
+
+import (
+	"fmt"
+	"github.com/exsql-io/go-datastore/common"
+	"github.com/exsql-io/go-datastore/store"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"testing"
+	"time"
+)
+
+func TestLeafResume(t *testing.T) {
+	leaf := newTestLeaf(t, store.Options{}, "")
+	input := make(chan Message)
+	leaf.Start(&input)
+
+	input <- newMessage(0, 0, 3)
+	input <- newMessage(1, 0, 2)
+
+	resumed := make(chan Message)
+	leaf.Resume(&resumed)
+
+	// the records received before the input was replaced are skipped.
+	resumed <- newMessage(0, 1, 5)
+	resumed <- newMessage(1, 0, 1)
+	resumed <- newMessage(1, 2, 3)
+	waitForPut(t, leaf, 8)
+
+	expected := "[p0-0 p0-1 p0-2 p1-0 p1-1 p0-3 p0-4 p1-2]"
+	if eventIds := readEventIds(t, leaf); fmt.Sprint(eventIds) != expected {
+		t.Errorf("expected events: %s, got: %v", expected, eventIds)
+	}
+
+	if received := leaf.Received(); fmt.Sprint(received) != "map[0:4 1:2]" {
+		t.Errorf("expected received offsets: map[0:4 1:2], got: %v", received)
+	}
+}
+
+func TestLeafRewind(t *testing.T) {
+	leaf := newTestLeaf(t, store.Options{}, "")
+	input := make(chan Message)
+	leaf.Start(&input)
+
+	input <- newMessage(0, 0, 3)
+	waitForPut(t, leaf, 3)
+
+	rewound := make(chan Message)
+	if err := leaf.Rewind(&rewound); err != nil {
+		t.Fatal(err)
+	}
+
+	if received := leaf.Received(); len(received) != 0 {
+		t.Errorf("expected no received offsets once rewound, got: %v", received)
+	}
+
+	// the records are received again from the start once the store is reset.
+	rewound <- newMessage(0, 1, 3)
+	waitForPut(t, leaf, 5)
+
+	expected := "[p0-1 p0-2]"
+	if eventIds := readEventIds(t, leaf); fmt.Sprint(eventIds) != expected {
+		t.Errorf("expected events: %s, got: %v", expected, eventIds)
+	}
+}
+
+func TestLeafPartitioned(t *testing.T) {
+	leaf := newTestLeaf(t, store.Options{Partitioned: true}, "")
+	input := make(chan Message)
+	leaf.Start(&input)
+
+	// the messages of the partitions are interleaved, each partition being put by a pipeline of its own.
+	for from := int64(0); from < 6; from += 2 {
+		for partition := int32(2); partition >= 0; partition-- {
+			input <- newMessage(partition, from, from+2)
+		}
+	}
+
+	waitForPut(t, leaf, 18)
+
+	expected := "[p0-0 p0-1 p0-2 p0-3 p0-4 p0-5 p1-0 p1-1 p1-2 p1-3 p1-4 p1-5 p2-0 p2-1 p2-2 p2-3 p2-4 p2-5]"
+	if eventIds := readEventIds(t, leaf); fmt.Sprint(eventIds) != expected {
+		t.Errorf("expected events: %s, got: %v", expected, eventIds)
+	}
+
+	if state := (*leaf.Store).RetentionState(); state.Rows != 18 {
+		t.Errorf("expected 18 rows, got: %+v", state)
+	}
+}
+
+func TestLeafPartitionedRewind(t *testing.T) {
+	for _, directory := range []string{"", t.TempDir()} {
+		testLeafPartitionedRewind(t, directory)
+	}
+}
+
+// testLeafPartitionedRewind rewinds a partitioned leaf which store is kept in memory, or persisted to directory when set.
+func testLeafPartitionedRewind(t *testing.T, directory string) {
+	leaf := newTestLeaf(t, store.Options{Partitioned: true}, directory)
+	input := make(chan Message)
+	leaf.Start(&input)
+
+	for partition := int32(0); partition < 3; partition++ {
+		input <- newMessage(partition, 0, 4)
+	}
+
+	// the records sent to the pipelines before the rewind are put before the store is reset.
+	rewound := make(chan Message)
+	if err := leaf.Rewind(&rewound); err != nil {
+		t.Fatal(err)
+	}
+
+	if put := leaf.Counters().Put; put != 12 {
+		t.Errorf("expected the 12 records sent before the rewind to be put, got: %d", put)
+	}
+
+	if eventIds := readEventIds(t, leaf); len(eventIds) != 0 {
+		t.Errorf("expected no events once rewound, got: %v", eventIds)
+	}
+
+	rewound <- newMessage(1, 2, 4)
+	rewound <- newMessage(0, 3, 5)
+	waitForPut(t, leaf, 16)
+
+	expected := "[p0-3 p0-4 p1-2 p1-3]"
+	if eventIds := readEventIds(t, leaf); fmt.Sprint(eventIds) != expected {
+		t.Errorf("expected events: %s, got: %v", expected, eventIds)
+	}
+
+	// the old input is no longer read.
+	select {
+	case input <- newMessage(2, 4, 5):
+		t.Errorf("expected the input replaced by the rewind not to be read")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func newTestLeaf(t *testing.T, options store.Options, directory string) *Leaf {
+	schema, err := common.FromYaml("../testdata/yaml/nested_schema.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := NewLeaf("events", *schema, store.Json, options, directory, BadRecordPolicy{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup((*leaf.Store).Close)
+	return leaf
+}
+
+// newMessage returns the message of the records of partition from offset from to offset to, exclusive.
+func newMessage(partition int32, from int64, to int64) Message {
+	message := Message{Partition: partition}
+	for offset := from; offset < to; offset++ {
+		value := fmt.Sprintf(`{"eventId":"p%d-%d","tags":[],"location":null,"stops":[]}`, partition, offset)
+		message.Records = append(message.Records, &kgo.Record{Partition: partition, Offset: offset, Timestamp: time.UnixMilli(offset), Value: []byte(value)})
+	}
+
+	return message
+}
+
+// waitForPut waits for the leaf to have put count records.
+func waitForPut(t *testing.T, leaf *Leaf, count int64) {
+	deadline := time.Now().Add(5 * time.Second)
+	for leaf.Counters().Put < count {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d records to be put, got: %d", count, leaf.Counters().Put)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func readEventIds(t *testing.T, leaf *Leaf) []string {
+	iterator, err := (*leaf.Store).Iterator(store.Scan{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer (*iterator).Close()
+
+	var eventIds []string
+	for (*iterator).Next() {
+		batch := *(*iterator).Value()
+		for row := 0; row < int(batch.NumRows()); row++ {
+			eventIds = append(eventIds, batch.Column(0).ValueStr(row))
+		}
+	}
+
+	return eventIds
+}
@@ -2,74 +2,492 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"github.com/twmb/franz-go/pkg/kerr"
 	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// CommitInterval is the period at which a tailer consuming its topic in a consumer group commits the offsets its
+// listener durably applied, on top of the commits made as partitions are revoked.
+var CommitInterval = 5 * time.Second
+
+// RetryBackoff is the delay a tailer waits for after retriable fetch errors before polling again, doubled after each
+// consecutive failed poll up to MaxRetryBackoff.
+var RetryBackoff = 100 * time.Millisecond
+var MaxRetryBackoff = 30 * time.Second
+
+// ChannelCapacity is the number of messages the channel of a tailer buffers. The tailer stops polling its topic while
+// the channel is full, until its leaf catches up, which bounds the records fetched ahead of the leaf.
+var ChannelCapacity = 16
+
+// Message is either the batch of records of a partition of the topic of a tailer fetched by a poll, in offset order, or
+// the errors it met polling it, after which it stopped when Fatal is set and retries otherwise.
 type Message struct {
-	Errors []error
-	Record *kgo.Record
+	Errors    []error
+	Fatal     bool
+	Partition int32
+	Records   []*kgo.Record
+}
+
+type Position string
+
+const (
+	// Earliest starts reading each partition from its first offset.
+	Earliest Position = "earliest"
+	// Latest starts reading each partition from the offset following its last one.
+	Latest Position = "latest"
+	// Timestamp starts reading each partition from its first record put at or after a timestamp.
+	Timestamp Position = "timestamp"
+	// Offsets starts reading each partition from an explicit offset, the other partitions from their first offset.
+	Offsets Position = "offsets"
+)
+
+// Start is the position a tailer starts reading the partitions of its topic from when it does not resume them, its zero
+// value starts from the earliest offsets.
+type Start struct {
+	Position  Position        `yaml:"position" json:"position"`
+	Timestamp time.Time       `yaml:"timestamp" json:"timestamp"`
+	Offsets   map[int32]int64 `yaml:"offsets" json:"offsets"`
+}
+
+// Validate checks that start is a position a tailer can start reading from.
+func (start Start) Validate() error {
+	switch start.Position {
+	case "", Earliest, Latest:
+	case Timestamp:
+		if start.Timestamp.IsZero() {
+			return errors.New(fmt.Sprintf("position: '%s' requires a timestamp", start.Position))
+		}
+	case Offsets:
+		for partition, offset := range start.Offsets {
+			if offset < 0 {
+				return errors.New(fmt.Sprintf("offset: %d of partition: %d can't be negative", offset, partition))
+			}
+		}
+	default:
+		return errors.New(fmt.Sprintf("unsupported position: '%s', expecting '%s', '%s', '%s' or '%s'", start.Position, Earliest, Latest, Timestamp, Offsets))
+	}
+
+	return nil
+}
+
+// offset returns the offset partition starts being read from.
+func (start Start) offset(partition int32) kgo.Offset {
+	switch start.Position {
+	case Latest:
+		return kgo.NewOffset().AtEnd()
+	case Timestamp:
+		return kgo.NewOffset().AfterMilli(start.Timestamp.UnixMilli())
+	case Offsets:
+		if offset, ok := start.Offsets[partition]; ok {
+			return kgo.NewOffset().At(offset)
+		}
+	}
+
+	return kgo.NewOffset().AtStart()
+}
+
+// PartitionListener is notified of the partitions of its topic assigned to, and revoked from, a tailer consuming it in
+// a consumer group.
+type PartitionListener interface {
+	// Assigned is called with the partitions assigned to the tailer, before their records are consumed.
+	Assigned(partitions []int32)
+	// Revoked is called with the partitions revoked from, or lost by, the tailer.
+	Revoked(partitions []int32)
+	// Offsets returns the last offset of each partition which records were durably applied, the tailer commits them
+	// and resumes after them.
+	Offsets() map[int32]int64
 }
 
 type Tailer struct {
-	Id        string
-	Topic     string
-	Channel   *chan Message
-	IsRunning bool
-	context   context.Context
-	client    *kgo.Client
+	Id      string
+	Topic   string
+	Group   string
+	Channel *chan Message
+	// running is read by the goroutine polling the topic while Stop may clear it.
+	running  atomic.Bool
+	context  context.Context
+	client   *kgo.Client
+	start    Start
+	listener PartitionListener
+	done     chan struct{}
+	// mutex guards assigned, the partitions assigned to the tailer, and committed, the last offset committed of each of
+	// them.
+	mutex     sync.Mutex
+	assigned  map[int32]bool
+	committed map[int32]int64
 }
 
-func NewTailer(id string, brokers []string, topic string) (*Tailer, error) {
+// NewTailer returns a tailer of topic which resumes after offsets, the last offset of each partition which was already
+// consumed, the partitions without offset being consumed from start.
+func NewTailer(id string, brokers []string, topic string, offsets map[int32]int64, start Start) (*Tailer, error) {
+	if err := start.Validate(); err != nil {
+		return nil, err
+	}
+
 	ctx := context.Background()
-	channel := make(chan Message)
+	channel := make(chan Message, ChannelCapacity)
+
+	consume := kgo.ConsumeTopics(topic)
+	if len(offsets) > 0 || start.Position == Offsets {
+		partitions, err := resumePartitions(ctx, id, brokers, topic, offsets, start)
+		if err != nil {
+			return nil, err
+		}
+
+		consume = kgo.ConsumePartitions(map[string]map[int32]kgo.Offset{topic: partitions})
+	}
+
 	client, err := kgo.NewClient(
 		kgo.SeedBrokers(brokers...),
-		kgo.ConsumeTopics(topic),
+		consume,
 		kgo.ClientID(id),
+		kgo.ConsumeResetOffset(start.offset(-1)),
 	)
 
 	if err != nil {
 		return nil, err
 	}
 
+	tailer := Tailer{
+		Id:      id,
+		Topic:   topic,
+		Channel: &channel,
+		context: ctx,
+		client:  client,
+		done:    make(chan struct{}),
+	}
+
+	return &tailer, nil
+}
+
+// NewGroupTailer returns a tailer of topic consuming the partitions assigned to it in the consumer group group. It
+// resumes each partition after the offset committed by the group, or the one durably applied by listener when greater,
+// the other partitions being consumed from start, and only commits the offsets listener durably applied.
+func NewGroupTailer(id string, brokers []string, topic string, group string, start Start, listener PartitionListener) (*Tailer, error) {
+	if err := start.Validate(); err != nil {
+		return nil, err
+	}
+
+	channel := make(chan Message, ChannelCapacity)
 	tailer := Tailer{
 		Id:        id,
 		Topic:     topic,
+		Group:     group,
 		Channel:   &channel,
-		IsRunning: false,
-		context:   ctx,
-		client:    client,
+		context:   context.Background(),
+		start:     start,
+		listener:  listener,
+		done:      make(chan struct{}),
+		assigned:  make(map[int32]bool),
+		committed: make(map[int32]int64),
+	}
+
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(brokers...),
+		kgo.ConsumeTopics(topic),
+		kgo.ClientID(id),
+		kgo.ConsumerGroup(group),
+		kgo.ConsumeResetOffset(start.offset(-1)),
+		kgo.DisableAutoCommit(),
+		kgo.OnOffsetsFetched(tailer.fetched),
+		kgo.AdjustFetchOffsetsFn(tailer.resume),
+		kgo.OnPartitionsAssigned(tailer.onAssigned),
+		kgo.OnPartitionsRevoked(tailer.onRevoked),
+		kgo.OnPartitionsLost(tailer.onLost),
+	)
+
+	if err != nil {
+		return nil, err
 	}
 
+	tailer.client = client
 	return &tailer, nil
 }
 
 func (tailer *Tailer) Start() {
+	tailer.running.Store(true)
 	go tailer.consume()
-	tailer.IsRunning = true
+	if tailer.Group != "" {
+		go tailer.commitPeriodically()
+	}
 }
 
+// Stop closes the client of the tailer, which leaves its consumer group after committing the offsets of its partitions.
+// The records polled which were not received from its channel yet are dropped.
 func (tailer *Tailer) Stop() {
-	tailer.IsRunning = false
+	tailer.running.Store(false)
+	close(tailer.done)
 	tailer.client.Close()
 }
 
+// IsRunning returns whether the tailer was started and not stopped since.
+func (tailer *Tailer) IsRunning() bool {
+	return tailer.running.Load()
+}
+
+// consume sends the records polled to the channel of the tailer, one message per partition fetched. The fetch errors
+// are sent as well, the tailer polls again after a backoff when all of them are retriable and stops otherwise.
 func (tailer *Tailer) consume() {
-	for tailer.IsRunning {
+	backoff := RetryBackoff
+	for tailer.running.Load() {
 		fetches := tailer.client.PollFetches(tailer.context)
+		if fetches.IsClientClosed() {
+			return
+		}
+
 		if errs := fetches.Errors(); len(errs) > 0 {
-			errors := make([]error, len(errs))
+			message := Message{Errors: make([]error, len(errs))}
 			for i, err := range errs {
-				errors[i] = err.Err
+				message.Errors[i] = errors.New(fmt.Sprintf("topic: '%s' partition: %d can't be fetched: %s", err.Topic, err.Partition, err.Err))
+				message.Fatal = message.Fatal || fatal(err.Err)
+			}
+
+			if !tailer.send(message) || message.Fatal {
+				return
+			}
+
+			select {
+			case <-time.After(backoff):
+			case <-tailer.done:
+				return
+			}
+
+			backoff *= 2
+			if backoff > MaxRetryBackoff {
+				backoff = MaxRetryBackoff
+			}
+		} else {
+			backoff = RetryBackoff
+		}
+
+		// the records fetched along with retriable errors are sent as well.
+		for _, fetch := range fetches {
+			for _, topic := range fetch.Topics {
+				for _, partition := range topic.Partitions {
+					if len(partition.Records) == 0 {
+						continue
+					}
+
+					if !tailer.send(Message{Partition: partition.Partition, Records: partition.Records}) {
+						return
+					}
+				}
 			}
+		}
+	}
+}
+
+// fatal returns whether polling again can't recover from err: the errors of the brokers which are not retriable, like the
+// authentication, authorization and configuration ones. The other errors, network ones included, are retriable.
+func fatal(err error) bool {
+	var brokerErr *kerr.Error
+	if errors.As(err, &brokerErr) {
+		return !brokerErr.Retriable
+	}
 
-			*tailer.Channel <- Message{Errors: errors}
+	return false
+}
+
+// send sends message to the channel of the tailer unless it is stopped first, and returns whether it was sent.
+func (tailer *Tailer) send(message Message) bool {
+	select {
+	case *tailer.Channel <- message:
+		return true
+	case <-tailer.done:
+		return false
+	}
+}
+
+func (tailer *Tailer) commitPeriodically() {
+	ticker := time.NewTicker(CommitInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tailer.done:
+			return
+		case <-ticker.C:
+			if err := tailer.commit(tailer.context, nil); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+// commit commits the offsets durably applied by the listener of the partitions assigned to the tailer, or of the ones
+// of partitions when set, which changed since their last commit.
+func (tailer *Tailer) commit(ctx context.Context, partitions []int32) error {
+	tailer.mutex.Lock()
+	if partitions == nil {
+		for partition := range tailer.assigned {
+			partitions = append(partitions, partition)
+		}
+	}
+
+	durable := tailer.listener.Offsets()
+	offsets := make(map[int32]kgo.EpochOffset)
+	for _, partition := range partitions {
+		offset, ok := durable[partition]
+		if committed, isCommitted := tailer.committed[partition]; ok && (!isCommitted || offset > committed) {
+			offsets[partition] = kgo.EpochOffset{Epoch: -1, Offset: offset + 1}
+		}
+	}
+
+	tailer.mutex.Unlock()
+	if len(offsets) == 0 {
+		return nil
+	}
+
+	var commitErr error
+	tailer.client.CommitOffsetsSync(ctx, map[string]map[int32]kgo.EpochOffset{tailer.Topic: offsets}, func(_ *kgo.Client, _ *kmsg.OffsetCommitRequest, response *kmsg.OffsetCommitResponse, err error) {
+		if err != nil {
+			commitErr = err
 			return
 		}
 
-		iter := fetches.RecordIter()
-		for !iter.Done() {
-			*tailer.Channel <- Message{Record: iter.Next()}
+		tailer.mutex.Lock()
+		defer tailer.mutex.Unlock()
+		for _, topic := range response.Topics {
+			for _, partition := range topic.Partitions {
+				if err := kerr.ErrorForCode(partition.ErrorCode); err != nil {
+					commitErr = err
+					continue
+				}
+
+				tailer.committed[partition.Partition] = offsets[partition.Partition].Offset - 1
+			}
+		}
+	})
+
+	if commitErr != nil {
+		return errors.New(fmt.Sprintf("offsets of topic: '%s' can't be committed to group: '%s': %s", tailer.Topic, tailer.Group, commitErr))
+	}
+
+	return nil
+}
+
+// fetched records the offsets committed by the group of the partitions assigned to the tailer, before they are
+// adjusted by resume.
+func (tailer *Tailer) fetched(_ context.Context, _ *kgo.Client, response *kmsg.OffsetFetchResponse) error {
+	tailer.mutex.Lock()
+	defer tailer.mutex.Unlock()
+
+	for _, topic := range response.Topics {
+		if topic.Topic != tailer.Topic {
+			continue
+		}
+
+		for _, partition := range topic.Partitions {
+			delete(tailer.committed, partition.Partition)
+			if partition.Offset >= 0 {
+				tailer.committed[partition.Partition] = partition.Offset - 1
+			}
 		}
 	}
+
+	return nil
+}
+
+// resume consumes the partitions which records the listener durably applied after the ones committed by the group from
+// the offset following them, the listener keeping them when the process stopped before they were committed. The
+// partitions without either offset are consumed from the start of the tailer.
+func (tailer *Tailer) resume(_ context.Context, offsets map[string]map[int32]kgo.Offset) (map[string]map[int32]kgo.Offset, error) {
+	tailer.mutex.Lock()
+	defer tailer.mutex.Unlock()
+
+	durable := tailer.listener.Offsets()
+	for partition := range offsets[tailer.Topic] {
+		offset, ok := durable[partition]
+		committed, isCommitted := tailer.committed[partition]
+		if ok && (!isCommitted || offset > committed) {
+			offsets[tailer.Topic][partition] = kgo.NewOffset().At(offset + 1)
+		} else if !ok && !isCommitted {
+			offsets[tailer.Topic][partition] = tailer.start.offset(partition)
+		}
+	}
+
+	return offsets, nil
+}
+
+func (tailer *Tailer) onAssigned(_ context.Context, _ *kgo.Client, assigned map[string][]int32) {
+	partitions := assigned[tailer.Topic]
+	tailer.mutex.Lock()
+	for _, partition := range partitions {
+		tailer.assigned[partition] = true
+	}
+
+	tailer.mutex.Unlock()
+	tailer.listener.Assigned(partitions)
+}
+
+// onRevoked commits the offsets durably applied of the partitions revoked before they are reassigned.
+func (tailer *Tailer) onRevoked(ctx context.Context, _ *kgo.Client, revoked map[string][]int32) {
+	partitions := revoked[tailer.Topic]
+	if err := tailer.commit(ctx, partitions); err != nil {
+		log.Println(err)
+	}
+
+	tailer.unassign(partitions)
+}
+
+// onLost does not commit the offsets of the partitions lost as the tailer is no longer a member of the group.
+func (tailer *Tailer) onLost(_ context.Context, _ *kgo.Client, lost map[string][]int32) {
+	tailer.unassign(lost[tailer.Topic])
+}
+
+func (tailer *Tailer) unassign(partitions []int32) {
+	tailer.mutex.Lock()
+	for _, partition := range partitions {
+		delete(tailer.assigned, partition)
+		delete(tailer.committed, partition)
+	}
+
+	tailer.mutex.Unlock()
+	tailer.listener.Revoked(partitions)
+}
+
+// resumePartitions returns the offset to consume each partition of topic from: the one following its offset in offsets
+// or the one of start. The partitions are looked up as consuming explicit partitions leaves the other ones aside.
+func resumePartitions(ctx context.Context, id string, brokers []string, topic string, offsets map[int32]int64, start Start) (map[int32]kgo.Offset, error) {
+	client, err := kgo.NewClient(kgo.SeedBrokers(brokers...), kgo.ClientID(id))
+	if err != nil {
+		return nil, err
+	}
+
+	defer client.Close()
+
+	request := kmsg.NewPtrMetadataRequest()
+	requestTopic := kmsg.NewMetadataRequestTopic()
+	requestTopic.Topic = kmsg.StringPtr(topic)
+	request.Topics = append(request.Topics, requestTopic)
+
+	response, err := request.RequestWith(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(response.Topics) != 1 {
+		return nil, errors.New(fmt.Sprintf("topic: '%s' metadata can't be found", topic))
+	}
+
+	if err := kerr.ErrorForCode(response.Topics[0].ErrorCode); err != nil {
+		return nil, errors.New(fmt.Sprintf("topic: '%s' metadata can't be loaded: %s", topic, err))
+	}
+
+	partitions := make(map[int32]kgo.Offset)
+	for _, partition := range response.Topics[0].Partitions {
+		partitions[partition.Partition] = start.offset(partition.Partition)
+		if offset, ok := offsets[partition.Partition]; ok {
+			partitions[partition.Partition] = kgo.NewOffset().At(offset + 1)
+		}
+	}
+
+	return partitions, nil
 }
@@ -0,0 +1,929 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/exsql-io/go-datastore/services"
+	"github.com/exsql-io/go-datastore/store"
+	"github.com/substrait-io/substrait-go/expr"
+	"github.com/substrait-io/substrait-go/extensions"
+	"github.com/substrait-io/substrait-go/plan"
+	"github.com/substrait-io/substrait-go/proto"
+	"github.com/substrait-io/substrait-go/types"
+	"strconv"
+	"strings"
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+const (
+	aggregateGenericFunctionsURI = "https://github.com/substrait-io/substrait/blob/main/extensions/functions_aggregate_generic.yaml"
+	arithmeticFunctionsURI       = "https://github.com/substrait-io/substrait/blob/main/extensions/functions_arithmetic.yaml"
+	booleanFunctionsURI          = "https://github.com/substrait-io/substrait/blob/main/extensions/functions_boolean.yaml"
+	comparisonFunctionsURI       = "https://github.com/substrait-io/substrait/blob/main/extensions/functions_comparison.yaml"
+	datetimeFunctionsURI         = "https://github.com/substrait-io/substrait/blob/main/extensions/functions_datetime.yaml"
+	logicalTypesFunctionsURI     = "https://github.com/exsql-io/go-datastore/blob/main/extensions/functions_logical_types.yaml"
+	stringFunctionsURI           = "https://github.com/substrait-io/substrait/blob/main/extensions/functions_string.yaml"
+)
+
+// logicalTypesFunctions declares the functions over the logical types which the substrait extensions lack.
+//
+//go:embed extensions/functions_logical_types.yaml
+var logicalTypesFunctions []byte
+
+func init() {
+	err := extensions.DefaultCollection.Load(logicalTypesFunctionsURI, bytes.NewReader(logicalTypesFunctions))
+	if err != nil {
+		panic(err)
+	}
+}
+
+// arithmeticFunctions maps the sql arithmetic operators to their substrait function.
+var arithmeticFunctions = map[sqlparser.BinaryExprOperator]string{
+	sqlparser.PlusOp:  "add",
+	sqlparser.MinusOp: "subtract",
+	sqlparser.MultOp:  "multiply",
+	sqlparser.DivOp:   "divide",
+}
+
+// comparisonFunctions maps the sql comparison operators to their substrait function.
+var comparisonFunctions = map[sqlparser.ComparisonExprOperator]string{
+	sqlparser.EqualOp:         "equal",
+	sqlparser.NotEqualOp:      "not_equal",
+	sqlparser.LessThanOp:      "lt",
+	sqlparser.LessEqualOp:     "lte",
+	sqlparser.GreaterThanOp:   "gt",
+	sqlparser.GreaterEqualOp:  "gte",
+	sqlparser.NullSafeEqualOp: "is_not_distinct_from",
+}
+
+// scope is a relation being built along with the names of its output columns, sql expressions are resolved against
+// it. The arrow types of the columns are known until the relation is aggregated, they are needed to resolve the fields
+// nested in the columns by name. Once the relation has been aggregated, aggregated maps the grouping keys and
+// aggregate functions to the output column holding them and plain columns can no longer be referenced.
+type scope struct {
+	rel        plan.Rel
+	names      []string
+	dataTypes  []arrow.DataType
+	qualifiers []string
+	aggregated map[string]int32
+}
+
+// planFromSql parses and analyses a query before translating it into a substrait plan. Errors caused by the query
+// itself, such as references to unknown tables or columns, are reported as *SqlError.
+func planFromSql(leafs map[string]*services.Leaf, sql string) (*plan.Plan, error) {
+	rewritten, rewrites, err := rewritePaths(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := buildPlan(leafs, rewritten)
+
+	var sqlError *SqlError
+	if errors.As(err, &sqlError) && sqlError.Position > 0 {
+		sqlError.Position = originalPosition(rewrites, sqlError.Position)
+	}
+
+	return p, err
+}
+
+func buildPlan(leafs map[string]*services.Leaf, sql string) (*plan.Plan, error) {
+	statement, err := sqlparser.ParseStrictDDL(sql)
+	if err != nil {
+		return nil, toSyntaxError(err)
+	}
+
+	stm, ok := statement.(*sqlparser.Select)
+	if !ok {
+		return nil, newSqlError(NotImplemented, nil, "only SELECT statements are supported")
+	}
+
+	p, err := buildSelectPlan(leafs, stm)
+
+	var sqlError *SqlError
+	if errors.As(err, &sqlError) {
+		sqlError.locate(sql, stm)
+	}
+
+	return p, err
+}
+
+// buildSelectPlan translates stm into a substrait plan, the errors it reports are located by their node.
+func buildSelectPlan(leafs map[string]*services.Leaf, stm *sqlparser.Select) (*plan.Plan, error) {
+	if err := checkClauses(stm); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if stm.Distinct {
+		stm.GroupBy, err = toDistinctGroupBy(stm)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	builder := plan.NewBuilderDefault()
+	input, err := buildScan(leafs, builder, stm.From)
+	if err != nil {
+		return nil, err
+	}
+
+	if stm.Where != nil {
+		input, err = buildFilter(builder, input, stm.Where.Expr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(stm.GroupBy) > 0 || stm.Having != nil || sqlparser.ContainsAggregation(stm.SelectExprs) || sqlparser.ContainsAggregation(stm.OrderBy) {
+		input, err = buildAggregate(builder, input, stm)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buildSelect(builder, input, stm)
+}
+
+// checkClauses rejects the clauses of stm that are parsed but not planned, rather than silently ignoring them.
+func checkClauses(stm *sqlparser.Select) error {
+	switch {
+	case stm.With != nil:
+		return newSqlError(NotImplemented, stm.With, "WITH clause: common table expressions are not supported")
+	case len(stm.Windows) > 0:
+		return newSqlError(NotImplemented, nil, "WINDOW clause: window functions are not supported")
+	case stm.Into != nil:
+		return newSqlError(NotImplemented, stm.Into, "INTO clause: '%s' is not supported", strings.TrimSpace(sqlparser.String(stm.Into)))
+	case stm.Lock != sqlparser.NoLock:
+		return newSqlError(NotImplemented, nil, "locking clause: '%s' is not supported", strings.TrimSpace(stm.Lock.ToString()))
+	}
+
+	return nil
+}
+
+// toDistinctGroupBy plans SELECT DISTINCT as a grouping by every expression of the select list. The rows of an
+// aggregation would have to be grouped a second time, which is not supported.
+func toDistinctGroupBy(stm *sqlparser.Select) (sqlparser.GroupBy, error) {
+	if len(stm.GroupBy) > 0 || stm.Having != nil || sqlparser.ContainsAggregation(stm.SelectExprs) {
+		return nil, newSqlError(NotImplemented, stm.SelectExprs, "SELECT DISTINCT: distinct rows of an aggregation are not supported")
+	}
+
+	groupBy := make(sqlparser.GroupBy, 0, len(stm.SelectExprs))
+	for _, selectExpr := range stm.SelectExprs {
+		aliased, ok := selectExpr.(*sqlparser.AliasedExpr)
+		if !ok {
+			return nil, newSqlError(NotImplemented, nil, "SELECT DISTINCT: '%s' is not supported, the selected expressions must be listed", sqlparser.String(selectExpr))
+		}
+
+		groupBy = append(groupBy, aliased.Expr)
+	}
+
+	return groupBy, nil
+}
+
+// buildScan resolves the FROM clause against the leafs, only a single table is supported.
+func buildScan(leafs map[string]*services.Leaf, builder plan.Builder, from sqlparser.TableExprs) (*scope, error) {
+	if len(from) != 1 {
+		return nil, newSqlError(NotImplemented, from, "selecting from %d tables is not supported, expecting a single one", len(from))
+	}
+
+	aliased, ok := from[0].(*sqlparser.AliasedTableExpr)
+	if !ok {
+		return nil, newSqlError(NotImplemented, from[0], "table expression: '%s' is not supported", sqlparser.String(from[0]))
+	}
+
+	table, ok := aliased.Expr.(sqlparser.TableName)
+	if !ok {
+		return nil, newSqlError(NotImplemented, aliased, "table expression: '%s' is not supported", sqlparser.String(aliased))
+	}
+
+	leaf, ok := leafs[table.Name.String()]
+	if !ok || !table.Qualifier.IsEmpty() {
+		return nil, newSqlError(UnknownTable, table, "table: '%s' does not exist", sqlparser.String(table))
+	}
+
+	qualifiers := []string{table.Name.String()}
+	if !aliased.As.IsEmpty() {
+		qualifiers = []string{aliased.As.String()}
+	}
+
+	var names []string
+	var dataTypes []arrow.DataType
+	for _, field := range (*leaf.Store).Schema().Fields() {
+		names = append(names, field.Name)
+		dataTypes = append(dataTypes, field.Type)
+	}
+
+	scan := builder.NamedScan([]string{leaf.Name}, (*leaf.Store).NamedStruct())
+	return &scope{rel: scan, names: names, dataTypes: dataTypes, qualifiers: qualifiers}, nil
+}
+
+func buildFilter(builder plan.Builder, input *scope, where sqlparser.Expr) (*scope, error) {
+	condition, err := toCondition(builder, input, where)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := builder.Filter(input.rel, condition)
+	if err != nil {
+		return nil, err
+	}
+
+	return &scope{rel: filter, names: input.names, dataTypes: input.dataTypes, qualifiers: input.qualifiers, aggregated: input.aggregated}, nil
+}
+
+// toCondition translates a WHERE or HAVING clause, which must evaluate to a boolean.
+func toCondition(builder plan.Builder, input *scope, sqlExpr sqlparser.Expr) (expr.Expression, error) {
+	condition, err := toExpression(builder, input, sqlExpr)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := condition.GetType().(*types.BooleanType); !ok {
+		return nil, newSqlError(TypeMismatch, sqlExpr, "condition: '%s' is of type: '%s' instead of boolean", sqlparser.String(sqlExpr), condition.GetType())
+	}
+
+	return condition, nil
+}
+
+// buildAggregate groups input by the GROUP BY expressions and computes every aggregate function used by the select
+// list and the HAVING clause, which is then applied as a filter over the aggregated relation.
+func buildAggregate(builder plan.Builder, input *scope, stm *sqlparser.Select) (*scope, error) {
+	aggregated := make(map[string]int32)
+
+	var names []string
+	var groupings []expr.Expression
+	for _, grouping := range stm.GroupBy {
+		key := aggregationKey(input, grouping)
+		if _, ok := aggregated[key]; ok {
+			continue
+		}
+
+		expression, err := toExpression(builder, input, grouping)
+		if err != nil {
+			return nil, err
+		}
+
+		aggregated[key] = int32(len(groupings))
+		names = append(names, key)
+		groupings = append(groupings, expression)
+	}
+
+	nodes := []sqlparser.SQLNode{stm.SelectExprs, stm.OrderBy}
+	if stm.Having != nil {
+		nodes = append(nodes, stm.Having.Expr)
+	}
+
+	var measures []plan.AggRelMeasure
+	err := sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		function, ok := node.(sqlparser.AggrFunc)
+		if !ok {
+			return true, nil
+		}
+
+		key := aggregationKey(input, function)
+		if _, ok := aggregated[key]; ok {
+			return false, nil
+		}
+
+		measure, err := toAggregateFunction(builder, input, function)
+		if err != nil {
+			return false, err
+		}
+
+		aggregated[key] = int32(len(groupings) + len(measures))
+		names = append(names, key)
+		measures = append(measures, builder.Measure(measure, nil))
+
+		return false, nil
+	}, nodes...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var groups [][]expr.Expression
+	if len(groupings) > 0 {
+		groups = append(groups, groupings)
+	}
+
+	aggregate, err := builder.AggregateExprs(input.rel, measures, groups...)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &scope{rel: aggregate, names: names, qualifiers: input.qualifiers, aggregated: aggregated}
+	if stm.Having == nil {
+		return output, nil
+	}
+
+	return buildFilter(builder, output, stm.Having.Expr)
+}
+
+func toAggregateFunction(builder plan.Builder, input *scope, function sqlparser.AggrFunc) (*expr.AggregateFunction, error) {
+	if _, ok := function.(*sqlparser.CountStar); ok {
+		return aggregateFunction(builder, input, function, types.AggInvocationAll, aggregateGenericFunctionsURI, "count:")
+	}
+
+	if len(function.GetArgs()) != 1 {
+		return nil, newSqlError(InvalidQuery, function, "aggregate function: '%s' expects exactly one argument", sqlparser.String(function))
+	}
+
+	argument, err := toExpression(builder, input, function.GetArg())
+	if err != nil {
+		return nil, err
+	}
+
+	invocation := types.AggInvocationAll
+	if function.IsDistinct() {
+		invocation = types.AggInvocationDistinct
+	}
+
+	switch function.(type) {
+	case *sqlparser.Count:
+		return aggregateFunction(builder, input, function, invocation, aggregateGenericFunctionsURI, "count:any", argument)
+	case *sqlparser.Sum:
+		return aggregateFunction(builder, input, function, invocation, arithmeticFunctionsURI, "sum", decimalToFloatingPoint(argument))
+	case *sqlparser.Avg:
+		return aggregateFunction(builder, input, function, invocation, arithmeticFunctionsURI, "avg", decimalToFloatingPoint(argument))
+	case *sqlparser.Min:
+		return minMaxFunction(builder, input, function, invocation, "min", argument)
+	case *sqlparser.Max:
+		return minMaxFunction(builder, input, function, invocation, "max", argument)
+	}
+
+	return nil, newSqlError(NotImplemented, function, "aggregate function: '%s' is not supported", sqlparser.String(function))
+}
+
+// minMaxFunction calls the arithmetic min or max on numbers and their generic declaration on the other types. The
+// builder does not derive the type returned by the generic declaration, which is the type of the argument, the call
+// is thus created using the extension registry of the builder, see variadicFunction.
+func minMaxFunction(builder plan.Builder, input *scope, node sqlparser.Expr, invocation types.AggregationInvocation, name string, argument expr.Expression) (*expr.AggregateFunction, error) {
+	if numericRank(argument.GetType()) > 0 && !isLogicalType(argument.GetType()) {
+		return aggregateFunction(builder, input, node, invocation, arithmeticFunctionsURI, name, argument)
+	}
+
+	variant, ok := extensions.DefaultCollection.GetAggregateFunc(extensions.ID{URI: logicalTypesFunctionsURI, Name: name + ":any"})
+	if !ok {
+		return nil, fmt.Errorf("function: '%s' is not declared", name)
+	}
+
+	p, err := builder.Plan(input.rel, make([]string, len(input.rel.Remap(input.rel.RecordType()).Types)))
+	if err != nil {
+		return nil, err
+	}
+
+	outputType := argument.GetType().WithNullability(types.NullabilityNullable)
+	return expr.NewCustomAggregateFunc(p.ExtensionRegistry(), variant, outputType, nil, invocation, types.AggPhaseInitialToResult, nil, argument)
+}
+
+// aggregationKey identifies a grouping key or an aggregate function, columns are identified by their path without the
+// table qualifier so that qualified and unqualified references match.
+func aggregationKey(input *scope, sqlExpr sqlparser.Expr) string {
+	if column, ok := sqlExpr.(*sqlparser.ColName); ok {
+		return strings.Join(columnPath(input, column), ".")
+	}
+
+	return sqlparser.String(sqlExpr)
+}
+
+// selectItem is an output column of the select list, its expression is evaluated over the input of the projection.
+type selectItem struct {
+	name       string
+	expression expr.Expression
+}
+
+// buildSelect builds the plan of the select list evaluated over input, ordered and bounded by the ORDER BY and LIMIT
+// clauses. The projection emits only the selected expressions, as the builder cannot express such an output mapping
+// it is applied on the protobuf form of the plan, along with the declarations of the type variations of the scanned
+// schema.
+func buildSelect(builder plan.Builder, input *scope, stm *sqlparser.Select) (*plan.Plan, error) {
+	items, err := toSelectItems(builder, input, stm.SelectExprs)
+	if err != nil {
+		return nil, err
+	}
+
+	rel, err := buildOrderBy(builder, input, items, stm.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+
+	rel, err = buildLimit(builder, rel, stm.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(items))
+	expressions := make([]expr.Expression, len(items))
+	for i, item := range items {
+		names[i] = item.name
+		expressions[i] = item.expression
+	}
+
+	project, err := builder.Project(rel, expressions...)
+	if err != nil {
+		return nil, err
+	}
+
+	width := len(input.names)
+	rootNames := append(append([]string{}, input.names...), names...)
+	p, err := builder.Plan(project, rootNames)
+	if err != nil {
+		return nil, err
+	}
+
+	protoPlan, err := p.ToProto()
+	if err != nil {
+		return nil, err
+	}
+
+	root := protoPlan.Relations[0].GetRoot()
+	mapping := make([]int32, len(names))
+	for i := range mapping {
+		mapping[i] = int32(width + i)
+	}
+
+	root.Input.GetProject().Common = &proto.RelCommon{
+		EmitKind: &proto.RelCommon_Emit_{Emit: &proto.RelCommon_Emit{OutputMapping: mapping}},
+	}
+	root.Names = names
+	store.DeclareTypeVariations(protoPlan)
+
+	return plan.FromProto(protoPlan, &extensions.DefaultCollection)
+}
+
+func toSelectItems(builder plan.Builder, input *scope, selectExprs sqlparser.SelectExprs) ([]selectItem, error) {
+	var items []selectItem
+	for _, selectExpr := range selectExprs {
+		switch e := selectExpr.(type) {
+		case *sqlparser.StarExpr:
+			for i, name := range input.names {
+				reference, err := builder.RootFieldRef(input.rel, int32(i))
+				if err != nil {
+					return nil, err
+				}
+
+				items = append(items, selectItem{name: name, expression: reference})
+			}
+		case *sqlparser.AliasedExpr:
+			expression, err := toExpression(builder, input, e.Expr)
+			if err != nil {
+				return nil, err
+			}
+
+			items = append(items, selectItem{name: toColumnName(input, e), expression: expression})
+		default:
+			return nil, newSqlError(NotImplemented, selectExpr, "select expression: '%s' is not supported", sqlparser.String(selectExpr))
+		}
+	}
+
+	return items, nil
+}
+
+// buildOrderBy sorts input by the ORDER BY clause. Its expressions can reference the output columns of the select
+// list by name or by position, they are otherwise resolved against input.
+func buildOrderBy(builder plan.Builder, input *scope, items []selectItem, orderBy sqlparser.OrderBy) (plan.Rel, error) {
+	if len(orderBy) == 0 {
+		return input.rel, nil
+	}
+
+	sorts := make([]expr.SortField, len(orderBy))
+	for i, order := range orderBy {
+		expression, err := toOrderExpression(builder, input, items, order.Expr)
+		if err != nil {
+			return nil, err
+		}
+
+		// nulls are the smallest values, as in mysql.
+		direction := proto.SortField_SORT_DIRECTION_ASC_NULLS_FIRST
+		if order.Direction == sqlparser.DescOrder {
+			direction = proto.SortField_SORT_DIRECTION_DESC_NULLS_LAST
+		}
+
+		sorts[i] = expr.SortField{Expr: expression, Kind: types.SortDirection(direction)}
+	}
+
+	return builder.Sort(input.rel, sorts...)
+}
+
+func toOrderExpression(builder plan.Builder, input *scope, items []selectItem, sqlExpr sqlparser.Expr) (expr.Expression, error) {
+	switch value := sqlExpr.(type) {
+	case *sqlparser.Literal:
+		if value.Type != sqlparser.IntVal {
+			break
+		}
+
+		position, err := strconv.Atoi(value.Val)
+		if err != nil || position < 1 || position > len(items) {
+			return nil, newSqlError(InvalidQuery, value, "ORDER BY position: %s is not in the select list", value.Val)
+		}
+
+		return items[position-1].expression, nil
+	case *sqlparser.ColName:
+		if !value.Qualifier.IsEmpty() {
+			break
+		}
+
+		for _, item := range items {
+			if item.name == value.Name.String() {
+				return item.expression, nil
+			}
+		}
+	}
+
+	return toExpression(builder, input, sqlExpr)
+}
+
+func buildLimit(builder plan.Builder, input plan.Rel, limit *sqlparser.Limit) (plan.Rel, error) {
+	if limit == nil {
+		return input, nil
+	}
+
+	count, err := toCount(limit.Rowcount)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := uint64(0)
+	if limit.Offset != nil {
+		offset, err = toCount(limit.Offset)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return builder.Fetch(input, offset, count)
+}
+
+func toCount(sqlExpr sqlparser.Expr) (uint64, error) {
+	literal, ok := sqlExpr.(*sqlparser.Literal)
+	if !ok || literal.Type != sqlparser.IntVal {
+		return 0, newSqlError(InvalidQuery, sqlExpr, "LIMIT and OFFSET expect an integer literal, got: '%s'", sqlparser.String(sqlExpr))
+	}
+
+	count, err := strconv.ParseUint(literal.Val, 10, 63)
+	if err != nil {
+		return 0, newSqlError(InvalidQuery, sqlExpr, "LIMIT and OFFSET value: '%s' is out of range", literal.Val)
+	}
+
+	return count, nil
+}
+
+// toComparison translates the comparison operators, including the IN and LIKE predicates.
+func toComparison(builder plan.Builder, input *scope, comparison *sqlparser.ComparisonExpr) (expr.Expression, error) {
+	left, err := toExpression(builder, input, comparison.Left)
+	if err != nil {
+		return nil, err
+	}
+
+	switch comparison.Operator {
+	case sqlparser.InOp, sqlparser.NotInOp:
+		values, ok := comparison.Right.(sqlparser.ValTuple)
+		if !ok {
+			return nil, newSqlError(NotImplemented, comparison, "expression: '%s' is not supported, IN expects a list of values", sqlparser.String(comparison))
+		}
+
+		equals := make([]types.FuncArg, len(values))
+		for i, value := range values {
+			right, err := toExpression(builder, input, value)
+			if err != nil {
+				return nil, err
+			}
+
+			equals[i], err = comparisonFunction(builder, comparison, "equal", left, right)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		in, err := variadicFunction(builder, input, comparison, booleanFunctionsURI, "or", equals...)
+		if err != nil || comparison.Operator == sqlparser.InOp {
+			return in, err
+		}
+
+		return scalarFunction(builder, comparison, booleanFunctionsURI, "not", in)
+	case sqlparser.LikeOp, sqlparser.NotLikeOp:
+		if comparison.Escape != nil {
+			return nil, newSqlError(NotImplemented, comparison, "expression: '%s' is not supported, LIKE does not support ESCAPE", sqlparser.String(comparison))
+		}
+
+		pattern, err := toExpression(builder, input, comparison.Right)
+		if err != nil {
+			return nil, err
+		}
+
+		like, err := scalarFunction(builder, comparison, stringFunctionsURI, "like", left, pattern)
+		if err != nil || comparison.Operator == sqlparser.LikeOp {
+			return like, err
+		}
+
+		return scalarFunction(builder, comparison, booleanFunctionsURI, "not", like)
+	}
+
+	name, ok := comparisonFunctions[comparison.Operator]
+	if !ok {
+		return nil, newSqlError(NotImplemented, comparison, "expression: '%s' is not supported", sqlparser.String(comparison))
+	}
+
+	right, err := toExpression(builder, input, comparison.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	return comparisonFunction(builder, comparison, name, left, right)
+}
+
+// toIs translates the IS [NOT] NULL, IS [NOT] TRUE and IS [NOT] FALSE predicates, which never return null.
+func toIs(builder plan.Builder, input *scope, is *sqlparser.IsExpr) (expr.Expression, error) {
+	argument, err := toExpression(builder, input, is.Left)
+	if err != nil {
+		return nil, err
+	}
+
+	switch is.Right {
+	case sqlparser.IsNullOp:
+		return scalarFunction(builder, is, comparisonFunctionsURI, "is_null", argument)
+	case sqlparser.IsNotNullOp:
+		return scalarFunction(builder, is, comparisonFunctionsURI, "is_not_null", argument)
+	}
+
+	value := is.Right == sqlparser.IsTrueOp || is.Right == sqlparser.IsNotTrueOp
+	predicate, err := comparisonFunction(builder, is, "is_not_distinct_from", argument, expr.NewPrimitiveLiteral(value, false))
+	if err != nil || is.Right == sqlparser.IsTrueOp || is.Right == sqlparser.IsFalseOp {
+		return predicate, err
+	}
+
+	return scalarFunction(builder, is, booleanFunctionsURI, "not", predicate)
+}
+
+func toExpression(builder plan.Builder, input *scope, sqlExpr sqlparser.Expr) (expr.Expression, error) {
+	if input.aggregated != nil {
+		if index, ok := input.aggregated[aggregationKey(input, sqlExpr)]; ok {
+			return builder.RootFieldRef(input.rel, index)
+		}
+	}
+
+	switch value := sqlExpr.(type) {
+	case *sqlparser.Literal, sqlparser.BoolVal, *sqlparser.NullVal:
+		return toLiteral(value, false)
+	case sqlparser.AggrFunc:
+		return nil, newSqlError(InvalidQuery, sqlExpr, "aggregate function: '%s' is not allowed here", sqlparser.String(sqlExpr))
+	case *sqlparser.ColName:
+		if input.aggregated != nil {
+			return nil, newSqlError(InvalidQuery, sqlExpr, "column: '%s' must appear in the GROUP BY clause or be used in an aggregate function", sqlparser.String(sqlExpr))
+		}
+
+		return resolveColumn(builder, input, value, nil)
+	case *sqlparser.BinaryExpr:
+		if value.Operator == sqlparser.JSONExtractOp {
+			return toPathExpression(builder, input, value)
+		}
+
+		name, ok := arithmeticFunctions[value.Operator]
+		if !ok {
+			break
+		}
+
+		left, err := toExpression(builder, input, value.Left)
+		if err != nil {
+			return nil, err
+		}
+
+		right, err := toExpression(builder, input, value.Right)
+		if err != nil {
+			return nil, err
+		}
+
+		return scalarFunction(builder, value, arithmeticFunctionsURI, name, decimalToFloatingPoint(left), decimalToFloatingPoint(right))
+	case *sqlparser.ComparisonExpr:
+		return toComparison(builder, input, value)
+	case *sqlparser.ExtractFuncExpr:
+		return toExtract(builder, input, value)
+	case *sqlparser.DateAddExpr:
+		return toIntervalArithmetic(builder, input, value, "add", value.Date, value.Expr, value.Unit)
+	case *sqlparser.DateSubExpr:
+		return toIntervalArithmetic(builder, input, value, "subtract", value.Date, value.Expr, value.Unit)
+	case *sqlparser.CastExpr:
+		return toCast(builder, input, value)
+	case *sqlparser.IsExpr:
+		return toIs(builder, input, value)
+	case *sqlparser.BetweenExpr:
+		arguments := make([]types.FuncArg, 3)
+		for i, argument := range []sqlparser.Expr{value.Left, value.From, value.To} {
+			var err error
+			arguments[i], err = toExpression(builder, input, argument)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		between, err := comparisonFunction(builder, value, "between", arguments...)
+		if err != nil || value.IsBetween {
+			return between, err
+		}
+
+		return scalarFunction(builder, value, booleanFunctionsURI, "not", between)
+	case *sqlparser.AndExpr:
+		return toBooleanFunction(builder, input, value, "and", value.Left, value.Right)
+	case *sqlparser.OrExpr:
+		return toBooleanFunction(builder, input, value, "or", value.Left, value.Right)
+	case *sqlparser.XorExpr:
+		return toBooleanFunction(builder, input, value, "xor", value.Left, value.Right)
+	case *sqlparser.NotExpr:
+		return toBooleanFunction(builder, input, value, "not", value.Expr)
+	case *sqlparser.UnaryExpr:
+		if value.Operator != sqlparser.UMinusOp {
+			break
+		}
+
+		if literal, ok := value.Expr.(*sqlparser.Literal); ok && (literal.Type == sqlparser.IntVal || literal.Type == sqlparser.FloatVal || literal.Type == sqlparser.DecimalVal) {
+			return toLiteral(literal, true)
+		}
+
+		argument, err := toExpression(builder, input, value.Expr)
+		if err != nil {
+			return nil, err
+		}
+
+		return scalarFunction(builder, value, arithmeticFunctionsURI, "negate", argument)
+	}
+
+	return nil, newSqlError(NotImplemented, sqlExpr, "expression: '%s' is not supported", sqlparser.String(sqlExpr))
+}
+
+// toPathExpression translates the json path extraction operator applied to a column (a->'$.b[0]') into a reference to
+// the value nested in the column.
+func toPathExpression(builder plan.Builder, input *scope, extract *sqlparser.BinaryExpr) (expr.Expression, error) {
+	column, path, err := toPath(extract)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.aggregated != nil {
+		return nil, newSqlError(InvalidQuery, extract, "column: '%s' must appear in the GROUP BY clause or be used in an aggregate function", sqlparser.String(column))
+	}
+
+	return resolveColumn(builder, input, column, path)
+}
+
+func toPath(extract *sqlparser.BinaryExpr) (*sqlparser.ColName, []pathSegment, error) {
+	column, ok := extract.Left.(*sqlparser.ColName)
+	if !ok {
+		return nil, nil, newSqlError(NotImplemented, extract, "expression: '%s' is not supported, paths can only be applied to columns", sqlparser.String(extract))
+	}
+
+	literal, ok := extract.Right.(*sqlparser.Literal)
+	if !ok || literal.Type != sqlparser.StrVal {
+		return nil, nil, newSqlError(NotImplemented, extract, "expression: '%s' is not supported, paths must be string literals", sqlparser.String(extract))
+	}
+
+	path, ok := parseJsonPath(literal.Val)
+	if !ok {
+		return nil, nil, newSqlError(InvalidQuery, extract, "path: '%s' is not valid", literal.Val)
+	}
+
+	return column, path, nil
+}
+
+// scalarFunction calls a substrait scalar function, failing to resolve it means that it is not declared for the types
+// of the arguments.
+func scalarFunction(builder plan.Builder, node sqlparser.Expr, uri string, name string, args ...types.FuncArg) (*expr.ScalarFunction, error) {
+	args = coerceArguments(args)
+	function, err := builder.ScalarFn(uri, name, nil, args...)
+	if err != nil {
+		return nil, toTypeMismatch(node, name, args)
+	}
+
+	return function, nil
+}
+
+// aggregateFunction calls an aggregate function over all the values, or over the distinct ones, of its arguments. The
+// builder only invokes functions over all the values, distinct calls are thus created using the extension registry of
+// the builder, see variadicFunction.
+func aggregateFunction(builder plan.Builder, input *scope, node sqlparser.Expr, invocation types.AggregationInvocation, uri string, name string, args ...types.FuncArg) (*expr.AggregateFunction, error) {
+	args = coerceArguments(args)
+	function, err := builder.AggregateFn(uri, name, nil, args...)
+	if err != nil {
+		return nil, toTypeMismatch(node, name, args)
+	}
+
+	if invocation == types.AggInvocationAll {
+		return function, nil
+	}
+
+	p, err := builder.Plan(input.rel, make([]string, len(input.rel.Remap(input.rel.RecordType()).Types)))
+	if err != nil {
+		return nil, err
+	}
+
+	return expr.NewAggregateFunc(p.ExtensionRegistry(), extensions.ID{URI: uri, Name: name}, nil, invocation, types.AggPhaseInitialToResult, nil, args...)
+}
+
+func toTypeMismatch(node sqlparser.Expr, name string, args []types.FuncArg) error {
+	argumentTypes := make([]string, len(args))
+	for i, arg := range args {
+		argumentTypes[i] = arg.(expr.Expression).GetType().String()
+	}
+
+	function, _, _ := strings.Cut(name, ":")
+	return newSqlError(TypeMismatch, node, "'%s' cannot be evaluated, function: '%s' does not accept arguments of type: (%s)", sqlparser.String(node), function, strings.Join(argumentTypes, ", "))
+}
+
+// comparisonFunction calls a function comparing its arguments, which must all be of the same type.
+func comparisonFunction(builder plan.Builder, node sqlparser.Expr, name string, args ...types.FuncArg) (*expr.ScalarFunction, error) {
+	args = coerceArguments(args)
+	first := args[0].(expr.Expression).GetType().WithNullability(types.NullabilityRequired)
+	for _, arg := range args[1:] {
+		if !first.Equals(arg.(expr.Expression).GetType().WithNullability(types.NullabilityRequired)) {
+			return nil, toTypeMismatch(node, name, args)
+		}
+	}
+
+	return scalarFunction(builder, node, comparisonFunctionsURI, name, args...)
+}
+
+func toBooleanFunction(builder plan.Builder, input *scope, node sqlparser.Expr, name string, sqlExprs ...sqlparser.Expr) (expr.Expression, error) {
+	arguments := make([]types.FuncArg, len(sqlExprs))
+	for i, sqlExpr := range sqlExprs {
+		var err error
+		arguments[i], err = toExpression(builder, input, sqlExpr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if name == "and" || name == "or" {
+		return variadicFunction(builder, input, node, booleanFunctionsURI, name, arguments...)
+	}
+
+	return scalarFunction(builder, node, booleanFunctionsURI, name, arguments...)
+}
+
+// variadicFunction calls a variadic substrait function. The builder only resolves functions called with their
+// declared number of arguments, the declaration is thus resolved against the first argument and the call is then
+// created with every argument using the extension registry of the builder, so that they share function anchors.
+func variadicFunction(builder plan.Builder, input *scope, node sqlparser.Expr, uri string, name string, args ...types.FuncArg) (*expr.ScalarFunction, error) {
+	args = coerceArguments(args)
+	first, err := scalarFunction(builder, node, uri, name, args[0])
+	if err != nil || len(args) == 1 {
+		return first, err
+	}
+
+	p, err := builder.Plan(input.rel, make([]string, len(input.rel.Remap(input.rel.RecordType()).Types)))
+	if err != nil {
+		return nil, err
+	}
+
+	registry := p.ExtensionRegistry()
+	variant, ok := registry.LookupScalarFunction(first.FuncRef())
+	if !ok {
+		return nil, fmt.Errorf("function: '%s' is not declared", name)
+	}
+
+	nullability := types.NullabilityRequired
+	for _, arg := range args {
+		if arg.(expr.Expression).GetType().GetNullability() != types.NullabilityRequired {
+			nullability = types.NullabilityNullable
+		}
+	}
+
+	return expr.NewCustomScalarFunc(registry, variant, first.GetType().WithNullability(nullability), nil, args...)
+}
+
+// toColumnName returns the name of the output column of a select expression: its alias when given, the name of the
+// column when it is a plain column reference, the path of the value when it is nested in a column or the sql text of
+// the expression otherwise.
+func toColumnName(input *scope, selectExpr *sqlparser.AliasedExpr) string {
+	if !selectExpr.As.IsEmpty() {
+		return selectExpr.As.String()
+	}
+
+	switch e := selectExpr.Expr.(type) {
+	case *sqlparser.ColName:
+		return e.Name.String()
+	case *sqlparser.BinaryExpr:
+		if e.Operator != sqlparser.JSONExtractOp {
+			break
+		}
+
+		if column, path, err := toPath(e); err == nil {
+			return pathName(input, column, path)
+		}
+	}
+
+	// paths nested in the expression are named as they were written rather than as json path extractions.
+	named := sqlparser.Rewrite(sqlparser.CloneExpr(selectExpr.Expr), func(cursor *sqlparser.Cursor) bool {
+		if extract, ok := cursor.Node().(*sqlparser.BinaryExpr); ok && extract.Operator == sqlparser.JSONExtractOp {
+			if column, path, err := toPath(extract); err == nil {
+				cursor.Replace(sqlparser.NewColName(pathName(input, column, path)))
+				return false
+			}
+		}
+
+		return true
+	}, nil)
+
+	return sqlparser.String(named)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+type SqlErrorKind string
+
+const (
+	SyntaxError    SqlErrorKind = "syntax_error"
+	UnknownTable   SqlErrorKind = "unknown_table"
+	UnknownColumn  SqlErrorKind = "unknown_column"
+	TypeMismatch   SqlErrorKind = "type_mismatch"
+	InvalidQuery   SqlErrorKind = "invalid_query"
+	NotImplemented SqlErrorKind = "not_implemented"
+)
+
+// SqlError is an error caused by the query itself rather than by its execution. Position is the 1-based offset in the
+// query of the token the error relates to, or 0 when it cannot be located.
+type SqlError struct {
+	Kind     SqlErrorKind `json:"kind"`
+	Message  string       `json:"message"`
+	Position int          `json:"position,omitempty"`
+	node     sqlparser.SQLNode
+}
+
+func (err *SqlError) Error() string {
+	if err.Position > 0 {
+		return fmt.Sprintf("%s at position %d", err.Message, err.Position)
+	}
+
+	return err.Message
+}
+
+func newSqlError(kind SqlErrorKind, node sqlparser.SQLNode, format string, args ...any) *SqlError {
+	return &SqlError{Kind: kind, Message: fmt.Sprintf(format, args...), node: node}
+}
+
+func toSyntaxError(err error) *SqlError {
+	var positioned sqlparser.PositionedErr
+	if errors.As(err, &positioned) {
+		message := positioned.Err
+		if positioned.Near != "" {
+			message = fmt.Sprintf("%s near '%s'", positioned.Err, positioned.Near)
+		}
+
+		return &SqlError{Kind: SyntaxError, Message: message, Position: positioned.Pos}
+	}
+
+	return &SqlError{Kind: SyntaxError, Message: err.Error()}
+}
+
+// locate sets the position of the error to the place in sql of its node. The node is searched from the keyword of the
+// clause of stm holding it, by its whole sequence of tokens first and by the token it starts with otherwise.
+func (err *SqlError) locate(sql string, stm *sqlparser.Select) {
+	if err.Position > 0 || err.node == nil {
+		return
+	}
+
+	tokens := tokenize(sql)
+	tokens = tokens[clauseStart(tokens, stm, err.node):]
+	if index := indexTokens(tokens, tokenize(sqlparser.String(err.node))); index >= 0 {
+		err.Position = tokens[index].start + 1
+		return
+	}
+
+	text, ok := firstToken(err.node)
+	if !ok {
+		return
+	}
+
+	for _, token := range tokens {
+		if strings.EqualFold(token.value, text) {
+			err.Position = token.start + 1
+			return
+		}
+	}
+}
+
+// clauseStart returns the index in tokens of the keyword of the clause of stm holding node, or 0 when no clause holds
+// it.
+func clauseStart(tokens []sqlToken, stm *sqlparser.Select, node sqlparser.SQLNode) int {
+	clauses := []struct {
+		keyword int
+		node    sqlparser.SQLNode
+	}{
+		{sqlparser.FROM, sqlparser.TableExprs(stm.From)},
+		{sqlparser.WHERE, stm.Where},
+		{sqlparser.GROUP, stm.GroupBy},
+		{sqlparser.HAVING, stm.Having},
+		{sqlparser.ORDER, stm.OrderBy},
+		{sqlparser.LIMIT, stm.Limit},
+	}
+
+	for _, clause := range clauses {
+		if !holds(clause.node, node) {
+			continue
+		}
+
+		for index, token := range tokens {
+			if token.kind == clause.keyword {
+				return index
+			}
+		}
+	}
+
+	return 0
+}
+
+// holds tells whether node is part of the tree under root. Nodes which cannot be compared, such as lists, are never
+// found.
+func holds(root sqlparser.SQLNode, node sqlparser.SQLNode) bool {
+	if !reflect.TypeOf(node).Comparable() {
+		return false
+	}
+
+	found := false
+	_ = sqlparser.Walk(func(visited sqlparser.SQLNode) (bool, error) {
+		found = found || visited == node
+		return !found, nil
+	}, root)
+
+	return found
+}
+
+// indexTokens returns the index of the first occurrence of pattern in tokens, or -1 when it does not occur.
+func indexTokens(tokens []sqlToken, pattern []sqlToken) int {
+	if len(pattern) == 0 {
+		return -1
+	}
+
+	for index := 0; index+len(pattern) <= len(tokens); index++ {
+		matches := true
+		for offset, token := range pattern {
+			if tokens[index+offset].kind != token.kind || !strings.EqualFold(tokens[index+offset].value, token.value) {
+				matches = false
+				break
+			}
+		}
+
+		if matches {
+			return index
+		}
+	}
+
+	return -1
+}
+
+// firstToken returns the text of the leftmost identifier or literal of node.
+func firstToken(node sqlparser.SQLNode) (string, bool) {
+	var text string
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if text != "" {
+			return false, nil
+		}
+
+		switch n := node.(type) {
+		case *sqlparser.ColName:
+			text = n.Name.String()
+			if !n.Qualifier.IsEmpty() {
+				text = n.Qualifier.Name.String()
+			}
+		case sqlparser.TableName:
+			text = n.Name.String()
+		case *sqlparser.Literal:
+			text = n.Val
+		case sqlparser.BoolVal:
+			text = sqlparser.String(n)
+		case *sqlparser.NullVal:
+			text = "null"
+		case sqlparser.AggrFunc:
+			text = n.AggrName()
+		}
+
+		return text == "", nil
+	}, node)
+
+	return text, text != ""
+}
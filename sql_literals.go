@@ -0,0 +1,587 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/apache/arrow/go/v13/arrow/decimal128"
+	"github.com/exsql-io/go-datastore/store"
+	"github.com/google/uuid"
+	"github.com/substrait-io/substrait-go/expr"
+	"github.com/substrait-io/substrait-go/plan"
+	"github.com/substrait-io/substrait-go/types"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// timestampLayouts lists the accepted formats of the timestamp literals, those without time zone are in UTC.
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+const timeLayout = "15:04:05.999999999"
+
+// toLiteral translates a sql literal to a substrait literal of its natural type: integers are int32 when they fit and
+// int64 otherwise, decimals and floats are fp64, hexadecimal and bit literals are binary, typed literals (DATE '...',
+// TIME '...' and TIMESTAMP '...') are of their type and NULL is a nullable boolean until it is cast to the type of the
+// expression it is compared to, see coerceArguments.
+func toLiteral(sqlExpr sqlparser.Expr, negative bool) (expr.Literal, error) {
+	switch value := sqlExpr.(type) {
+	case sqlparser.BoolVal:
+		return expr.NewPrimitiveLiteral(bool(value), false), nil
+	case *sqlparser.NullVal:
+		return &expr.NullLiteral{Type: &types.BooleanType{Nullability: types.NullabilityNullable}}, nil
+	case *sqlparser.Literal:
+		text := value.Val
+		if negative {
+			text = "-" + text
+		}
+
+		switch value.Type {
+		case sqlparser.StrVal:
+			return expr.NewPrimitiveLiteral(value.Val, false), nil
+		case sqlparser.IntVal:
+			i, err := strconv.ParseInt(text, 10, 64)
+			if err != nil {
+				return nil, newSqlError(InvalidQuery, value, "integer: '%s' is out of range", text)
+			}
+
+			if i >= math.MinInt32 && i <= math.MaxInt32 {
+				return expr.NewPrimitiveLiteral(int32(i), false), nil
+			}
+
+			return expr.NewPrimitiveLiteral(i, false), nil
+		case sqlparser.FloatVal, sqlparser.DecimalVal:
+			f, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, newSqlError(InvalidQuery, value, "number: '%s' is out of range", text)
+			}
+
+			return expr.NewPrimitiveLiteral(f, false), nil
+		case sqlparser.HexNum, sqlparser.HexVal, sqlparser.BitVal:
+			bytes, err := toBytes(value)
+			if err != nil {
+				return nil, newSqlError(InvalidQuery, value, "literal: '%s' is not valid", sqlparser.String(value))
+			}
+
+			return expr.NewByteSliceLiteral(bytes, false), nil
+		case sqlparser.DateVal, sqlparser.TimeVal, sqlparser.TimestampVal:
+			target := map[sqlparser.ValType]types.Type{
+				sqlparser.DateVal:      &types.DateType{Nullability: types.NullabilityRequired},
+				sqlparser.TimeVal:      &types.TimeType{Nullability: types.NullabilityRequired},
+				sqlparser.TimestampVal: &types.TimestampType{Nullability: types.NullabilityRequired},
+			}[value.Type]
+
+			literal, ok := castLiteral(expr.NewPrimitiveLiteral(value.Val, false), target)
+			if !ok {
+				return nil, newSqlError(InvalidQuery, value, "%s: '%s' is not valid", target, value.Val)
+			}
+
+			return literal, nil
+		}
+	}
+
+	return nil, newSqlError(NotImplemented, sqlExpr, "literal: '%s' is not supported", sqlparser.String(sqlExpr))
+}
+
+// toCast translates CAST(value AS type), literals are converted while planning when their value can be represented
+// exactly in the type. Uuids, whose values arrow only casts to their bytes, cannot be cast.
+func toCast(builder plan.Builder, input *scope, cast *sqlparser.CastExpr) (expr.Expression, error) {
+	var target types.Type
+	nullability := types.NullabilityRequired
+	switch strings.ToLower(cast.Type.Type) {
+	case "signed", "signed integer", "integer", "bigint":
+		target = &types.Int64Type{Nullability: nullability}
+	case "double", "real", "float":
+		target = &types.Float64Type{Nullability: nullability}
+	case "char", "nchar", "varchar":
+		target = &types.StringType{Nullability: nullability}
+	case "binary":
+		target = &types.BinaryType{Nullability: nullability}
+	case "date":
+		target = &types.DateType{Nullability: nullability}
+	case "time":
+		target = &types.TimeType{Nullability: nullability}
+	case "datetime", "timestamp":
+		target = &types.TimestampType{Nullability: nullability}
+	case "decimal":
+		precision, scale := int32(10), int32(0)
+		if cast.Type.Length != nil {
+			value, err := strconv.ParseInt(cast.Type.Length.Val, 10, 32)
+			if err != nil || value < 1 || value > 38 {
+				return nil, newSqlError(InvalidQuery, cast, "precision: '%s' of type: 'decimal' must be between 1 and 38", cast.Type.Length.Val)
+			}
+
+			precision = int32(value)
+		}
+
+		if cast.Type.Scale != nil {
+			value, err := strconv.ParseInt(cast.Type.Scale.Val, 10, 32)
+			if err != nil || value < 0 || int32(value) > precision {
+				return nil, newSqlError(InvalidQuery, cast, "scale: '%s' of type: 'decimal' must be between 0 and its precision", cast.Type.Scale.Val)
+			}
+
+			scale = int32(value)
+		}
+
+		target = &types.DecimalType{Nullability: nullability, Precision: precision, Scale: scale}
+	default:
+		return nil, newSqlError(NotImplemented, cast, "expression: '%s' is not supported, values cannot be cast to type: '%s'", sqlparser.String(cast), cast.Type.Type)
+	}
+
+	argument, err := toExpression(builder, input, cast.Expr)
+	if err != nil {
+		return nil, err
+	}
+
+	if literal, ok := argument.(expr.Literal); ok {
+		if converted, ok := castLiteral(literal, target); ok {
+			return converted, nil
+		}
+	}
+
+	if _, ok := argument.GetType().(*types.UUIDType); ok {
+		return nil, newSqlError(TypeMismatch, cast, "'%s' cannot be evaluated, values of type: '%s' cannot be cast to type: '%s'", sqlparser.String(cast), argument.GetType(), target)
+	}
+
+	return &expr.Cast{Type: target.WithNullability(argument.GetType().GetNullability()), Input: argument, FailureBehavior: types.BehaviorThrowException}, nil
+}
+
+// toBytes decodes the value of a hexadecimal (0x1F, X'1F') or bit (b'101') literal.
+func toBytes(literal *sqlparser.Literal) ([]byte, error) {
+	switch literal.Type {
+	case sqlparser.HexNum:
+		digits := literal.Val[2:]
+		if len(digits)%2 != 0 {
+			digits = "0" + digits
+		}
+
+		return hex.DecodeString(digits)
+	case sqlparser.HexVal:
+		return hex.DecodeString(literal.Val)
+	}
+
+	bits, ok := new(big.Int).SetString(literal.Val, 2)
+	if !ok {
+		return nil, strconv.ErrSyntax
+	}
+
+	bytes := bits.Bytes()
+	if len(bytes) == 0 {
+		bytes = []byte{0}
+	}
+
+	return bytes, nil
+}
+
+// coerceArguments implicitly casts the arguments of a function to a common type. Arguments of a logical type without
+// substrait equivalent are first cast to their substrait type when the arguments are not all of the same type. Literals
+// take the type of the first argument which is not a literal when their value can be represented exactly in it, except
+// for floating point literals which are never turned into integers, numeric arguments are then widened to the widest
+// numeric type among the arguments.
+func coerceArguments(args []types.FuncArg) []types.FuncArg {
+	coerced := make([]types.FuncArg, len(args))
+	copy(coerced, args)
+
+	for i, arg := range coerced {
+		// arrow cannot build the arrays of the substrait uuid type, uuid literals take the type variation of the uuid
+		// columns instead, see castLiteral.
+		argumentType := arg.(expr.Expression).GetType()
+		if _, ok := argumentType.(*types.UUIDType); ok {
+			continue
+		}
+
+		if isLogicalType(argumentType) && !haveSameType(args) {
+			coerced[i] = &expr.Cast{
+				Type:            substraitType(argumentType),
+				Input:           arg.(expr.Expression),
+				FailureBehavior: types.BehaviorThrowException,
+			}
+		}
+	}
+
+	var target types.Type
+	for _, arg := range coerced {
+		if _, ok := arg.(expr.Literal); !ok {
+			target = arg.(expr.Expression).GetType()
+			break
+		}
+	}
+
+	if target != nil && !isUnsigned(target) {
+		for i, arg := range coerced {
+			literal, ok := arg.(expr.Literal)
+			if !ok || (isFloatingPoint(literal.GetType()) && isInteger(target)) {
+				continue
+			}
+
+			if cast, ok := castLiteral(literal, target); ok {
+				coerced[i] = cast
+			}
+		}
+	}
+
+	rank := 0
+	for _, arg := range coerced {
+		if argumentRank := numericRank(arg.(expr.Expression).GetType()); argumentRank > rank {
+			rank = argumentRank
+		}
+	}
+
+	if rank == 0 {
+		return coerced
+	}
+
+	widest := numericTypes[rank-1]
+	for i, arg := range coerced {
+		argumentType := arg.(expr.Expression).GetType()
+		if numericRank(argumentType) == 0 || argumentType.WithNullability(types.NullabilityRequired).Equals(widest) {
+			continue
+		}
+
+		if literal, ok := arg.(expr.Literal); ok {
+			if cast, ok := castLiteral(literal, widest); ok {
+				coerced[i] = cast
+				continue
+			}
+		}
+
+		coerced[i] = &expr.Cast{
+			Type:            widest.WithNullability(argumentType.GetNullability()),
+			Input:           arg.(expr.Expression),
+			FailureBehavior: types.BehaviorThrowException,
+		}
+	}
+
+	return coerced
+}
+
+func isLogicalType(t types.Type) bool {
+	_, ok := store.LogicalType(t)
+	return ok
+}
+
+func haveSameType(args []types.FuncArg) bool {
+	first := args[0].(expr.Expression).GetType().WithNullability(types.NullabilityRequired)
+	for _, arg := range args[1:] {
+		if !first.Equals(arg.(expr.Expression).GetType().WithNullability(types.NullabilityRequired)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// substraitType returns the substrait type of which the logical type t is a type variation, see store.LogicalType.
+func substraitType(t types.Type) types.Type {
+	nullability := t.GetNullability()
+	switch t.(type) {
+	case *types.Int64Type:
+		return &types.Int64Type{Nullability: nullability}
+	case *types.StringType:
+		return &types.StringType{Nullability: nullability}
+	case *types.TimestampType:
+		return &types.TimestampType{Nullability: nullability}
+	case *types.TimestampTzType:
+		return &types.TimestampTzType{Nullability: nullability}
+	case *types.TimeType:
+		return &types.TimeType{Nullability: nullability}
+	}
+
+	return t
+}
+
+// decimalToFloatingPoint casts a decimal argument of an arithmetic function to fp64, substrait does not declare the
+// arithmetic functions over decimals.
+func decimalToFloatingPoint(argument expr.Expression) expr.Expression {
+	if _, ok := argument.GetType().(*types.DecimalType); !ok {
+		return argument
+	}
+
+	target := &types.Float64Type{Nullability: argument.GetType().GetNullability()}
+	return &expr.Cast{Type: target, Input: argument, FailureBehavior: types.BehaviorThrowException}
+}
+
+// numericTypes lists the signed numeric types from the narrowest to the widest.
+var numericTypes = []types.Type{
+	&types.Int8Type{Nullability: types.NullabilityRequired},
+	&types.Int16Type{Nullability: types.NullabilityRequired},
+	&types.Int32Type{Nullability: types.NullabilityRequired},
+	&types.Int64Type{Nullability: types.NullabilityRequired},
+	&types.Float32Type{Nullability: types.NullabilityRequired},
+	&types.Float64Type{Nullability: types.NullabilityRequired},
+}
+
+// numericRank is the 1-based position in numericTypes of the narrowest type holding every value of t, it is 0 for
+// the types which are not numeric. Unsigned integers rank as the next wider signed integer, except for uint64 which is
+// widened to int64.
+func numericRank(t types.Type) int {
+	rank := 0
+	switch t.(type) {
+	case *types.Int8Type:
+		rank = 1
+	case *types.Int16Type:
+		rank = 2
+	case *types.Int32Type:
+		rank = 3
+	case *types.Int64Type:
+		rank = 4
+	case *types.Float32Type:
+		return 5
+	case *types.Float64Type:
+		return 6
+	}
+
+	if rank > 0 && rank < 4 && isUnsigned(t) {
+		return rank + 1
+	}
+
+	return rank
+}
+
+func isInteger(t types.Type) bool {
+	rank := numericRank(t)
+	return rank > 0 && rank <= 4
+}
+
+func isFloatingPoint(t types.Type) bool {
+	return numericRank(t) > 4
+}
+
+// isUnsigned tells whether t is an unsigned integer, which the stores declare as a type variation of the substrait
+// integer of the same width, see store.ToNamedStruct.
+func isUnsigned(t types.Type) bool {
+	return t.GetTypeVariationReference() != 0 && !isLogicalType(t)
+}
+
+// castLiteral converts literal to a literal of type target, it fails when its value cannot be represented exactly in
+// target.
+func castLiteral(literal expr.Literal, target types.Type) (expr.Literal, bool) {
+	if literal.GetType().WithNullability(types.NullabilityRequired).Equals(target.WithNullability(types.NullabilityRequired)) {
+		return literal, true
+	}
+
+	if _, ok := literal.(*expr.NullLiteral); ok {
+		return &expr.NullLiteral{Type: target.WithNullability(types.NullabilityNullable)}, true
+	}
+
+	value, ok := literalValue(literal)
+	if !ok {
+		return nil, false
+	}
+
+	switch t := target.(type) {
+	case *types.Int8Type:
+		i, ok := toInteger(value, math.MinInt8, math.MaxInt8)
+		return expr.NewPrimitiveLiteral(int8(i), false), ok
+	case *types.Int16Type:
+		i, ok := toInteger(value, math.MinInt16, math.MaxInt16)
+		return expr.NewPrimitiveLiteral(int16(i), false), ok
+	case *types.Int32Type:
+		i, ok := toInteger(value, math.MinInt32, math.MaxInt32)
+		return expr.NewPrimitiveLiteral(int32(i), false), ok
+	case *types.Int64Type:
+		i, ok := toInteger(value, math.MinInt64, math.MaxInt64)
+		return expr.NewPrimitiveLiteral(i, false), ok
+	case *types.Float32Type:
+		f, ok := toFloat(value, 32)
+		return expr.NewPrimitiveLiteral(float32(f), false), ok
+	case *types.Float64Type:
+		f, ok := toFloat(value, 64)
+		return expr.NewPrimitiveLiteral(f, false), ok
+	case *types.StringType:
+		if bytes, ok := value.([]byte); ok && utf8.Valid(bytes) {
+			return expr.NewPrimitiveLiteral(string(bytes), false), true
+		}
+	case *types.BinaryType:
+		if s, ok := value.(string); ok {
+			return expr.NewByteSliceLiteral([]byte(s), false), true
+		}
+	case *types.TimestampType:
+		instant, ok := toTime(value)
+		return expr.NewPrimitiveLiteral(types.Timestamp(instant.UnixMicro()), false), ok && instant.Nanosecond()%1000 == 0
+	case *types.TimestampTzType:
+		instant, ok := toTime(value)
+		return expr.NewPrimitiveLiteral(types.TimestampTz(instant.UnixMicro()), false), ok && instant.Nanosecond()%1000 == 0
+	case *types.DateType:
+		instant, ok := toTime(value)
+		return expr.NewPrimitiveLiteral(types.Date(instant.Unix()/86400), false), ok && instant.Truncate(24*time.Hour).Equal(instant)
+	case *types.TimeType:
+		if s, ok := value.(string); ok {
+			instant, err := time.Parse(timeLayout, s)
+			if err == nil && instant.Nanosecond()%1000 == 0 {
+				midnight := time.Date(instant.Year(), instant.Month(), instant.Day(), 0, 0, 0, 0, time.UTC)
+				return expr.NewPrimitiveLiteral(types.Time(instant.Sub(midnight).Microseconds()), false), true
+			}
+		}
+	case *types.DecimalType:
+		return toDecimal(value, t.Precision, t.Scale)
+	case *types.UUIDType:
+		if s, ok := value.(string); ok {
+			if parsed, err := uuid.Parse(s); err == nil {
+				return &expr.ByteSliceLiteral[types.UUID]{Value: parsed[:], Type: target.WithNullability(types.NullabilityRequired)}, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// literalValue returns the value of a literal built by toLiteral, integers as int64, floats as float64 and timestamps
+// and dates as time.Time.
+func literalValue(literal expr.Literal) (any, bool) {
+	switch l := literal.(type) {
+	case *expr.PrimitiveLiteral[int8]:
+		return int64(l.Value), true
+	case *expr.PrimitiveLiteral[int16]:
+		return int64(l.Value), true
+	case *expr.PrimitiveLiteral[int32]:
+		return int64(l.Value), true
+	case *expr.PrimitiveLiteral[int64]:
+		return l.Value, true
+	case *expr.PrimitiveLiteral[float32]:
+		return float64(l.Value), true
+	case *expr.PrimitiveLiteral[float64]:
+		return l.Value, true
+	case *expr.PrimitiveLiteral[string]:
+		return l.Value, true
+	case *expr.ByteSliceLiteral[[]byte]:
+		return l.Value, true
+	case *expr.PrimitiveLiteral[types.Timestamp]:
+		return time.UnixMicro(int64(l.Value)).UTC(), true
+	case *expr.PrimitiveLiteral[types.TimestampTz]:
+		return time.UnixMicro(int64(l.Value)).UTC(), true
+	case *expr.PrimitiveLiteral[types.Date]:
+		return time.Unix(int64(l.Value)*86400, 0).UTC(), true
+	}
+
+	return nil, false
+}
+
+func toInteger(value any, min int64, max int64) (int64, bool) {
+	var i int64
+	switch v := value.(type) {
+	case int64:
+		i = v
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return 0, false
+		}
+
+		i = int64(v)
+	case string:
+		var err error
+		i, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+	case []byte:
+		if len(v) > 8 {
+			return 0, false
+		}
+
+		var u uint64
+		for _, b := range v {
+			u = u<<8 | uint64(b)
+		}
+
+		if u > math.MaxInt64 {
+			return 0, false
+		}
+
+		i = int64(u)
+	default:
+		return 0, false
+	}
+
+	return i, i >= min && i <= max
+}
+
+func toFloat(value any, bitSize int) (float64, bool) {
+	var f float64
+	switch v := value.(type) {
+	case int64:
+		f = float64(v)
+		if f >= math.MaxInt64 || v != int64(f) {
+			return 0, false
+		}
+	case float64:
+		f = v
+	case string:
+		var err error
+		f, err = strconv.ParseFloat(v, bitSize)
+		if err != nil {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+
+	if bitSize == 32 && float64(float32(f)) != f {
+		return 0, false
+	}
+
+	return f, true
+}
+
+// toTime converts a timestamp or date, or a string in one of the timestampLayouts, to a time in UTC.
+func toTime(value any) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range timestampLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t.UTC(), true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// toDecimal converts an integer, a float or a string to a decimal of the given precision and scale, it fails when the
+// value has more digits than the decimal.
+func toDecimal(value any, precision int32, scale int32) (expr.Literal, bool) {
+	var text string
+	switch v := value.(type) {
+	case int64:
+		text = strconv.FormatInt(v, 10)
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		text = v
+	default:
+		return nil, false
+	}
+
+	rational, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return nil, false
+	}
+
+	rational.Mul(rational, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)))
+	if !rational.IsInt() {
+		return nil, false
+	}
+
+	number := decimal128.FromBigInt(rational.Num())
+	if !number.FitsInPrecision(precision) {
+		return nil, false
+	}
+
+	bytes := make([]byte, 16)
+	binary.LittleEndian.PutUint64(bytes[:8], number.LowBits())
+	binary.LittleEndian.PutUint64(bytes[8:], uint64(number.HighBits()))
+
+	literal, err := expr.NewLiteral(&types.Decimal{Value: bytes, Precision: precision, Scale: scale}, false)
+	return literal, err == nil
+}
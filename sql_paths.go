@@ -0,0 +1,335 @@
+package main
+
+import (
+	"fmt"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/substrait-io/substrait-go/expr"
+	"github.com/substrait-io/substrait-go/plan"
+	"golang.org/x/exp/slices"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// pathSegment is a step into a nested column: the field of a structure when field is set, the element at the 0-based
+// offset element of a list otherwise.
+type pathSegment struct {
+	field   string
+	element int32
+}
+
+// pathRewrite records the span of a path of the query which has been rewritten by rewritePaths, offsets are 0-based.
+type pathRewrite struct {
+	start          int
+	end            int
+	rewrittenStart int
+	rewrittenEnd   int
+}
+
+var simpleJsonKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// rewritePaths rewrites the paths into nested columns which the parser does not accept, subscripts (arr[1]) and more
+// than three identifiers (a.b.c.d), as json path extractions of the column (a.b.c->'$.d', arr->'$[0]'). Subscripts
+// number the elements from 1 while json paths number them from 0.
+func rewritePaths(sql string) (string, []pathRewrite, error) {
+	tokens := tokenize(sql)
+
+	var rewritten strings.Builder
+	var rewrites []pathRewrite
+	last := 0
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i].kind != sqlparser.ID || (i > 0 && tokens[i-1].kind == '.') {
+			continue
+		}
+
+		identifiers := []int{i}
+		j := i + 1
+		for j+1 < len(tokens) && tokens[j].kind == '.' && isIdentifier(tokens[j+1].kind, tokens[j+1].value) {
+			identifiers = append(identifiers, j+1)
+			j += 2
+		}
+
+		columnEnd := identifiers[len(identifiers)-1]
+		if len(identifiers) > 3 {
+			columnEnd = identifiers[2]
+		}
+
+		path := "$"
+		for _, identifier := range identifiers[slices.Index(identifiers, columnEnd)+1:] {
+			path += jsonKey(tokens[identifier].value)
+		}
+
+		for {
+			if j+2 < len(tokens) && tokens[j].kind == '[' && tokens[j+1].kind == sqlparser.INTEGRAL && tokens[j+2].kind == ']' {
+				subscript, err := strconv.ParseInt(tokens[j+1].value, 10, 32)
+				if err != nil || subscript < 1 {
+					return "", nil, &SqlError{Kind: InvalidQuery, Message: fmt.Sprintf("subscript: %s is out of range, elements are numbered from 1", tokens[j+1].value), Position: tokens[j+1].start + 1}
+				}
+
+				path += fmt.Sprintf("[%d]", subscript-1)
+				j += 3
+			} else if path != "$" && j+1 < len(tokens) && tokens[j].kind == '.' && isIdentifier(tokens[j+1].kind, tokens[j+1].value) {
+				path += jsonKey(tokens[j+1].value)
+				j += 2
+			} else {
+				break
+			}
+		}
+
+		if path == "$" {
+			i = j - 1
+			continue
+		}
+
+		rewritten.WriteString(sql[last:tokens[i].start])
+		rewriteStart := rewritten.Len()
+		rewritten.WriteString(sql[tokens[i].start:tokens[columnEnd].end])
+		rewritten.WriteString("->'" + strings.ReplaceAll(path, "'", "''") + "'")
+		rewrites = append(rewrites, pathRewrite{start: tokens[i].start, end: tokens[j-1].end, rewrittenStart: rewriteStart, rewrittenEnd: rewritten.Len()})
+
+		last = tokens[j-1].end
+		i = j - 1
+	}
+
+	if len(rewrites) == 0 {
+		return sql, nil, nil
+	}
+
+	rewritten.WriteString(sql[last:])
+	return rewritten.String(), rewrites, nil
+}
+
+// originalPosition maps a 1-based position of the rewritten query back to the original query, positions inside of a
+// rewritten path are mapped to its start.
+func originalPosition(rewrites []pathRewrite, position int) int {
+	offset := position - 1
+	shift := 0
+	for _, rewrite := range rewrites {
+		if offset < rewrite.rewrittenStart {
+			break
+		}
+
+		if offset < rewrite.rewrittenEnd {
+			return rewrite.start + 1
+		}
+
+		shift = rewrite.end - rewrite.rewrittenEnd
+	}
+
+	return offset + shift + 1
+}
+
+// sqlToken is a token of a query, offsets are 0-based and start excludes the whitespace before the token.
+type sqlToken struct {
+	kind  int
+	value string
+	start int
+	end   int
+}
+
+// tokenize splits sql into tokens, up to the first one the tokenizer rejects. Brackets are kept as tokens of their own.
+func tokenize(sql string) []sqlToken {
+	var tokens []sqlToken
+	tokenizer := sqlparser.NewStringTokenizer(sql)
+	for {
+		position := tokenizer.Pos
+		kind, value := tokenizer.Scan()
+		if kind == sqlparser.LEX_ERROR && (value == "[" || value == "]") {
+			// the tokenizer rejects brackets but keeps on scanning after them.
+			kind = int(value[0])
+		} else if kind == 0 || kind == sqlparser.LEX_ERROR {
+			return tokens
+		}
+
+		start := position + len(sql[position:tokenizer.Pos]) - len(strings.TrimLeftFunc(sql[position:tokenizer.Pos], unicode.IsSpace))
+		tokens = append(tokens, sqlToken{kind: kind, value: value, start: start, end: tokenizer.Pos})
+	}
+}
+
+// isIdentifier tells whether a token following a dot is an identifier, keywords such as name are identifiers there.
+func isIdentifier(kind int, value string) bool {
+	return kind == sqlparser.ID || simpleJsonKey.MatchString(value)
+}
+
+func jsonKey(name string) string {
+	if simpleJsonKey.MatchString(name) {
+		return "." + name
+	}
+
+	return "." + strconv.Quote(name)
+}
+
+// parseJsonPath parses the json paths supported by the -> operator, made of keys ($.a, $."a b") and array offsets
+// ($[0]).
+func parseJsonPath(path string) ([]pathSegment, bool) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, false
+	}
+
+	var segments []pathSegment
+	rest := path[1:]
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, `."`):
+			end := 2
+			for end < len(rest) && rest[end] != '"' {
+				if rest[end] == '\\' {
+					end += 1
+				}
+
+				end += 1
+			}
+
+			if end >= len(rest) {
+				return nil, false
+			}
+
+			key, err := strconv.Unquote(rest[1 : end+1])
+			if err != nil {
+				return nil, false
+			}
+
+			segments = append(segments, pathSegment{field: key})
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "."):
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+
+			if end == 0 {
+				return nil, false
+			}
+
+			segments = append(segments, pathSegment{field: rest[1 : end+1]})
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, false
+			}
+
+			offset, err := strconv.ParseInt(rest[1:end], 10, 32)
+			if err != nil || offset < 0 {
+				return nil, false
+			}
+
+			segments = append(segments, pathSegment{element: int32(offset)})
+			rest = rest[end+1:]
+		default:
+			return nil, false
+		}
+	}
+
+	return segments, true
+}
+
+// columnPath returns the identifiers of column without its qualifier when it names the table, the first of them is
+// the name of a column of input and the others are fields of the structures nested in it.
+func columnPath(input *scope, column *sqlparser.ColName) []string {
+	var identifiers []string
+	if !column.Qualifier.Qualifier.IsEmpty() {
+		identifiers = append(identifiers, column.Qualifier.Qualifier.String())
+	}
+
+	if !column.Qualifier.Name.IsEmpty() {
+		identifiers = append(identifiers, column.Qualifier.Name.String())
+	}
+
+	identifiers = append(identifiers, column.Name.String())
+	if len(identifiers) > 1 && slices.Contains(input.qualifiers, identifiers[0]) {
+		return identifiers[1:]
+	}
+
+	return identifiers
+}
+
+// resolveColumn resolves a reference to a column of input, or to a field nested in it when the column is followed by
+// the segments of a path.
+func resolveColumn(builder plan.Builder, input *scope, column *sqlparser.ColName, path []pathSegment) (expr.Expression, error) {
+	identifiers := columnPath(input, column)
+
+	index := slices.Index(input.names, identifiers[0])
+	if index < 0 {
+		if len(identifiers) > 1 {
+			return nil, newSqlError(UnknownTable, column, "table or column: '%s' of column: '%s' does not exist", identifiers[0], sqlparser.String(column))
+		}
+
+		return nil, newSqlError(UnknownColumn, column, "column: '%s' does not exist", sqlparser.String(column))
+	}
+
+	var fields []pathSegment
+	for _, identifier := range identifiers[1:] {
+		fields = append(fields, pathSegment{field: identifier})
+	}
+
+	path = append(fields, path...)
+
+	if len(path) == 0 {
+		return builder.RootFieldRef(input.rel, int32(index))
+	}
+
+	if input.dataTypes == nil || input.dataTypes[index] == nil {
+		return nil, newSqlError(InvalidQuery, column, "column: '%s' cannot be navigated here", sqlparser.String(column))
+	}
+
+	var segments []expr.ReferenceSegment
+	dataType := input.dataTypes[index]
+	for _, segment := range path {
+		switch t := dataType.(type) {
+		case *arrow.StructType:
+			if segment.field == "" {
+				return nil, newSqlError(TypeMismatch, column, "column: '%s' cannot be indexed, it is a structure", sqlparser.String(column))
+			}
+
+			fieldIndex, ok := t.FieldIdx(segment.field)
+			if !ok {
+				return nil, newSqlError(UnknownColumn, column, "field: '%s' of column: '%s' does not exist", segment.field, sqlparser.String(column))
+			}
+
+			segments = append(segments, &expr.StructFieldRef{Field: int32(fieldIndex)})
+			dataType = t.Field(fieldIndex).Type
+		case arrow.ListLikeType:
+			if segment.field != "" {
+				return nil, newSqlError(TypeMismatch, column, "field: '%s' of column: '%s' cannot be referenced, it is an array", segment.field, sqlparser.String(column))
+			}
+
+			segments = append(segments, &expr.ListElementRef{Offset: segment.element})
+			dataType = t.Elem()
+		default:
+			return nil, newSqlError(TypeMismatch, column, "column: '%s' of type: '%s' has no nested values", sqlparser.String(column), dataType)
+		}
+	}
+
+	reference := &expr.StructFieldRef{Field: int32(index)}
+	var parent expr.ReferenceSegment = reference
+	for _, segment := range segments {
+		switch p := parent.(type) {
+		case *expr.StructFieldRef:
+			p.Child = segment
+		case *expr.ListElementRef:
+			p.Child = segment
+		}
+
+		parent = segment
+	}
+
+	recordType := input.rel.Remap(input.rel.RecordType())
+	return expr.NewRootFieldRef(reference, &recordType)
+}
+
+// pathName names the output column of a path, with its elements numbered from 1 as in subscripts.
+func pathName(input *scope, column *sqlparser.ColName, path []pathSegment) string {
+	name := strings.Join(columnPath(input, column), ".")
+	for _, segment := range path {
+		if segment.field != "" {
+			name += "." + segment.field
+		} else {
+			name += fmt.Sprintf("[%d]", segment.element+1)
+		}
+	}
+
+	return name
+}
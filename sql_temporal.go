@@ -0,0 +1,129 @@
+package main
+
+import (
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/exsql-io/go-datastore/store"
+	"github.com/substrait-io/substrait-go/expr"
+	"github.com/substrait-io/substrait-go/plan"
+	"github.com/substrait-io/substrait-go/types"
+	"math"
+	"time"
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// extractComponents maps the units of EXTRACT to the components of the substrait extract function, WEEK is the ISO
+// week and MICROSECOND the number of microseconds since the last full second.
+var extractComponents = map[sqlparser.IntervalTypes]string{
+	sqlparser.IntervalYear:        "YEAR",
+	sqlparser.IntervalQuarter:     "QUARTER",
+	sqlparser.IntervalMonth:       "MONTH",
+	sqlparser.IntervalWeek:        "ISO_WEEK",
+	sqlparser.IntervalDay:         "DAY",
+	sqlparser.IntervalHour:        "HOUR",
+	sqlparser.IntervalMinute:      "MINUTE",
+	sqlparser.IntervalSecond:      "SECOND",
+	sqlparser.IntervalMicrosecond: "SUBSECOND",
+}
+
+// intervalDurations maps the units of the day-time intervals to their duration.
+var intervalDurations = map[sqlparser.IntervalTypes]time.Duration{
+	sqlparser.IntervalWeek:        7 * 24 * time.Hour,
+	sqlparser.IntervalDay:         24 * time.Hour,
+	sqlparser.IntervalHour:        time.Hour,
+	sqlparser.IntervalMinute:      time.Minute,
+	sqlparser.IntervalSecond:      time.Second,
+	sqlparser.IntervalMicrosecond: time.Microsecond,
+}
+
+// toExtract translates EXTRACT(unit FROM value) of a timestamp, a date or a time. The components of the timestamps with
+// a time zone are extracted in the time zone of their column.
+func toExtract(builder plan.Builder, input *scope, extract *sqlparser.ExtractFuncExpr) (expr.Expression, error) {
+	component, ok := extractComponents[extract.IntervalTypes]
+	if !ok {
+		return nil, newSqlError(NotImplemented, extract, "expression: '%s' is not supported, EXTRACT does not support unit: '%s'", sqlparser.String(extract), extract.IntervalTypes.ToString())
+	}
+
+	argument, err := toExpression(builder, input, extract.Expr)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []types.FuncArg{types.Enum(component), argument}
+	if _, ok := argument.GetType().(*types.TimestampTzType); ok {
+		timezone := "UTC"
+		if dataType, ok := store.LogicalType(argument.GetType()); ok {
+			timezone = dataType.(*arrow.TimestampType).TimeZone
+		}
+
+		args = append(args, expr.NewPrimitiveLiteral(timezone, false))
+	}
+
+	function, err := builder.ScalarFn(datetimeFunctionsURI, "extract", nil, args...)
+	if err != nil {
+		return nil, toTypeMismatch(extract, "extract", args[1:2])
+	}
+
+	return function, nil
+}
+
+// toIntervalArithmetic translates the addition or subtraction of a day-time interval (INTERVAL 2 HOUR) to a timestamp
+// or a date, dates are turned into timestamps.
+func toIntervalArithmetic(builder plan.Builder, input *scope, node sqlparser.Expr, name string, date sqlparser.Expr, amount sqlparser.Expr, unit sqlparser.IntervalTypes) (expr.Expression, error) {
+	duration, ok := intervalDurations[unit]
+	if !ok {
+		return nil, newSqlError(NotImplemented, node, "expression: '%s' is not supported, only intervals of weeks, days, hours, minutes, seconds or microseconds are", sqlparser.String(node))
+	}
+
+	negative := false
+	if minus, ok := amount.(*sqlparser.UnaryExpr); ok && minus.Operator == sqlparser.UMinusOp {
+		negative, amount = true, minus.Expr
+	}
+
+	literal, ok := amount.(*sqlparser.Literal)
+	if !ok || literal.Type != sqlparser.IntVal {
+		return nil, newSqlError(NotImplemented, node, "expression: '%s' is not supported, the amount of an interval must be an integer", sqlparser.String(node))
+	}
+
+	value, err := toLiteral(literal, negative)
+	if err != nil {
+		return nil, err
+	}
+
+	count, _ := literalValue(value)
+	if limit := math.MaxInt64 / duration.Microseconds(); count.(int64) > limit || count.(int64) < -limit {
+		return nil, newSqlError(InvalidQuery, node, "interval: '%s' is out of range", sqlparser.String(amount))
+	}
+
+	microseconds := count.(int64) * duration.Microseconds()
+	days := microseconds / (24 * time.Hour).Microseconds()
+	remainder := microseconds % (24 * time.Hour).Microseconds()
+	interval, err := expr.NewLiteral(&types.IntervalDayToSecond{
+		Days:         int32(days),
+		Seconds:      int32(remainder / time.Second.Microseconds()),
+		Microseconds: int32(remainder % time.Second.Microseconds()),
+	}, false)
+	if err != nil {
+		return nil, err
+	}
+
+	argument, err := toExpression(builder, input, date)
+	if err != nil {
+		return nil, err
+	}
+
+	argumentType := argument.GetType()
+	if _, ok := argumentType.(*types.DateType); ok {
+		argumentType = &types.TimestampType{Nullability: argumentType.GetNullability()}
+	}
+
+	if !argumentType.Equals(argument.GetType()) || isLogicalType(argumentType) {
+		argument = &expr.Cast{Type: substraitType(argumentType), Input: argument, FailureBehavior: types.BehaviorThrowException}
+	}
+
+	function, err := builder.ScalarFn(datetimeFunctionsURI, name, nil, argument, interval)
+	if err != nil {
+		return nil, toTypeMismatch(node, name, []types.FuncArg{argument, interval})
+	}
+
+	return function, nil
+}
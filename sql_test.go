@@ -0,0 +1,725 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/exsql-io/go-datastore/common"
+	"github.com/exsql-io/go-datastore/engine"
+	"github.com/exsql-io/go-datastore/services"
+	"github.com/exsql-io/go-datastore/store"
+	"github.com/goccy/go-json"
+	"github.com/substrait-io/substrait-go/expr"
+	"github.com/substrait-io/substrait-go/extensions"
+	"github.com/substrait-io/substrait-go/plan"
+	"github.com/substrait-io/substrait-go/proto"
+	"github.com/substrait-io/substrait-go/types"
+	"reflect"
+	"testing"
+	"time"
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+func TestPlanFromSqlErrors(t *testing.T) {
+	leafs := testLeafs(t)
+
+	tests := []struct {
+		query    string
+		kind     SqlErrorKind
+		position int
+	}{
+		{"select * frm trips", SyntaxError, 13},
+		{"delete from trips", NotImplemented, 0},
+		{"select * from unknown", UnknownTable, 15},
+		{"select unknown from trips", UnknownColumn, 8},
+		{"select t.vendorId from trips", UnknownTable, 8},
+		{"select * from trips where passengers = 'one'", TypeMismatch, 27},
+		{"select * from trips where vendorId", TypeMismatch, 27},
+		{"select passengers from trips where passengers = 'one'", TypeMismatch, 36},
+		{"select passengers, vendorId from trips where vendorId", TypeMismatch, 46},
+		{"select count(*) from trips group by count(*)", InvalidQuery, 37},
+		{"select vendorId, min(passengers) from trips group by vendorId having min(passengers) = 'one'", TypeMismatch, 70},
+		{"select vendorId from trips group by vendorId order by passengers", InvalidQuery, 55},
+		{"select stops[1].name from events where stops[1].name = 1", TypeMismatch, 40},
+		{"select passengers from trips group by vendorId", InvalidQuery, 8},
+		{"select * from trips where count(*) = 1", InvalidQuery, 27},
+		{"select location.altitude from events", UnknownColumn, 8},
+		{"select location[1] from events", TypeMismatch, 8},
+		{"select tags.name from events", TypeMismatch, 8},
+		{"select tags[0] from events", InvalidQuery, 13},
+		{"select tags[1] frm events", SyntaxError, 26},
+		{"select * from rides where tripId = 'zz'", TypeMismatch, 27},
+		{"select * from rides where pickupDate = date '2023-02-30'", InvalidQuery, 40},
+		{"select cast(tripId as char) from rides", TypeMismatch, 8},
+		{"select extract(year_month from pickupTimestamp) from rides", NotImplemented, 8},
+		{"select pickupTimestamp + interval 1 month from rides", NotImplemented, 8},
+		{"with t as (select * from trips) select * from t", NotImplemented, 1},
+		{"select vendorId from trips window w as (partition by vendorId)", NotImplemented, 0},
+		{"select vendorId from trips into outfile 'trips.csv'", NotImplemented, 28},
+		{"select vendorId from trips for update", NotImplemented, 0},
+		{"select vendorId from trips lock in share mode", NotImplemented, 0},
+		{"select distinct * from trips", NotImplemented, 0},
+		{"select distinct vendorId, count(*) from trips group by vendorId", NotImplemented, 17},
+	}
+
+	for _, test := range tests {
+		_, err := planFromSql(leafs, test.query)
+
+		var sqlError *SqlError
+		if !errors.As(err, &sqlError) {
+			t.Errorf("expected query: '%s' to fail with a sql error, got: %v", test.query, err)
+			continue
+		}
+
+		if sqlError.Kind != test.kind {
+			t.Errorf("expected query: '%s' to fail with: '%s', got: '%s'", test.query, test.kind, sqlError.Kind)
+		}
+
+		if sqlError.Position != test.position {
+			t.Errorf("expected query: '%s' to fail at position: %d, got: %d", test.query, test.position, sqlError.Position)
+		}
+	}
+}
+
+func TestPlanFromSql(t *testing.T) {
+	leafs := testLeafs(t)
+
+	queries := []string{
+		"select * from trips",
+		"select vendorId as vendor, passengers + 1 from trips where passengers > 1 and vendorId like 'v%'",
+		"select trips.vendorId, count(*) from trips group by vendorId having min(passengers) > 1 order by 2 desc limit 10",
+		"select t.passengers from trips as t where t.passengers between 1 and 3 or t.vendorId is null",
+		"select passengers / 2.0, -1, true, null, 0x1F from trips where passengers > 3000000000 or vendorId = X'76' or passengers = null",
+		"select tags[1], location.latitude, e.location.longitude, stops[2].name from events as e where stops[1].durations[1] > 10",
+		"select location.latitude, count(*) from events group by location.latitude order by location.latitude",
+		"select location->'$.latitude', stops->'$[0].durations[1]' from events",
+		"select * from rides where pickupTimestamp > '2023-06-01 00:00:00' and pickupDate = date '2023-06-01' and fareAmount > 10",
+		"select tripId from rides where tripId = '0b0f2a4e-5c1d-4b7a-9a43-7f3e2d1c0b9a' or paymentType in ('cash') or pickupTime < '11:00:00'",
+		"select paymentType, min(fareAmount), max(pickupTimestamp), sum(fareAmount) from rides group by paymentType order by paymentType",
+		"select extract(hour from pickupTimestamp), pickupTimestamp + interval 2 hour, cast(fareAmount as decimal(12, 3)) from rides",
+	}
+
+	for _, query := range queries {
+		p, err := planFromSql(leafs, query)
+		if err != nil {
+			t.Errorf("expected query: '%s' to be planned, got: %v", query, err)
+			continue
+		}
+
+		_, err = convertPlanToVolcanoOperator(leafs, p)
+		if err != nil {
+			t.Errorf("expected plan of query: '%s' to be converted, got: %v", query, err)
+		}
+	}
+}
+
+func TestToLiteral(t *testing.T) {
+	tests := []struct {
+		literal  string
+		expected string
+	}{
+		{"1", "i32(1)"},
+		{"3000000000", "i64(3000000000)"},
+		{"1.5", "fp64(1.5)"},
+		{"1e3", "fp64(1000)"},
+		{"true", "boolean(true)"},
+		{"null", "null(boolean?)"},
+		{"'a'", "string(a)"},
+		{"0x4142", "binary([65 66])"},
+		{"X'4142'", "binary([65 66])"},
+		{"b'101'", "binary([5])"},
+		{"date '2023-06-01'", "date(19509)"},
+		{"time '10:15:30.5'", "time(36930500000)"},
+		{"timestamp '2023-06-01 10:15:30'", "timestamp(1685614530000000)"},
+	}
+
+	for _, test := range tests {
+		statement, err := sqlparser.Parse("select " + test.literal)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		literal, err := toLiteral(statement.(*sqlparser.Select).SelectExprs[0].(*sqlparser.AliasedExpr).Expr, false)
+		if err != nil {
+			t.Errorf("expected literal: '%s' to be translated, got: %v", test.literal, err)
+			continue
+		}
+
+		if literal.String() != test.expected {
+			t.Errorf("expected literal: '%s' to be translated to: '%s', got: '%s'", test.literal, test.expected, literal.String())
+		}
+	}
+
+	_, err := toLiteral(sqlparser.NewIntLiteral("99999999999999999999"), false)
+	if err == nil {
+		t.Errorf("expected an out of range integer to be rejected")
+	}
+}
+
+func TestCoerceArguments(t *testing.T) {
+	tests := []struct {
+		columnType types.Type
+		literal    expr.Literal
+		expected   string
+	}{
+		{&types.Int64Type{}, expr.NewPrimitiveLiteral(int32(1), false), "i64(1)"},
+		{&types.Int16Type{}, expr.NewPrimitiveLiteral(int32(1), false), "i16(1)"},
+		{&types.Float64Type{}, expr.NewPrimitiveLiteral(int32(1), false), "fp64(1)"},
+		{&types.Int32Type{}, expr.NewPrimitiveLiteral("3", false), "i32(3)"},
+		{&types.StringType{}, expr.NewByteSliceLiteral([]byte("a"), false), "string(a)"},
+		{&types.Int32Type{}, &expr.NullLiteral{Type: &types.BooleanType{Nullability: types.NullabilityNullable}}, "null(i32?)"},
+		{&types.TimestampType{}, expr.NewPrimitiveLiteral("2023-06-01", false), "timestamp(1685577600000000)"},
+		{&types.TimestampTzType{}, expr.NewPrimitiveLiteral("2023-06-01T10:00:00+02:00", false), "timestamp_tz(1685606400000000)"},
+		{&types.DateType{}, expr.NewPrimitiveLiteral("2023-06-01", false), "date(19509)"},
+		{&types.UUIDType{}, expr.NewPrimitiveLiteral("0b0f2a4e-5c1d-4b7a-9a43-7f3e2d1c0b9a", false), "uuid([11 15 42 78 92 29 75 122 154 67 127 62 45 28 11 154])"},
+	}
+
+	for _, test := range tests {
+		coerced := coerceArguments([]types.FuncArg{testColumn(t, test.columnType), test.literal})
+
+		if coerced[1].(expr.Literal).String() != test.expected {
+			t.Errorf("expected literal: '%s' to be cast to: '%s', got: '%s'", test.literal, test.expected, coerced[1])
+		}
+	}
+
+	coerced := coerceArguments([]types.FuncArg{testColumn(t, &types.Int32Type{}), expr.NewPrimitiveLiteral(2.5, false)})
+	if cast, ok := coerced[0].(*expr.Cast); !ok || !cast.Type.Equals(&types.Float64Type{}) {
+		t.Errorf("expected an int column compared to a fractional literal to be cast to fp64, got: '%s'", coerced[0])
+	}
+
+	decimal := &types.DecimalType{Nullability: types.NullabilityRequired, Precision: 10, Scale: 2}
+	coerced = coerceArguments([]types.FuncArg{testColumn(t, decimal), expr.NewPrimitiveLiteral(12.5, false)})
+	if !coerced[1].(expr.Expression).GetType().Equals(decimal) {
+		t.Errorf("expected a fractional literal compared to a decimal column to be a decimal, got: '%s'", coerced[1])
+	}
+
+	coerced = coerceArguments([]types.FuncArg{testColumn(t, decimal), expr.NewPrimitiveLiteral(12.125, false)})
+	if _, ok := coerced[1].(expr.Expression).GetType().(*types.DecimalType); ok {
+		t.Errorf("expected a literal with more digits than a decimal column not to be a decimal, got: '%s'", coerced[1])
+	}
+
+	unsigned := &types.Int8Type{Nullability: types.NullabilityRequired, TypeVariationRef: 1}
+	coerced = coerceArguments([]types.FuncArg{testColumn(t, unsigned), expr.NewPrimitiveLiteral(int8(1), false)})
+	if cast, ok := coerced[0].(*expr.Cast); !ok || !cast.Type.Equals(&types.Int16Type{Nullability: types.NullabilityRequired}) {
+		t.Errorf("expected an unsigned byte column to be widened to i16, got: '%s'", coerced[0])
+	}
+}
+
+func TestRewritePaths(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"select a.b from t", "select a.b from t"},
+		{"select a.b.c.d from t", "select a.b.c->'$.d' from t"},
+		{"select tags[1] from t", "select tags->'$[0]' from t"},
+		{"select t.stops[2].name, x from t", "select t.stops->'$[1].name', x from t"},
+		{"select s[1].d[2] + 1 from t where s[3].name = 'a[1]'", "select s->'$[0].d[1]' + 1 from t where s->'$[2].name' = 'a[1]'"},
+	}
+
+	for _, test := range tests {
+		rewritten, _, err := rewritePaths(test.query)
+		if err != nil {
+			t.Errorf("expected query: '%s' to be rewritten, got: %v", test.query, err)
+			continue
+		}
+
+		if rewritten != test.expected {
+			t.Errorf("expected query: '%s' to be rewritten as: '%s', got: '%s'", test.query, test.expected, rewritten)
+		}
+	}
+}
+
+func TestOriginalPosition(t *testing.T) {
+	query := "select tags[1], x from t"
+	_, rewrites, err := rewritePaths(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// "select tags->'$[0]', x from t"
+	if position := originalPosition(rewrites, 10); position != 8 {
+		t.Errorf("expected a position inside of a path to be mapped to its start, got: %d", position)
+	}
+
+	if position := originalPosition(rewrites, 22); position != 17 {
+		t.Errorf("expected a position after a path to be shifted, got: %d", position)
+	}
+}
+
+func TestParseJsonPath(t *testing.T) {
+	segments, ok := parseJsonPath(`$.a[1]."b c".d`)
+	expected := []pathSegment{{field: "a"}, {element: 1}, {field: "b c"}, {field: "d"}}
+	if !ok || !reflect.DeepEqual(segments, expected) {
+		t.Errorf("expected path to be parsed as: %v, got: %v", expected, segments)
+	}
+
+	for _, path := range []string{"a", "$.", "$[a]", "$[-1]", `$."a`} {
+		if _, ok := parseJsonPath(path); ok {
+			t.Errorf("expected path: '%s' to be rejected", path)
+		}
+	}
+}
+
+func testColumn(t *testing.T, columnType types.Type) *expr.FieldReference {
+	column, err := expr.NewRootFieldRef(expr.NewStructFieldRef(0), &types.StructType{Types: []types.Type{columnType}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return column
+}
+
+func testLeafs(t *testing.T) map[string]*services.Leaf {
+	schema := common.Schema{
+		Fields: []common.Field{
+			{Name: "vendorId", Nullable: true, Type: common.Type{Name: common.Utf8Type}},
+			{Name: "passengers", Nullable: false, Type: common.Type{Name: common.IntType}},
+		},
+	}
+
+	leaf, err := services.NewLeaf("trips", schema, store.Json, store.Options{}, "", services.BadRecordPolicy{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nestedSchema, err := common.FromYaml("testdata/yaml/nested_schema.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := services.NewLeaf("events", *nestedSchema, store.Json, store.Options{}, "", services.BadRecordPolicy{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logicalSchema, err := common.FromYaml("testdata/yaml/logical_schema.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rides, err := services.NewLeaf("rides", *logicalSchema, store.Json, store.Options{}, "", services.BadRecordPolicy{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]*services.Leaf{"trips": leaf, "events": events, "rides": rides}
+}
+
+func TestLogicalTypesQueries(t *testing.T) {
+	leafs := testLeafs(t)
+	events := []string{
+		`{"tripId":"0b0f2a4e-5c1d-4b7a-9a43-7f3e2d1c0b9a","pickupTimestamp":"2023-06-01T10:15:30.250Z","pickupDate":"2023-06-01","pickupTime":"10:15:30","duration":"1h30m","fareAmount":"12.50","paymentType":"card"}`,
+		`{"tripId":"6f1c2b3a-0000-4000-8000-000000000001","pickupTimestamp":1685514530250,"pickupDate":19508,"pickupTime":null,"duration":60,"fareAmount":7.25,"paymentType":"cash"}`,
+	}
+
+	for i, event := range events {
+		if err := (*leafs["rides"].Store).Put(0, int64(i), time.Time{}, nil, []byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"select count(*) from rides where pickupTimestamp > '2023-06-01 00:00:00'", `[{"count(*)":1}]`},
+		{"select count(*) from rides where pickupTimestamp + interval 1 day > timestamp '2023-06-01 00:00:00'", `[{"count(*)":2}]`},
+		{"select fareAmount from rides where tripId = '6f1c2b3a-0000-4000-8000-000000000001'", `[{"fareAmount":"7.25"}]`},
+		{"select tripId from rides where paymentType = 'card' and fareAmount > 10", `[{"tripId":"0b0f2a4e-5c1d-4b7a-9a43-7f3e2d1c0b9a"}]`},
+		{"select paymentType from rides where pickupDate = '2023-05-31' and duration < 100", `[{"paymentType":"cash"}]`},
+		{"select extract(hour from pickupTimestamp) as hour from rides order by pickupTimestamp", `[{"hour":6},{"hour":10}]`},
+		{"select min(fareAmount) as low, max(pickupTime) as high from rides", `[{"high":"10:15:30","low":"7.25"}]`},
+		{"select paymentType, count(*) from rides group by paymentType order by paymentType", `[{"count(*)":1,"paymentType":"card"},{"count(*)":1,"paymentType":"cash"}]`},
+	}
+
+	for _, test := range tests {
+		p, err := planFromSql(leafs, test.query)
+		if err != nil {
+			t.Errorf("expected query: '%s' to be planned, got: %v", test.query, err)
+			continue
+		}
+
+		operator, err := convertPlanToVolcanoOperator(leafs, p)
+		if err != nil {
+			t.Errorf("expected plan of query: '%s' to be converted, got: %v", test.query, err)
+			continue
+		}
+
+		result, err := executeOperator(operator)
+		if err != nil {
+			t.Errorf("expected query: '%s' to be executed, got: %v", test.query, err)
+			continue
+		}
+
+		if result != test.expected {
+			t.Errorf("expected query: '%s' to return: %s, got: %s", test.query, test.expected, result)
+		}
+	}
+}
+
+func TestAggregateQueries(t *testing.T) {
+	leafs := testLeafs(t)
+	events := []string{
+		`{"tripId":"6f1c2b3a-0000-4000-8000-000000000001","fareAmount":"12.50","paymentType":"card"}`,
+		`{"tripId":"6f1c2b3a-0000-4000-8000-000000000002","fareAmount":"12.50","paymentType":"card"}`,
+		`{"tripId":"6f1c2b3a-0000-4000-8000-000000000003","fareAmount":"7.25","paymentType":"card"}`,
+		`{"tripId":"6f1c2b3a-0000-4000-8000-000000000004","fareAmount":"30.00","paymentType":"cash"}`,
+		`{"tripId":"6f1c2b3a-0000-4000-8000-000000000005","fareAmount":null,"paymentType":"cash"}`,
+	}
+
+	for i, event := range events {
+		if err := (*leafs["rides"].Store).Put(0, int64(i), time.Time{}, nil, []byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"select count(distinct paymentType) as payments, count(distinct fareAmount) as fares from rides", `[{"fares":3,"payments":2}]`},
+		{"select paymentType, count(distinct fareAmount) as fares, count(fareAmount) as all_fares from rides group by paymentType order by paymentType", `[{"all_fares":3,"fares":2,"paymentType":"card"},{"all_fares":1,"fares":1,"paymentType":"cash"}]`},
+		{"select sum(distinct fareAmount) as fares from rides where paymentType = 'card'", `[{"fares":19.75}]`},
+		{"select min(distinct fareAmount) as low, max(distinct fareAmount) as high from rides", `[{"high":"30","low":"7.25"}]`},
+		{"select paymentType from rides group by paymentType order by count(*)", `[{"paymentType":"cash"},{"paymentType":"card"}]`},
+		{"select paymentType from rides group by paymentType order by sum(fareAmount) desc", `[{"paymentType":"card"},{"paymentType":"cash"}]`},
+		{"select paymentType, count(*) from rides group by paymentType order by count(distinct fareAmount) desc, count(*)", `[{"count(*)":3,"paymentType":"card"},{"count(*)":2,"paymentType":"cash"}]`},
+		{"select distinct paymentType from rides order by paymentType", `[{"paymentType":"card"},{"paymentType":"cash"}]`},
+		{"select distinct paymentType as payment, fareAmount from rides where fareAmount > 10 order by 2, 1", `[{"fareAmount":"12.5","payment":"card"},{"fareAmount":"30","payment":"cash"}]`},
+	}
+
+	for _, test := range tests {
+		p, err := planFromSql(leafs, test.query)
+		if err != nil {
+			t.Errorf("expected query: '%s' to be planned, got: %v", test.query, err)
+			continue
+		}
+
+		operator, err := convertPlanToVolcanoOperator(leafs, p)
+		if err != nil {
+			t.Errorf("expected plan of query: '%s' to be converted, got: %v", test.query, err)
+			continue
+		}
+
+		result, err := executeOperator(operator)
+		if err != nil {
+			t.Errorf("expected query: '%s' to be executed, got: %v", test.query, err)
+			continue
+		}
+
+		if result != test.expected {
+			t.Errorf("expected query: '%s' to return: %s, got: %s", test.query, test.expected, result)
+		}
+	}
+}
+
+// executeOperator returns the rows produced by operator as a single json array.
+func executeOperator(operator *engine.VolcanoOperator) (string, error) {
+	if err := (*operator).Open(); err != nil {
+		return "", err
+	}
+
+	defer (*operator).Close()
+
+	rows := []any{}
+	for {
+		batch, err := (*operator).Next()
+		if err == engine.EOB {
+			data, err := json.Marshal(rows)
+			return string(data), err
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		data, err := (*batch).MarshalJSON()
+		(*batch).Release()
+		if err != nil {
+			return "", err
+		}
+
+		var batchRows []any
+		if err := json.Unmarshal(data, &batchRows); err != nil {
+			return "", err
+		}
+
+		rows = append(rows, batchRows...)
+	}
+}
+
+func TestPredicatePushdown(t *testing.T) {
+	defer func(groupSize int32) { store.DefaultGroupSize = groupSize }(store.DefaultGroupSize)
+	store.DefaultGroupSize = 2
+
+	// the rides are sealed two by two, their timestamps and fares growing, the first two having no pickup time.
+	leafs := testLeafs(t)
+	rides := leafs["rides"].Store
+	for i := 0; i < 6; i++ {
+		pickupTime, paymentType := `"10:15:30"`, "card"
+		if i < 2 {
+			pickupTime = "null"
+		}
+
+		if i >= 4 {
+			paymentType = "cash"
+		}
+
+		event := fmt.Sprintf(`{"tripId":"6f1c2b3a-0000-4000-8000-00000000000%d","pickupTimestamp":"2023-06-01T0%d:00:00Z","pickupDate":19509,"pickupTime":%s,"duration":60,"fareAmount":%d.5,"paymentType":"%s"}`, i, i, pickupTime, i, paymentType)
+		if err := (*rides).Put(0, int64(i), time.Time{}, nil, []byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		rows  int64
+	}{
+		{"select tripId from rides where pickupTimestamp > '2023-06-01 03:00:00'", 2},
+		{"select tripId from rides where '2023-06-01 01:00:00' >= pickupTimestamp", 2},
+		{"select tripId from rides where paymentType = 'cash'", 2},
+		{"select tripId from rides where pickupTime is null", 2},
+		{"select tripId from rides where pickupTime is not null and pickupTimestamp < '2023-06-01 03:00:00'", 2},
+		{"select tripId from rides where tripId = '6f1c2b3a-0000-4000-8000-000000000003'", 2},
+		{"select tripId from rides where pickupTimestamp > '2023-06-01 03:00:00' or paymentType = 'card'", 6},
+		{"select tripId from rides where pickupTimestamp > '2023-06-02 00:00:00'", 0},
+	}
+
+	for _, test := range tests {
+		p, err := planFromSql(leafs, test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filter := findFilter(t, p)
+		iterator, err := (*rides).Iterator(store.Scan{Predicate: store.NewPredicate(planContext(p), filter.Condition())})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var rows int64
+		for (*iterator).Next() {
+			rows += (*(*iterator).Value()).NumRows()
+		}
+
+		(*iterator).Close()
+		if rows != test.rows {
+			t.Errorf("expected query: '%s' to read %d rows, got: %d", test.query, test.rows, rows)
+		}
+	}
+
+	// the rows of the records read are still filtered.
+	query := "select count(*) from rides where pickupTimestamp > '2023-06-01 02:00:00' and paymentType = 'card'"
+	p, err := planFromSql(leafs, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	operator, err := convertPlanToVolcanoOperator(leafs, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := executeOperator(operator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result != `[{"count(*)":1}]` {
+		t.Errorf("expected query: '%s' to return: [{\"count(*)\":1}], got: %s", query, result)
+	}
+}
+
+func TestProjectionPushdown(t *testing.T) {
+	leafs := testLeafs(t)
+	rides := leafs["rides"].Store
+	for i, paymentType := range []string{"card", "cash", "card", "cash"} {
+		event := fmt.Sprintf(`{"tripId":"6f1c2b3a-0000-4000-8000-00000000000%d","pickupTimestamp":"2023-06-01T0%d:00:00Z","pickupDate":19509,"pickupTime":null,"duration":60,"fareAmount":%d.5,"paymentType":"%s"}`, i, i, i, paymentType)
+		if err := (*rides).Put(0, int64(i), time.Time{}, nil, []byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the read selects paymentType and tripId while its filter references fareAmount.
+	p, err := planFromSql(leafs, "select * from rides where fareAmount > 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	protoPlan, err := p.ToProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := &proto.ReadRel{
+		BaseSchema: (*rides).NamedStruct().ToProto(),
+		Filter:     findFilter(t, p).Condition().ToProto(),
+		Projection: &proto.Expression_MaskExpression{
+			Select: &proto.Expression_MaskExpression_StructSelect{
+				StructItems: []*proto.Expression_MaskExpression_StructItem{{Field: 6}, {Field: 0}},
+			},
+			MaintainSingularStruct: true,
+		},
+		ReadType: &proto.ReadRel_NamedTable_{NamedTable: &proto.ReadRel_NamedTable{Names: []string{"rides"}}},
+	}
+
+	protoPlan.Relations = []*proto.PlanRel{{RelType: &proto.PlanRel_Root{Root: &proto.RelRoot{
+		Input: &proto.Rel{RelType: &proto.Rel_Read{Read: read}},
+		Names: []string{"paymentType", "tripId"},
+	}}}}
+
+	p, err = plan.FromProto(protoPlan, &extensions.DefaultCollection)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := extractRootFromPlan(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	columns, _, ok := pushedProjection(root.Input().(*plan.NamedTableReadRel), 7)
+	if !ok || fmt.Sprint(columns) != "[6 0 5]" {
+		t.Errorf("expected the columns: [6 0 5] to be read, got: %v", columns)
+	}
+
+	operator, err := convertPlanToVolcanoOperator(leafs, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := executeOperator(operator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `[{"paymentType":"cash","tripId":"6f1c2b3a-0000-4000-8000-000000000001"},{"paymentType":"card","tripId":"6f1c2b3a-0000-4000-8000-000000000002"},{"paymentType":"cash","tripId":"6f1c2b3a-0000-4000-8000-000000000003"}]`
+	if result != expected {
+		t.Errorf("expected: %s, got: %s", expected, result)
+	}
+}
+
+func TestIndexes(t *testing.T) {
+	defer func(groupSize int32) { store.DefaultGroupSize = groupSize }(store.DefaultGroupSize)
+	store.DefaultGroupSize = 10
+
+	schema, err := common.FromYaml("testdata/yaml/logical_schema.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indexes := []store.Index{{Column: "tripId", Kind: store.Hash}, {Column: "paymentType", Kind: store.Bitmap}}
+	options := store.Options{Mode: store.Table, Key: []string{"tripId"}, Indexes: indexes}
+	leaf, err := services.NewLeaf("rides", *schema, store.Json, options, "", services.BadRecordPolicy{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the rides are sealed ten by ten, the odd ones paid cash, the second ride is then paid by card.
+	leafs := map[string]*services.Leaf{"rides": leaf}
+	rides := leaf.Store
+	for i := 0; i <= 20; i++ {
+		ride, paymentType := i, "card"
+		if i == 20 {
+			ride = 1
+		} else if i%2 == 1 {
+			paymentType = "cash"
+		}
+
+		event := fmt.Sprintf(`{"tripId":"6f1c2b3a-0000-4000-8000-0000000000%02d","pickupTimestamp":"2023-06-01T00:00:00Z","pickupDate":19509,"pickupTime":null,"duration":60,"fareAmount":1.5,"paymentType":"%s"}`, ride, paymentType)
+		if err := (*rides).Put(0, int64(i), time.Time{}, nil, []byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the ride being built is always read.
+	tests := []struct {
+		query string
+		rows  int64
+	}{
+		{"select tripId from rides where tripId = '6f1c2b3a-0000-4000-8000-000000000005'", 2},
+		{"select tripId from rides where tripId = '6f1c2b3a-0000-4000-8000-000000000001'", 1},
+		{"select tripId from rides where tripId in ('6f1c2b3a-0000-4000-8000-000000000002', '6f1c2b3a-0000-4000-8000-000000000013')", 3},
+		{"select tripId from rides where paymentType = 'cash'", 10},
+		{"select tripId from rides where paymentType = 'cash' and tripId = '6f1c2b3a-0000-4000-8000-000000000003'", 2},
+		{"select tripId from rides where paymentType = 'cash' and tripId = '6f1c2b3a-0000-4000-8000-000000000004'", 1},
+		{"select tripId from rides where fareAmount > 1", 20},
+	}
+
+	for _, test := range tests {
+		p, err := planFromSql(leafs, test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filter := findFilter(t, p)
+		iterator, err := (*rides).Iterator(store.Scan{Predicate: store.NewPredicate(planContext(p), filter.Condition())})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var rows int64
+		for (*iterator).Next() {
+			rows += (*(*iterator).Value()).NumRows()
+		}
+
+		(*iterator).Close()
+		if rows != test.rows {
+			t.Errorf("expected query: '%s' to read %d rows, got: %d", test.query, test.rows, rows)
+		}
+	}
+
+	results := []struct {
+		query    string
+		expected string
+	}{
+		{"select count(*) from rides where paymentType = 'cash'", `[{"count(*)":9}]`},
+		{"select paymentType from rides where tripId = '6f1c2b3a-0000-4000-8000-000000000001'", `[{"paymentType":"card"}]`},
+		{"select count(*) from rides where tripId in ('6f1c2b3a-0000-4000-8000-000000000002', '6f1c2b3a-0000-4000-8000-000000000013')", `[{"count(*)":2}]`},
+	}
+
+	for _, result := range results {
+		p, err := planFromSql(leafs, result.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		operator, err := convertPlanToVolcanoOperator(leafs, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual, err := executeOperator(operator)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if actual != result.expected {
+			t.Errorf("expected query: '%s' to return: %s, got: %s", result.query, result.expected, actual)
+		}
+	}
+}
+
+// findFilter returns the first filter found among the relations of p.
+func findFilter(t *testing.T, p *plan.Plan) *plan.FilterRel {
+	root, err := extractRootFromPlan(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for rel := root.Input(); rel != nil; {
+		if filter, ok := rel.(*plan.FilterRel); ok {
+			return filter
+		}
+
+		single, ok := rel.(plan.SingleInputRel)
+		if !ok {
+			break
+		}
+
+		rel = single.Input()
+	}
+
+	t.Fatal("expected a filter relation")
+	return nil
+}
@@ -0,0 +1,304 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/apache/arrow/go/v13/arrow/array"
+	"github.com/apache/arrow/go/v13/arrow/compute"
+	"github.com/apache/arrow/go/v13/arrow/memory"
+	"github.com/apache/arrow/go/v13/parquet"
+	"github.com/apache/arrow/go/v13/parquet/compress"
+	"github.com/apache/arrow/go/v13/parquet/file"
+	"github.com/apache/arrow/go/v13/parquet/pqarrow"
+	"io"
+	"os"
+	"time"
+)
+
+// Tiering bounds the sealed records a store keeps in memory, the oldest hot records are moved to parquet files, the
+// cold tier, as soon as any of the set bounds is exceeded. They are then read from their files by the iterators.
+type Tiering struct {
+	// MaxHotAge is compared to the latest time of the rows of each record, as the MaxAge of the retention.
+	MaxHotAge     time.Duration `yaml:"maxHotAge" json:"maxHotAge"`
+	MaxHotRecords int           `yaml:"maxHotRecords" json:"maxHotRecords,omitempty"`
+	MaxHotBytes   int64         `yaml:"maxHotBytes" json:"maxHotBytes,omitempty"`
+	// RowGroupSize is the maximum number of rows of the row groups of the parquet files, the default of the parquet
+	// writer is used when not set.
+	RowGroupSize int64 `yaml:"rowGroupSize" json:"rowGroupSize,omitempty"`
+}
+
+// enabled returns whether any bound is set.
+func (tiering Tiering) enabled() bool {
+	return tiering.MaxHotAge > 0 || tiering.MaxHotRecords > 0 || tiering.MaxHotBytes > 0
+}
+
+// ColdFile is a parquet file of the cold tier opened by an iterator, the file remains readable once opened even if the
+// records it holds are evicted meanwhile. Only the columns of the schema of the store listed by columns are read, all of
+// them when it is nil.
+type ColdFile struct {
+	file      *os.File
+	schema    *arrow.Schema
+	columns   []int
+	allocator memory.Allocator
+}
+
+func openColdFile(path string, schema *arrow.Schema, columns []int, allocator memory.Allocator) (*ColdFile, error) {
+	opened, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ColdFile{file: opened, schema: schema, columns: columns, allocator: allocator}, nil
+}
+
+// Records reads the records of the file, one per row group, with the types of the schema of the store. The file is
+// closed once read.
+func (cold *ColdFile) Records() ([]arrow.Record, error) {
+	reader, err := file.NewParquetReader(cold.file, file.WithReadProps(parquet.NewReaderProperties(cold.allocator)))
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	fileReader, err := pqarrow.NewFileReader(reader, pqarrow.ArrowReadProperties{}, cold.allocator)
+	if err != nil {
+		return nil, err
+	}
+
+	leaves, positions, err := cold.leaves(fileReader)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("cold file: '%s' can't be read: %s", cold.file.Name(), err))
+	}
+
+	var records []arrow.Record
+	for rowGroup := 0; rowGroup < reader.NumRowGroups(); rowGroup++ {
+		record, err := cold.readRowGroup(fileReader, rowGroup, leaves, positions)
+		if err != nil {
+			releaseRecords(records)
+			return nil, errors.New(fmt.Sprintf("cold file: '%s' can't be read: %s", cold.file.Name(), err))
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// leaves returns the leaf columns of the file making the selected columns, the ones of their nested fields included,
+// along with the position of each selected column among the columns read, which come in the order of the file.
+func (cold *ColdFile) leaves(fileReader *pqarrow.FileReader) ([]int, []int, error) {
+	columns := cold.columns
+	if columns == nil {
+		columns = make([]int, len(cold.schema.Fields()))
+		for index := range columns {
+			columns[index] = index
+		}
+	}
+
+	selected := make(map[int]bool)
+	for _, column := range columns {
+		selected[column] = true
+	}
+
+	fileSchema := fileReader.ParquetReader().MetaData().Schema
+	var leaves []int
+	read := make(map[int]int)
+	for leaf := 0; leaf < fileSchema.NumColumns(); leaf++ {
+		field := fileSchema.Root().FieldIndexByField(fileSchema.ColumnRoot(leaf))
+		if !selected[field] {
+			continue
+		}
+
+		leaves = append(leaves, leaf)
+		if _, ok := read[field]; !ok {
+			read[field] = len(read)
+		}
+	}
+
+	positions := make([]int, len(columns))
+	for index, column := range columns {
+		position, ok := read[column]
+		if !ok {
+			return nil, nil, errors.New(fmt.Sprintf("column: '%s' is missing", cold.schema.Field(column).Name))
+		}
+
+		positions[index] = position
+	}
+
+	return leaves, positions, nil
+}
+
+func (cold *ColdFile) readRowGroup(fileReader *pqarrow.FileReader, rowGroup int, leaves []int, positions []int) (arrow.Record, error) {
+	ctx := compute.WithAllocator(context.Background(), cold.allocator)
+	table, err := fileReader.ReadRowGroups(ctx, leaves, []int{rowGroup})
+	if err != nil {
+		return nil, err
+	}
+
+	defer table.Release()
+
+	schema := projectSchema(cold.schema, cold.columns)
+	columns := make([]arrow.Array, 0, len(positions))
+	defer func() { releaseArrays(columns) }()
+
+	for index, field := range schema.Fields() {
+		if positions[index] >= int(table.NumCols()) {
+			return nil, errors.New(fmt.Sprintf("row group: %d holds %d columns instead of %d", rowGroup, table.NumCols(), positions[index]+1))
+		}
+
+		chunks := table.Column(positions[index]).Data().Chunks()
+		column, err := array.Concatenate(chunks, cold.allocator)
+		if err != nil {
+			return nil, err
+		}
+
+		restored, err := restoreColumn(ctx, column, field.Type)
+		column.Release()
+		if err != nil {
+			return nil, err
+		}
+
+		columns = append(columns, restored)
+	}
+
+	return array.NewRecord(schema, columns, table.NumRows()), nil
+}
+
+func (cold *ColdFile) Close() {
+	_ = cold.file.Close()
+}
+
+// writeColdFile writes record to the parquet file path, along with the statistics of its row groups.
+func writeColdFile(path string, record arrow.Record, tiering Tiering, allocator memory.Allocator) error {
+	stored := storedRecord(record)
+	defer stored.Release()
+
+	writerOptions := []parquet.WriterProperty{
+		parquet.WithAllocator(allocator),
+		parquet.WithCompression(compress.Codecs.Snappy),
+		parquet.WithStats(true),
+	}
+
+	if tiering.RowGroupSize > 0 {
+		writerOptions = append(writerOptions, parquet.WithMaxRowGroupLength(tiering.RowGroupSize))
+	}
+
+	return writeFileAtomically(path, func(file *os.File) error {
+		arrowProperties := pqarrow.NewArrowWriterProperties(pqarrow.WithStoreSchema(), pqarrow.WithAllocator(allocator))
+		// the writer closes its sink when it is one, the file is synced first.
+		sink := struct{ io.Writer }{file}
+		writer, err := pqarrow.NewFileWriter(stored.Schema(), sink, parquet.NewWriterProperties(writerOptions...), arrowProperties)
+		if err != nil {
+			return err
+		}
+
+		if err := writer.Write(stored); err != nil {
+			_ = writer.Close()
+			return err
+		}
+
+		return writer.Close()
+	})
+}
+
+// storedRecord returns record with the types parquet can't hold replaced by their storage: durations are stored as
+// longs.
+func storedRecord(record arrow.Record) arrow.Record {
+	fields := make([]arrow.Field, len(record.Schema().Fields()))
+	columns := make([]arrow.Array, len(fields))
+	for index, field := range record.Schema().Fields() {
+		field.Type = storedType(field.Type)
+		fields[index] = field
+		columns[index] = relabel(record.Column(index), field.Type)
+	}
+
+	defer releaseArrays(columns)
+
+	return array.NewRecord(arrow.NewSchema(fields, nil), columns, record.NumRows())
+}
+
+func storedType(dataType arrow.DataType) arrow.DataType {
+	switch t := dataType.(type) {
+	case *arrow.DurationType:
+		return arrow.PrimitiveTypes.Int64
+	case *arrow.ListType:
+		field := t.ElemField()
+		field.Type = storedType(field.Type)
+		return arrow.ListOfField(field)
+	case *arrow.StructType:
+		fields := make([]arrow.Field, len(t.Fields()))
+		for index, field := range t.Fields() {
+			field.Type = storedType(field.Type)
+			fields[index] = field
+		}
+
+		return arrow.StructOf(fields...)
+	}
+
+	return dataType
+}
+
+// restoreColumn returns column with the type dataType it was stored from: the stored durations are relabeled and the
+// types parquet reads with another unit, such as the times in seconds, are cast.
+func restoreColumn(ctx context.Context, column arrow.Array, dataType arrow.DataType) (arrow.Array, error) {
+	if arrow.TypeEqual(column.DataType(), dataType) {
+		column.Retain()
+		return column, nil
+	}
+
+	if arrow.TypeEqual(column.DataType(), storedType(dataType)) {
+		return relabel(column, dataType), nil
+	}
+
+	return compute.CastArray(ctx, column, compute.SafeCastOptions(dataType))
+}
+
+// relabel returns a new array sharing the buffers of column with the type dataType, which must have the same layout.
+func relabel(column arrow.Array, dataType arrow.DataType) arrow.Array {
+	data := relabelData(column.Data(), dataType)
+	defer data.Release()
+
+	return array.MakeFromData(data)
+}
+
+func relabelData(data arrow.ArrayData, dataType arrow.DataType) arrow.ArrayData {
+	children := data.Children()
+	if len(children) > 0 {
+		relabeled := make([]arrow.ArrayData, len(children))
+		for index, child := range children {
+			switch t := dataType.(type) {
+			case *arrow.ListType:
+				relabeled[index] = relabelData(child, t.Elem())
+			case *arrow.StructType:
+				relabeled[index] = relabelData(child, t.Field(index).Type)
+			default:
+				child.Retain()
+				relabeled[index] = child
+			}
+		}
+
+		defer func() {
+			for _, child := range relabeled {
+				child.Release()
+			}
+		}()
+
+		children = relabeled
+	}
+
+	relabeled := array.NewData(dataType, data.Len(), data.Buffers(), children, data.NullN(), data.Offset())
+	if data.Dictionary() != nil {
+		relabeled.SetDictionary(data.Dictionary())
+	}
+
+	return relabeled
+}
+
+func releaseArrays(arrays []arrow.Array) {
+	for _, column := range arrays {
+		column.Release()
+	}
+}
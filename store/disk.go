@@ -0,0 +1,374 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/apache/arrow/go/v13/arrow/compute"
+	"github.com/apache/arrow/go/v13/arrow/ipc"
+	"github.com/apache/arrow/go/v13/arrow/memory"
+	"github.com/exsql-io/go-datastore/common"
+	"github.com/exsql-io/go-datastore/engine"
+	"github.com/goccy/go-json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// checkpointFileName is the name of the file holding the state of a DiskStore in its directory.
+const checkpointFileName = "checkpoint.json"
+
+// segmentExtension is the extension of the arrow IPC files holding the sealed records of a DiskStore.
+const segmentExtension = ".arrow"
+
+// coldExtension is the extension of the parquet files holding the sealed records of the cold tier of a DiskStore.
+const coldExtension = ".parquet"
+
+// DiskStore is an InMemoryStore which writes each record it seals to an arrow IPC file of its directory, along with a
+// checkpoint of its state, and which is restored from them when created again over the same directory. The records
+// which were not sealed are lost and have to be put again from the offsets returned by Offsets. The records moved to
+// the cold tier are written to parquet files of the same directory.
+type DiskStore struct {
+	*InMemoryStore
+	directory string
+}
+
+// diskCheckpoint is the state of a DiskStore, it references the segments holding the sealed records of the store.
+type diskCheckpoint struct {
+	Offsets  map[int32]int64   `json:"offsets"`
+	Segments []diskSegment     `json:"segments"`
+	Evicted  Evictions         `json:"evicted"`
+	Rows     map[string][2]int `json:"rows,omitempty"`
+	Keys     map[string]string `json:"keys,omitempty"`
+}
+
+// diskSegment is a sealed record of a DiskStore, held by a parquet file when Cold and an arrow IPC file otherwise.
+type diskSegment struct {
+	Group   int       `json:"group"`
+	Cold    bool      `json:"cold,omitempty"`
+	Deleted []byte    `json:"deleted,omitempty"`
+	Newest  time.Time `json:"newest"`
+	Rows    int64     `json:"rows"`
+	Size    int64     `json:"size"`
+}
+
+// NewDiskStore returns a DiskStore persisted to directory, restored from it when it holds a checkpoint, or a
+// PartitionedStore of DiskStores persisted to its sub-directories when options are partitioned.
+func NewDiskStore(allocator *memory.Allocator, inputFormatType InputFormatType, schema *common.Schema, options Options, directory string) (*Store, error) {
+	if options.Partitioned {
+		partitionOptions := options
+		partitionOptions.Partitioned = false
+		partitionedStore, err := newPartitionedDiskStore(allocator, inputFormatType, schema, partitionOptions, directory)
+		if err != nil {
+			return nil, err
+		}
+
+		var store Store
+		store = partitionedStore
+
+		return &store, nil
+	}
+
+	inMemoryStore, err := newInMemoryStore(allocator, inputFormatType, schema, options)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(directory, 0o755)
+	if err != nil {
+		inMemoryStore.Close()
+		return nil, err
+	}
+
+	diskStore := &DiskStore{InMemoryStore: inMemoryStore, directory: directory}
+	err = diskStore.restore()
+	if err != nil {
+		inMemoryStore.Close()
+		return nil, errors.New(fmt.Sprintf("store in: '%s' can't be restored: %s", directory, err))
+	}
+
+	inMemoryStore.persistence = diskStore
+
+	var store Store
+	store = diskStore
+
+	return &store, nil
+}
+
+// checkpoint writes the sealed records which have no segment yet, then the checkpoint referencing them along with
+// offsets, and finally removes the segments of the evicted records.
+func (diskStore *DiskStore) checkpoint(store *InMemoryStore, offsets map[int32]int64) error {
+	state := diskCheckpoint{
+		Offsets: offsets,
+		Evicted: store.evicted,
+		Rows:    make(map[string][2]int),
+		Keys:    make(map[string]string),
+	}
+
+	for index, sealed := range store.records {
+		group := store.evicted.Records + index
+		if sealed.record != nil {
+			if err := diskStore.writeSegment(segmentName(group), sealed.record); err != nil {
+				return err
+			}
+		}
+
+		segment := diskSegment{Group: group, Cold: sealed.record == nil, Deleted: sealed.deleted, Newest: sealed.newest, Rows: sealed.rows, Size: sealed.size}
+		state.Segments = append(state.Segments, segment)
+	}
+
+	// the rows which are not sealed yet are put again when the store is restored.
+	sealedGroups := store.evicted.Records + len(store.records)
+	for rowKey, row := range store.rows {
+		if row.group < sealedGroups {
+			state.Rows[rowKey] = [2]int{row.group, row.row}
+		}
+	}
+
+	for key, rowKey := range store.keys {
+		if _, ok := state.Rows[rowKey]; ok {
+			state.Keys[key] = rowKey
+		}
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomically(filepath.Join(diskStore.directory, checkpointFileName), func(file *os.File) error {
+		_, err := file.Write(data)
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return diskStore.removeUnreferencedFiles(state)
+}
+
+// restore loads the sealed records and the state of the store from its directory, it leaves the store empty when
+// there is no checkpoint yet.
+func (diskStore *DiskStore) restore() error {
+	data, err := os.ReadFile(filepath.Join(diskStore.directory, checkpointFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var state diskCheckpoint
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	store := diskStore.InMemoryStore
+	for index, segment := range state.Segments {
+		if segment.Group != state.Evicted.Records+index {
+			return errors.New(fmt.Sprintf("segment: '%s' is not the one expected at: %d", segmentName(segment.Group), index))
+		}
+
+		sealed := sealedRecord{deleted: segment.Deleted, newest: segment.Newest, rows: segment.Rows, size: segment.Size}
+		if segment.Cold {
+			sealed.cold = filepath.Join(diskStore.directory, coldName(segment.Group))
+		} else {
+			record, err := diskStore.readSegment(segmentName(segment.Group))
+			if err != nil {
+				return err
+			}
+
+			sealed.record = record
+		}
+
+		// the sealed record is added first to be released along with the store if its zone map can't be computed.
+		store.records = append(store.records, sealed)
+		zones, indexes, err := diskStore.statistics(sealed)
+		if err != nil {
+			return err
+		}
+
+		store.records[index].zones = zones
+		store.records[index].indexes = indexes
+	}
+
+	store.evicted = state.Evicted
+	for rowKey, row := range state.Rows {
+		store.rows[rowKey] = location{group: row[0], row: row[1]}
+	}
+
+	for key, rowKey := range state.Keys {
+		store.keys[key] = rowKey
+	}
+
+	for partition, offset := range state.Offsets {
+		store.offsets[partition] = offset
+		store.sealedOffsets[partition] = offset
+	}
+
+	return diskStore.removeUnreferencedFiles(state)
+}
+
+// statistics computes the zone map and the indexes of sealed, the records of the cold tier are read back from their
+// file.
+func (diskStore *DiskStore) statistics(sealed sealedRecord) (zoneMap, map[int]columnIndex, error) {
+	record := sealed.record
+	if record == nil {
+		cold, err := openColdFile(sealed.cold, diskStore.stored, nil, *diskStore.allocator)
+		if err != nil {
+			return zoneMap{}, nil, err
+		}
+
+		defer cold.Close()
+
+		records, err := cold.Records()
+		if err != nil {
+			return zoneMap{}, nil, err
+		}
+
+		defer releaseRecords(records)
+
+		record, err = engine.Concatenate(compute.WithAllocator(context.Background(), *diskStore.allocator), records)
+		if err != nil {
+			return zoneMap{}, nil, err
+		}
+
+		defer record.Release()
+	}
+
+	zones, err := newZoneMap(record, *diskStore.allocator)
+	if err != nil {
+		return zoneMap{}, nil, err
+	}
+
+	return zones, newIndexes(record, diskStore.options.Indexes), nil
+}
+
+// removeUnreferencedFiles removes the segments not referenced by state: the ones of evicted records, the ones of the
+// records moved to the cold tier and the ones written after the last checkpoint, which would otherwise be mistaken for
+// the segments of the records sealed next, along with the temporary files left behind.
+func (diskStore *DiskStore) removeUnreferencedFiles(state diskCheckpoint) error {
+	segments := map[string]bool{}
+	for _, segment := range state.Segments {
+		if segment.Cold {
+			segments[coldName(segment.Group)] = true
+		} else {
+			segments[segmentName(segment.Group)] = true
+		}
+	}
+
+	entries, err := os.ReadDir(diskStore.directory)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		segment := strings.HasSuffix(entry.Name(), segmentExtension) || strings.HasSuffix(entry.Name(), coldExtension)
+		unreferenced := segment && !segments[entry.Name()]
+		if unreferenced || strings.HasSuffix(entry.Name(), ".tmp") {
+			if err := os.Remove(filepath.Join(diskStore.directory, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeSegment writes record to the arrow IPC file name, unless it was already written.
+func (diskStore *DiskStore) writeSegment(name string, record arrow.Record) error {
+	path := filepath.Join(diskStore.directory, name)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	return writeFileAtomically(path, func(file *os.File) error {
+		writer, err := ipc.NewFileWriter(file, ipc.WithSchema(record.Schema()), ipc.WithAllocator(*diskStore.allocator))
+		if err != nil {
+			return err
+		}
+
+		if err := writer.Write(record); err != nil {
+			_ = writer.Close()
+			return err
+		}
+
+		return writer.Close()
+	})
+}
+
+// freeze writes record to the parquet file of the cold tier of group, it is referenced by the next checkpoint.
+func (diskStore *DiskStore) freeze(group int, record arrow.Record) (string, int64, error) {
+	path := filepath.Join(diskStore.directory, coldName(group))
+	if err := writeColdFile(path, record, diskStore.options.Tiering, *diskStore.allocator); err != nil {
+		return "", 0, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return path, info.Size(), nil
+}
+
+func (diskStore *DiskStore) readSegment(name string) (arrow.Record, error) {
+	file, err := os.Open(filepath.Join(diskStore.directory, name))
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	reader, err := ipc.NewFileReader(file, ipc.WithSchema(diskStore.stored), ipc.WithAllocator(*diskStore.allocator))
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	if reader.NumRecords() != 1 {
+		return nil, errors.New(fmt.Sprintf("segment: '%s' holds %d records instead of one", name, reader.NumRecords()))
+	}
+
+	return reader.RecordAt(0)
+}
+
+// segmentName returns the name of the file of the record sealed in position group.
+func segmentName(group int) string {
+	return fmt.Sprintf("%020d%s", group, segmentExtension)
+}
+
+// coldName returns the name of the parquet file of the record sealed in position group.
+func coldName(group int) string {
+	return fmt.Sprintf("%020d%s", group, coldExtension)
+}
+
+// writeFileAtomically writes path through write into a temporary file which replaces path once synced.
+func writeFileAtomically(path string, write func(file *os.File) error) error {
+	temporary := path + ".tmp"
+	file, err := os.Create(temporary)
+	if err != nil {
+		return err
+	}
+
+	err = write(file)
+	if err == nil {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(temporary)
+		return err
+	}
+
+	return os.Rename(temporary, path)
+}
@@ -1,105 +1,481 @@
 package store
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/apache/arrow/go/v13/arrow"
 	"github.com/apache/arrow/go/v13/arrow/array"
+	"github.com/apache/arrow/go/v13/arrow/bitutil"
+	"github.com/apache/arrow/go/v13/arrow/compute"
 	"github.com/apache/arrow/go/v13/arrow/memory"
+	"github.com/apache/arrow/go/v13/arrow/util"
 	"github.com/exsql-io/go-datastore/common"
 	"github.com/exsql-io/go-datastore/engine"
+	"github.com/goccy/go-json"
 	"github.com/substrait-io/substrait-go/types"
+	"sync"
+	"time"
 )
 
 var DefaultGroupSize int32 = 4096
 
+// InMemoryStore decodes the values put into it into a long-lived builder and seals them as immutable records every
+// DefaultGroupSize values. Puts and iterators may run concurrently, an iterator reads the point-in-time snapshot of the
+// store taken at its creation. The records also hold the partition, the offset and the timestamp each row was put
+// with, in metadata columns following the columns of the schema which are not returned by the iterators.
+//
+// In Table mode the rows replaced or deleted by later values are flagged in copy-on-write bitmaps, one per record, the
+// snapshots keeping the bitmaps they were taken with.
+//
+// The sealed records out of the retention of the store are evicted from the oldest, whenever a record is sealed and
+// when Evict is called. At the same time, the oldest records out of the tiering bounds are moved to the cold tier of
+// the persistence of the store, which requires one.
 type InMemoryStore struct {
+	lock            sync.Mutex
 	schema          *arrow.Schema
-	buffered        [][]byte
-	bufferIndex     int32
+	stored          *arrow.Schema
 	inputFormatType InputFormatType
+	options         Options
 	allocator       *memory.Allocator
-	records         []arrow.Record
+	builder         *array.RecordBuilder
+	metadata        *array.RecordBuilder
+	enums           []*enumBuilder
+	// built counts the rows held by builder, chunks the rows of the group being built which were already taken out of
+	// it, and grouped both.
+	built   int64
+	chunks  []arrow.Record
+	grouped int32
+	// deleted is the bitmap of the group being built and newest the latest timestamp of its records.
+	deleted []byte
+	newest  time.Time
+	records []sealedRecord
+	// rows holds the location of the latest row of each key and keys the key of the row of each record key, when rows
+	// are keyed by columns.
+	rows    map[string]location
+	keys    map[string]string
+	evicted Evictions
+	// offsets holds the last offset put of each partition and sealedOffsets the ones of the last checkpointed record,
+	// which the state persisted by persistence is consistent with.
+	offsets       map[int32]int64
+	sealedOffsets map[int32]int64
+	persistence   persistence
+	namedStruct   types.NamedStruct
 }
 
-func NewInMemoryStore(allocator *memory.Allocator, inputFormatType InputFormatType, schema *common.Schema) (*Store, error) {
-	arrowSchema, err := ToArrowSchema(schema)
+// persistence saves the sealed records of a store, and the state it needs to be restored from them along with offsets,
+// whenever they change, freeze writes the record sealed in position group to the cold tier and returns the path and the
+// size of its file. It is called with the lock of the store held.
+type persistence interface {
+	checkpoint(store *InMemoryStore, offsets map[int32]int64) error
+	freeze(group int, record arrow.Record) (string, int64, error)
+}
+
+// sealedRecord is a record of a store along with the bitmap of its deleted rows, the latest time of its rows, which
+// its retention is based on, its number of rows, its size in bytes in memory or of its cold file, its zone map and the
+// indexes of its columns. The record of the cold tier is only held by its file, cold.
+type sealedRecord struct {
+	record  arrow.Record
+	cold    string
+	deleted []byte
+	newest  time.Time
+	rows    int64
+	size    int64
+	zones   zoneMap
+	indexes map[int]columnIndex
+}
+
+// location is the position of a row in the records of a store, the group being built following the sealed records.
+// Groups are numbered from the first record ever sealed, evicted ones included.
+type location struct {
+	group int
+	row   int
+}
+
+func NewInMemoryStore(allocator *memory.Allocator, inputFormatType InputFormatType, schema *common.Schema, options Options) (*Store, error) {
+	if options.Tiering.enabled() {
+		return nil, errors.New(fmt.Sprintf("tiering: %+v requires a disk store", options.Tiering))
+	}
+
+	if options.Partitioned {
+		partitionOptions := options
+		partitionOptions.Partitioned = false
+		partitionedStore, err := newPartitionedStore(allocator, inputFormatType, schema, partitionOptions, func(int32) (Store, error) {
+			return newInMemoryStore(allocator, inputFormatType, schema, partitionOptions)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		var store Store
+		store = partitionedStore
+
+		return &store, nil
+	}
+
+	inMemoryStore, err := newInMemoryStore(allocator, inputFormatType, schema, options)
 	if err != nil {
 		return nil, err
 	}
 
 	var store Store
-	store = &InMemoryStore{
+	store = inMemoryStore
+
+	return &store, nil
+}
+
+func newInMemoryStore(allocator *memory.Allocator, inputFormatType InputFormatType, schema *common.Schema, options Options) (*InMemoryStore, error) {
+	if inputFormatType != Json {
+		return nil, errors.New(fmt.Sprintf("unsupported inputFormatType: '%s'", inputFormatType))
+	}
+
+	arrowSchema, err := ToArrowSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateFieldNames(arrowSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateOptions(arrowSchema, options)
+	if err != nil {
+		return nil, err
+	}
+
+	namedStruct, err := ToNamedStruct(arrowSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := array.NewRecordBuilder(*allocator, arrowSchema)
+
+	var enums []*enumBuilder
+	for index, field := range arrowSchema.Fields() {
+		builders, err := enumBuilders(field, builder.Field(index))
+		if err != nil {
+			builder.Release()
+			return nil, err
+		}
+
+		enums = append(enums, builders...)
+	}
+
+	store := &InMemoryStore{
 		schema:          arrowSchema,
-		buffered:        make([][]byte, DefaultGroupSize),
-		bufferIndex:     0,
+		stored:          storedSchema(arrowSchema),
 		inputFormatType: inputFormatType,
+		options:         options,
 		allocator:       allocator,
+		builder:         builder,
+		metadata:        array.NewRecordBuilder(*allocator, arrow.NewSchema(metadataFields, nil)),
+		enums:           enums,
+		rows:            make(map[string]location),
+		keys:            make(map[string]string),
+		offsets:         make(map[int32]int64),
+		sealedOffsets:   make(map[int32]int64),
+		namedStruct:     namedStruct,
 	}
 
-	return &store, nil
+	return store, nil
 }
 
-func (store *InMemoryStore) Put(_ int64, _ []byte, value []byte) error {
-	store.buffered[store.bufferIndex] = value
-	store.bufferIndex += 1
+// Put decodes value into the builder, a value which is not valid is rejected with a DecodeError without altering the
+// store.
+func (store *InMemoryStore) Put(partition int32, offset int64, timestamp time.Time, key []byte, value []byte) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.offsets[partition] = offset
+
+	if store.options.Mode == Table {
+		return store.upsert(partition, offset, timestamp, key, value)
+	}
+
+	return store.append(partition, offset, timestamp, value)
+}
+
+// Iterator returns an iterator over the snapshot of the store taken under the lock: the sealed records and the rows
+// of the group being built, which are taken out of the builder as a chunk, retained until the iterator is closed. The
+// sealed records which can't match the predicate of scan, or which are out of its ranges, are skipped, along with the
+// rows of the indexed records the predicate rules out. Only the columns listed by scan are read from the cold tier.
+func (store *InMemoryStore) Iterator(scan Scan) (*engine.CloseableIterator, error) {
+	if err := validateScan(store.schema, scan); err != nil {
+		return nil, err
+	}
+
+	width := len(store.schema.Fields())
+	schema := projectSchema(store.schema, scan.Columns)
+	columns := storedColumns(scan.Columns, width)
+	stored := projectSchema(store.stored, columns)
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.takeChunk()
+
+	groups := make([]RecordGroup, 0, len(store.records)+1)
+	for _, sealed := range store.records {
+		if !scan.Predicate.mayMatch(sealed.zones) || !scan.overlaps(sealed.zones, width) {
+			continue
+		}
+
+		selected := scan.Predicate.selection(sealed.indexes, width)
+		if selected != nil && selected.IsEmpty() {
+			continue
+		}
+
+		if sealed.record != nil {
+			records := projectRecords(stored, []arrow.Record{sealed.record}, columns)
+			groups = append(groups, RecordGroup{Records: records, Deleted: sealed.deleted, Selected: selected})
+			continue
+		}
 
-	if store.bufferIndex == DefaultGroupSize {
-		err := store.flushBuffer()
+		// the files of the cold tier are opened right away to keep reading them once evicted.
+		cold, err := openColdFile(sealed.cold, store.stored, columns, *store.allocator)
 		if err != nil {
-			return err
+			(*NewArrowTableCloseableIterator(schema, groups, scan)).Close()
+			return nil, err
 		}
 
-		store.bufferIndex = 0
+		groups = append(groups, RecordGroup{Deleted: sealed.deleted, Selected: selected, Cold: cold})
 	}
 
-	return nil
+	groups = append(groups, RecordGroup{Records: projectRecords(stored, store.chunks, columns), Deleted: store.deleted})
+	if scan.Order == Backward {
+		for left, right := 0, len(groups)-1; left < right; left, right = left+1, right-1 {
+			groups[left], groups[right] = groups[right], groups[left]
+		}
+	}
+
+	return NewArrowTableCloseableIterator(schema, groups, scan), nil
 }
 
-func (store *InMemoryStore) Iterator() (*engine.CloseableIterator, error) {
-	inMemoryRecords, err := store.inMemoryToRecords()
-	if err != nil {
-		return nil, err
+func (store *InMemoryStore) Close() {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.builder.Release()
+	store.metadata.Release()
+	releaseRecords(store.chunks)
+	for _, sealed := range store.records {
+		if sealed.record != nil {
+			sealed.record.Release()
+		}
+
+		sealed.zones.release()
 	}
 
-	return NewArrowTableCloseableIterator(inMemoryRecords, store.records), nil
+	store.chunks = nil
+	store.records = nil
 }
 
-func (store *InMemoryStore) Close() {}
+// Reset drops the rows of the builder, the chunks and the sealed records, the iterators keep their own references, and
+// checkpoints the empty store. The groups are numbered from zero again.
+func (store *InMemoryStore) Reset() error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.builder.NewRecord().Release()
+	store.metadata.NewRecord().Release()
+	for _, enum := range store.enums {
+		enum.builder.ResetFull()
+		enum.checked = 0
+	}
+
+	releaseRecords(store.chunks)
+	for _, sealed := range store.records {
+		if sealed.record != nil {
+			sealed.record.Release()
+		}
+
+		sealed.zones.release()
+	}
+
+	store.built = 0
+	store.chunks = nil
+	store.grouped = 0
+	store.deleted = nil
+	store.newest = time.Time{}
+	store.records = nil
+	store.rows = make(map[string]location)
+	store.keys = make(map[string]string)
+	store.evicted = Evictions{}
+	store.offsets = make(map[int32]int64)
+
+	return store.checkpoint(make(map[int32]int64))
+}
+
+// Offsets returns the last offset of each partition which the sealed records, and the state persisted along them, are
+// consistent with. The records put after them are not persisted yet and have to be put again when the store is restored.
+func (store *InMemoryStore) Offsets() map[int32]int64 {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	offsets := make(map[int32]int64, len(store.sealedOffsets))
+	for partition, offset := range store.sealedOffsets {
+		offsets[partition] = offset
+	}
+
+	return offsets
+}
 
 func (store *InMemoryStore) Schema() *arrow.Schema {
 	return store.schema
 }
 
 func (store *InMemoryStore) NamedStruct() types.NamedStruct {
-	var n []string
-	var t []types.Type
+	return store.namedStruct
+}
+
+// append decodes value into the builder as a new row, and seals the group once it is full.
+func (store *InMemoryStore) append(partition int32, offset int64, timestamp time.Time, value []byte) error {
+	if err := store.appendRow(partition, offset, timestamp, value); err != nil {
+		return err
+	}
+
+	return store.sealFullGroup()
+}
+
+// appendRow decodes value into the builder as a new row of the group being built.
+func (store *InMemoryStore) appendRow(partition int32, offset int64, timestamp time.Time, value []byte) error {
+	err := store.builder.UnmarshalJSON(value)
+	for _, enum := range store.enums {
+		if err != nil {
+			break
+		}
+
+		err = enum.validate()
+	}
 
-	for _, field := range store.schema.Fields() {
-		n = append(n, field.Name)
-		t = append(t, toType(field.Type))
+	if err != nil {
+		store.discardPartialRow()
+		return &DecodeError{Err: err}
 	}
 
-	return types.NamedStruct{
-		Names: n,
-		Struct: types.StructType{
-			Nullability: types.NullabilityRequired,
-			Types:       t,
-		},
+	store.metadata.Field(0).(*array.Int32Builder).Append(partition)
+	store.metadata.Field(1).(*array.Int64Builder).Append(offset)
+	store.metadata.Field(2).(*array.Int64Builder).Append(timestamp.UnixMilli())
+	store.built += 1
+	store.grouped += 1
+	if timestamp.After(store.newest) {
+		store.newest = timestamp
 	}
+
+	return nil
 }
 
-func toType(dataType arrow.DataType) types.Type {
-	switch dataType {
-	case arrow.PrimitiveTypes.Int32:
-		return &types.Int32Type{Nullability: types.NullabilityRequired}
-	case arrow.BinaryTypes.String:
-		return &types.StringType{Nullability: types.NullabilityRequired}
+// sealFullGroup seals the group being built once it holds DefaultGroupSize rows, which checkpoints the offsets put so
+// far: the state of every row put has to be up to date by then.
+func (store *InMemoryStore) sealFullGroup() error {
+	if store.grouped >= DefaultGroupSize {
+		return store.flushBuffer()
 	}
 
 	return nil
 }
 
+// upsert replaces the row of the key of value by value, or deletes it when value is null. The row replaced is deleted,
+// and the key mapped to the new row, before its group is sealed and checkpointed along with the offset of the record.
+func (store *InMemoryStore) upsert(partition int32, offset int64, timestamp time.Time, key []byte, value []byte) error {
+	if value == nil {
+		if key == nil {
+			return &DecodeError{Err: errors.New("a record without key and value can't be put into a store in table mode")}
+		}
+
+		rowKey := string(key)
+		if len(store.options.Key) > 0 {
+			rowKey = store.keys[string(key)]
+			delete(store.keys, string(key))
+		}
+
+		store.delete(rowKey)
+		return nil
+	}
+
+	rowKey, err := store.rowKey(key, value)
+	if err != nil {
+		return &DecodeError{Err: err}
+	}
+
+	replacement := location{group: store.evicted.Records + len(store.records), row: int(store.grouped)}
+	err = store.appendRow(partition, offset, timestamp, value)
+	if err != nil {
+		return err
+	}
+
+	store.delete(rowKey)
+	store.rows[rowKey] = replacement
+	if len(store.options.Key) > 0 && key != nil {
+		store.keys[string(key)] = rowKey
+	}
+
+	return store.sealFullGroup()
+}
+
+// rowKey returns the key identifying the row of value: the key of its record, or the json array of the values of the
+// key columns, which are then compared by their json representation.
+func (store *InMemoryStore) rowKey(key []byte, value []byte) (string, error) {
+	if len(store.options.Key) == 0 {
+		if key == nil {
+			return "", errors.New("a record without key can't be put into a store in table mode")
+		}
+
+		return string(key), nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(value, &fields); err != nil {
+		return "", err
+	}
+
+	columns := make([]json.RawMessage, len(store.options.Key))
+	for index, name := range store.options.Key {
+		columns[index] = fields[name]
+	}
+
+	encoded, err := json.Marshal(columns)
+	if err != nil {
+		return "", err
+	}
+
+	return string(encoded), nil
+}
+
+// delete flags the row of rowKey as deleted in a copy of the bitmap of its group, iterators keep reading the bitmap of
+// their snapshot.
+func (store *InMemoryStore) delete(rowKey string) {
+	row, ok := store.rows[rowKey]
+	if !ok {
+		return
+	}
+
+	delete(store.rows, rowKey)
+
+	index := row.group - store.evicted.Records
+	if index == len(store.records) {
+		store.deleted = withBit(store.deleted, row.row)
+	} else if index >= 0 {
+		store.records[index].deleted = withBit(store.records[index].deleted, row.row)
+	}
+}
+
+// withBit returns a copy of bitmap with the bit at index set.
+func withBit(bitmap []byte, index int) []byte {
+	size := int(bitutil.BytesForBits(int64(index + 1)))
+	if len(bitmap) > size {
+		size = len(bitmap)
+	}
+
+	copied := make([]byte, size)
+	copy(copied, bitmap)
+	bitutil.SetBit(copied, index)
+
+	return copied
+}
+
 func table(schema *arrow.Schema, records []arrow.Record) arrow.Table {
 	var table arrow.Table
 	table = array.NewTableFromRecords(schema, records)
@@ -107,32 +483,307 @@ func table(schema *arrow.Schema, records []arrow.Record) arrow.Table {
 	return table
 }
 
-func (store *InMemoryStore) inMemoryToRecords() (arrow.Record, error) {
-	builder := array.NewRecordBuilder(*store.allocator, store.schema)
-	defer builder.Release()
+// takeChunk moves the rows held by the builder to the chunks of the group being built.
+func (store *InMemoryStore) takeChunk() {
+	if store.built == 0 {
+		return
+	}
 
-	switch store.inputFormatType {
-	case Json:
-		for index := int32(0); index < store.bufferIndex; index++ {
-			err := builder.UnmarshalJSON(store.buffered[index])
-			if err != nil {
-				return nil, err
-			}
-		}
+	record := store.builder.NewRecord()
+	store.chunks = append(store.chunks, store.withMetadata(record))
+	record.Release()
+	store.built = 0
+	for _, enum := range store.enums {
+		enum.checked = 0
+	}
+}
+
+// discardPartialRow drops the row the builder failed to decode, its columns may already hold some of its values so
+// each of them is sliced to the rows which were fully decoded before being moved to the chunks.
+func (store *InMemoryStore) discardPartialRow() {
+	columns := make([]arrow.Array, len(store.schema.Fields()))
+	for index := range columns {
+		column := store.builder.Field(index).NewArray()
+		columns[index] = array.NewSlice(column, 0, store.built)
+		column.Release()
+	}
 
-		record := builder.NewRecord()
-		return record, nil
+	// the metadata builder holds the rows which were fully decoded only.
+	record := array.NewRecord(store.schema, columns, store.built)
+	if store.built > 0 {
+		store.chunks = append(store.chunks, store.withMetadata(record))
 	}
 
-	return nil, errors.New(fmt.Sprintf("unsupported inputFormatType: '%s'", store.inputFormatType))
+	record.Release()
+	for _, column := range columns {
+		column.Release()
+	}
+
+	// the dictionaries are reset as well to forget the value which may have been rejected for not being a symbol.
+	store.built = 0
+	for _, enum := range store.enums {
+		enum.builder.ResetFull()
+		enum.checked = 0
+	}
+}
+
+// withMetadata returns record followed by the metadata columns of its rows, which are taken out of the metadata builder.
+func (store *InMemoryStore) withMetadata(record arrow.Record) arrow.Record {
+	metadata := store.metadata.NewRecord()
+	defer metadata.Release()
+
+	columns := append(append([]arrow.Array{}, record.Columns()...), metadata.Columns()...)
+	return array.NewRecord(store.stored, columns, record.NumRows())
 }
 
+// flushBuffer seals the group being built as a record, it must be called with the lock held.
 func (store *InMemoryStore) flushBuffer() error {
-	record, err := store.inMemoryToRecords()
+	store.takeChunk()
+
+	ctx := compute.WithAllocator(context.Background(), *store.allocator)
+	record, err := engine.Concatenate(ctx, store.chunks)
 	if err != nil {
 		return err
 	}
 
-	store.records = append(store.records, record)
+	zones, err := newZoneMap(record, *store.allocator)
+	if err != nil {
+		record.Release()
+		return err
+	}
+
+	newest, err := newestTime(record, store.options.Retention.TimeColumn)
+	if err != nil || newest.IsZero() {
+		newest = store.newest
+	}
+
+	releaseRecords(store.chunks)
+	sealed := sealedRecord{record: record, deleted: store.deleted, newest: newest, rows: record.NumRows(), size: util.TotalRecordSize(record), zones: zones}
+	sealed.indexes = newIndexes(record, store.options.Indexes)
+	store.records = append(store.records, sealed)
+	store.chunks = nil
+	store.grouped = 0
+	store.deleted = nil
+	store.newest = time.Time{}
+
+	now := time.Now()
+	store.evict(now)
+	if _, err := store.tier(now); err != nil {
+		return err
+	}
+
+	offsets := make(map[int32]int64, len(store.offsets))
+	for partition, offset := range store.offsets {
+		offsets[partition] = offset
+	}
+
+	return store.checkpoint(offsets)
+}
+
+// checkpoint persists the sealed records along with offsets, when the store has a persistence, and makes offsets the
+// ones returned by Offsets once they are. The offsets are left as they were when the checkpoint fails, so the records
+// it would have persisted are put again when the store is restored.
+func (store *InMemoryStore) checkpoint(offsets map[int32]int64) error {
+	if store.persistence != nil {
+		if err := store.persistence.checkpoint(store, offsets); err != nil {
+			return err
+		}
+	}
+
+	store.sealedOffsets = offsets
 	return nil
 }
+
+// retain returns a copy of records holding a new reference to each of them.
+func retain(records []arrow.Record) []arrow.Record {
+	retained := make([]arrow.Record, len(records))
+	for index, record := range records {
+		record.Retain()
+		retained[index] = record
+	}
+
+	return retained
+}
+
+func releaseRecords(records []arrow.Record) {
+	for _, record := range records {
+		record.Release()
+	}
+}
+
+// Evict drops the sealed records out of the retention of the store at now, and moves the ones out of its tiering
+// bounds to the cold tier.
+func (store *InMemoryStore) Evict(now time.Time) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	evicted := store.evict(now)
+	tiered, err := store.tier(now)
+	if err != nil {
+		return err
+	}
+
+	if evicted || tiered {
+		return store.checkpoint(store.sealedOffsets)
+	}
+
+	return nil
+}
+
+func (store *InMemoryStore) RetentionState() RetentionState {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	state := RetentionState{
+		Retention: store.options.Retention,
+		Records:   len(store.records),
+		Rows:      int64(store.grouped),
+		Evicted:   store.evicted,
+	}
+
+	for _, sealed := range store.records {
+		state.Rows += sealed.rows
+		if sealed.record == nil {
+			state.ColdRecords += 1
+			state.ColdBytes += sealed.size
+		} else {
+			state.Bytes += sealed.size
+		}
+	}
+
+	if len(store.records) > 0 {
+		state.Oldest = store.records[0].newest
+	}
+
+	return state
+}
+
+// evict releases the oldest sealed records while they are out of the retention of the store, the iterators reading
+// them keep their own references, and returns whether any was. It must be called with the lock held.
+func (store *InMemoryStore) evict(now time.Time) bool {
+	retention := store.options.Retention
+
+	rows, size := int64(store.grouped), int64(0)
+	for _, sealed := range store.records {
+		rows += sealed.rows
+		size += sealed.size
+	}
+
+	count := 0
+	for _, sealed := range store.records {
+		expired := retention.MaxAge > 0 && sealed.newest.Before(now.Add(-retention.MaxAge))
+		tooManyRows := retention.MaxRows > 0 && rows > retention.MaxRows
+		tooManyBytes := retention.MaxBytes > 0 && size > retention.MaxBytes
+		if !expired && !tooManyRows && !tooManyBytes {
+			break
+		}
+
+		rows -= sealed.rows
+		size -= sealed.size
+
+		store.evicted.Records += 1
+		store.evicted.Rows += sealed.rows
+		store.evicted.Bytes += sealed.size
+		if sealed.record != nil {
+			sealed.record.Release()
+		}
+
+		sealed.zones.release()
+		count += 1
+	}
+
+	if count == 0 {
+		return false
+	}
+
+	store.records = append([]sealedRecord(nil), store.records[count:]...)
+	for rowKey, row := range store.rows {
+		if row.group < store.evicted.Records {
+			delete(store.rows, rowKey)
+		}
+	}
+
+	for key, rowKey := range store.keys {
+		if _, ok := store.rows[rowKey]; !ok {
+			delete(store.keys, key)
+		}
+	}
+
+	return true
+}
+
+// tier moves the oldest hot records to the cold tier while they are out of the tiering bounds of the store, the
+// iterators reading them keep their own references, and returns whether any was. It must be called with the lock held.
+func (store *InMemoryStore) tier(now time.Time) (bool, error) {
+	tiering := store.options.Tiering
+	if !tiering.enabled() || store.persistence == nil {
+		return false, nil
+	}
+
+	records, size := 0, int64(0)
+	for _, sealed := range store.records {
+		if sealed.record != nil {
+			records += 1
+			size += sealed.size
+		}
+	}
+
+	tiered := false
+	for index := range store.records {
+		sealed := &store.records[index]
+		if sealed.record == nil {
+			continue
+		}
+
+		expired := tiering.MaxHotAge > 0 && sealed.newest.Before(now.Add(-tiering.MaxHotAge))
+		tooManyRecords := tiering.MaxHotRecords > 0 && records > tiering.MaxHotRecords
+		tooManyBytes := tiering.MaxHotBytes > 0 && size > tiering.MaxHotBytes
+		if !expired && !tooManyRecords && !tooManyBytes {
+			break
+		}
+
+		path, fileSize, err := store.persistence.freeze(store.evicted.Records+index, sealed.record)
+		if err != nil {
+			return tiered, err
+		}
+
+		records -= 1
+		size -= sealed.size
+
+		sealed.record.Release()
+		sealed.record = nil
+		sealed.cold = path
+		sealed.size = fileSize
+		tiered = true
+	}
+
+	return tiered, nil
+}
+
+// validateOptions checks that options are supported by a store of schema.
+func validateOptions(schema *arrow.Schema, options Options) error {
+	switch options.Mode {
+	case "", Append:
+		if len(options.Key) > 0 {
+			return errors.New(fmt.Sprintf("key: %v requires mode: '%s'", options.Key, Table))
+		}
+	case Table:
+		for _, name := range options.Key {
+			if !schema.HasField(name) {
+				return errors.New(fmt.Sprintf("key column: '%s' does not exist", name))
+			}
+		}
+	default:
+		return errors.New(fmt.Sprintf("unsupported mode: '%s'", options.Mode))
+	}
+
+	if options.Tiering.MaxHotAge < 0 || options.Tiering.MaxHotRecords < 0 || options.Tiering.MaxHotBytes < 0 || options.Tiering.RowGroupSize < 0 {
+		return errors.New(fmt.Sprintf("tiering: %+v can't have negative bounds", options.Tiering))
+	}
+
+	if err := validateIndexes(schema, options.Indexes); err != nil {
+		return err
+	}
+
+	return validateRetention(schema, options.Retention)
+}
@@ -0,0 +1,292 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/RoaringBitmap/roaring"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/apache/arrow/go/v13/arrow/array"
+	"github.com/apache/arrow/go/v13/arrow/compute/exprs"
+	"github.com/substrait-io/substrait-go/expr"
+)
+
+type IndexKind string
+
+const (
+	// Hash maps each value to the list of the rows holding it, it suits the columns with many distinct values.
+	Hash IndexKind = "hash"
+	// Bitmap maps each value to a roaring bitmap of the rows holding it, it suits the columns with few distinct values.
+	Bitmap IndexKind = "bitmap"
+)
+
+// Index declares an index of the sealed records of a store on one of its columns, the iterators only read the rows of
+// the indexed records holding the values a predicate compares the column with for equality.
+type Index struct {
+	Column string    `yaml:"column" json:"column"`
+	Kind   IndexKind `yaml:"kind" json:"kind"`
+}
+
+// columnIndex maps the values of a column of a sealed record to the rows holding them, the values being keyed by
+// indexKey once decoded to dataType.
+type columnIndex struct {
+	dataType arrow.DataType
+	hashes   map[string][]uint32
+	bitmaps  map[string]*roaring.Bitmap
+}
+
+// newIndexes builds the indexes declared by indexes over the columns of record, by column.
+func newIndexes(record arrow.Record, indexes []Index) map[int]columnIndex {
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	built := make(map[int]columnIndex, len(indexes))
+	for _, declared := range indexes {
+		column := record.Schema().FieldIndices(declared.Column)[0]
+		built[column] = newColumnIndex(record.Column(column), declared.Kind)
+	}
+
+	return built
+}
+
+func newColumnIndex(column arrow.Array, kind IndexKind) columnIndex {
+	index := columnIndex{dataType: valueType(column.DataType())}
+	if kind == Bitmap {
+		index.bitmaps = make(map[string]*roaring.Bitmap)
+	} else {
+		index.hashes = make(map[string][]uint32)
+	}
+
+	for row := 0; row < column.Len(); row++ {
+		if column.IsNull(row) {
+			continue
+		}
+
+		key := indexKey(column, row)
+		if index.bitmaps == nil {
+			index.hashes[key] = append(index.hashes[key], uint32(row))
+			continue
+		}
+
+		rows, ok := index.bitmaps[key]
+		if !ok {
+			rows = roaring.New()
+			index.bitmaps[key] = rows
+		}
+
+		rows.Add(uint32(row))
+	}
+
+	for _, rows := range index.bitmaps {
+		rows.RunOptimize()
+	}
+
+	return index
+}
+
+// lookup returns the rows holding the value keyed by key.
+func (index columnIndex) lookup(key string) *roaring.Bitmap {
+	if index.bitmaps == nil {
+		return roaring.BitmapOf(index.hashes[key]...)
+	}
+
+	if rows, ok := index.bitmaps[key]; ok {
+		return rows.Clone()
+	}
+
+	return roaring.New()
+}
+
+// selection returns the rows of a record which may satisfy the predicate according to the indexes of its columns, or
+// nil when none of the conjuncts of the predicate can be answered by them.
+func (predicate *Predicate) selection(indexes map[int]columnIndex, width int) *roaring.Bitmap {
+	if predicate == nil || len(indexes) == 0 {
+		return nil
+	}
+
+	var selected *roaring.Bitmap
+	for _, condition := range predicate.conditions {
+		for _, conjunct := range conjuncts(condition) {
+			rows, err := lookup(predicate.ctx, indexes, width, conjunct)
+			if err != nil {
+				continue
+			}
+
+			if selected == nil {
+				selected = rows
+			} else {
+				selected.And(rows)
+			}
+		}
+	}
+
+	return selected
+}
+
+// lookup returns the rows which may satisfy condition according to indexes: the rows holding the constant an indexed
+// column is compared with for equality, or the rows of any of the conditions combined by an or function. It fails for
+// the other conditions.
+func lookup(ctx context.Context, indexes map[int]columnIndex, width int, condition expr.Expression) (*roaring.Bitmap, error) {
+	function, ok := condition.(*expr.ScalarFunction)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("condition: '%s' can't be answered by an index", condition))
+	}
+
+	switch functionName(function) {
+	case "or":
+		rows := roaring.New()
+		for i := 0; i < function.NArgs(); i++ {
+			argument, ok := function.Arg(i).(expr.Expression)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("condition: '%s' can't be answered by an index", condition))
+			}
+
+			matching, err := lookup(ctx, indexes, width, argument)
+			if err != nil {
+				return nil, err
+			}
+
+			rows.Or(matching)
+		}
+
+		return rows, nil
+	case "equal":
+		if function.NArgs() == 2 {
+			return lookupEquality(ctx, indexes, width, function)
+		}
+	}
+
+	return nil, errors.New(fmt.Sprintf("condition: '%s' can't be answered by an index", condition))
+}
+
+// lookupEquality returns the rows holding the constant the indexed column compared by equality is compared with.
+func lookupEquality(ctx context.Context, indexes map[int]columnIndex, width int, equality *expr.ScalarFunction) (*roaring.Bitmap, error) {
+	left, right := equality.Arg(0), equality.Arg(1)
+	column, cast, ok := columnOperand(left, width)
+	if !ok {
+		column, cast, ok = columnOperand(right, width)
+		right = left
+	}
+
+	index, indexed := indexes[column]
+	constant, isExpression := right.(expr.Expression)
+	if !ok || !indexed || !isExpression || !isConstant(constant) {
+		return nil, errors.New(fmt.Sprintf("condition: '%s' can't be answered by an index", equality))
+	}
+
+	// the column may only be cast to a type holding each of its values as a distinct value.
+	if cast != nil {
+		dataType, _, err := exprs.FromSubstraitType(cast.Type, exprs.GetExtensionIDSet(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		if !injective(index.dataType, dataType) {
+			return nil, errors.New(fmt.Sprintf("cast from: '%s' to: '%s' may merge distinct values", index.dataType, dataType))
+		}
+	}
+
+	value, err := constantValue(ctx, constant, index.dataType)
+	if err != nil {
+		return nil, err
+	}
+
+	defer value.Release()
+
+	// an equality with a null is never satisfied.
+	if value.IsNull(0) {
+		return roaring.New(), nil
+	}
+
+	return index.lookup(indexKey(value, 0)), nil
+}
+
+// indexKey returns the key of the value at row of column, decoded from its dictionary or extension.
+func indexKey(column arrow.Array, row int) string {
+	switch c := column.(type) {
+	case *array.Dictionary:
+		return indexKey(c.Dictionary(), c.GetValueIndex(row))
+	case array.ExtensionArray:
+		return indexKey(c.Storage(), row)
+	case *array.String:
+		return c.Value(row)
+	}
+
+	return column.ValueStr(row)
+}
+
+// valueType returns the type of the values of dataType, decoded from its dictionary or extension.
+func valueType(dataType arrow.DataType) arrow.DataType {
+	switch t := dataType.(type) {
+	case *arrow.DictionaryType:
+		return valueType(t.ValueType)
+	case arrow.ExtensionType:
+		return valueType(t.StorageType())
+	}
+
+	return dataType
+}
+
+// indexable returns whether the values of dataType can be indexed, the floating point values are not as their equality
+// differs from the one of their keys.
+func indexable(dataType arrow.DataType) bool {
+	switch valueType(dataType).ID() {
+	case arrow.BOOL, arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64, arrow.UINT8, arrow.UINT16, arrow.UINT32,
+		arrow.UINT64, arrow.STRING, arrow.BINARY, arrow.FIXED_SIZE_BINARY, arrow.DECIMAL128, arrow.TIMESTAMP,
+		arrow.DATE32, arrow.TIME32, arrow.TIME64, arrow.DURATION:
+		return true
+	}
+
+	return false
+}
+
+// injective returns whether the cast from the type from to the type to maps distinct values to distinct values.
+func injective(from arrow.DataType, to arrow.DataType) bool {
+	if arrow.TypeEqual(from, to) {
+		return true
+	}
+
+	switch {
+	case arrow.IsInteger(from.ID()) && arrow.IsInteger(to.ID()):
+		fromWidth, toWidth := from.(arrow.FixedWidthDataType).BitWidth(), to.(arrow.FixedWidthDataType).BitWidth()
+		if arrow.IsSignedInteger(from.ID()) == arrow.IsSignedInteger(to.ID()) {
+			return toWidth >= fromWidth
+		}
+
+		return arrow.IsUnsignedInteger(from.ID()) && toWidth > fromWidth
+	case from.ID() == arrow.TIMESTAMP && to.ID() == arrow.TIMESTAMP:
+		return from.(*arrow.TimestampType).Unit == to.(*arrow.TimestampType).Unit
+	case from.ID() == arrow.STRING && to.ID() == arrow.LARGE_STRING:
+		return true
+	}
+
+	return false
+}
+
+// validateIndexes checks that indexes declares at most one index per column of schema.
+func validateIndexes(schema *arrow.Schema, indexes []Index) error {
+	indexed := make(map[string]bool)
+	for _, index := range indexes {
+		fields := schema.FieldIndices(index.Column)
+		if len(fields) == 0 {
+			return errors.New(fmt.Sprintf("index column: '%s' does not exist", index.Column))
+		}
+
+		if index.Kind != Hash && index.Kind != Bitmap {
+			return errors.New(fmt.Sprintf("index kind: '%s' of column: '%s' is not supported, expecting '%s' or '%s'", index.Kind, index.Column, Hash, Bitmap))
+		}
+
+		if dataType := schema.Field(fields[0]).Type; !indexable(dataType) {
+			return errors.New(fmt.Sprintf("index column: '%s' of type: '%s' can't be indexed", index.Column, dataType))
+		}
+
+		if indexed[index.Column] {
+			return errors.New(fmt.Sprintf("index column: '%s' is indexed twice", index.Column))
+		}
+
+		indexed[index.Column] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,297 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/apache/arrow/go/v13/arrow/array"
+	"github.com/apache/arrow/go/v13/arrow/compute/exprs"
+	"github.com/exsql-io/go-datastore/common"
+	"github.com/goccy/go-json"
+	"github.com/substrait-io/substrait-go/extensions"
+	"github.com/substrait-io/substrait-go/types"
+	"golang.org/x/exp/slices"
+	"sync"
+	"time"
+)
+
+// logicalTypesURI identifies the type variations declared for the logical types without substrait equivalent.
+const logicalTypesURI = "https://github.com/exsql-io/go-datastore/blob/main/extensions/logical_types.yaml"
+
+// maxDecimalPrecision is the number of digits of the widest decimals stored as 128 bits integers.
+const maxDecimalPrecision = 38
+
+// symbolsKey is the key of the metadata of the enum fields listing their symbols.
+const symbolsKey = "symbols"
+
+// typeVariationsLock guards the registration of the type variations, see typeVariation.
+var typeVariationsLock sync.Mutex
+
+func init() {
+	err := arrow.RegisterExtensionType(NewUuidType())
+	if err != nil {
+		panic(err)
+	}
+}
+
+func toTimeUnit(unit common.TimeUnit) (arrow.TimeUnit, error) {
+	switch unit {
+	case common.Seconds:
+		return arrow.Second, nil
+	case common.Milliseconds:
+		return arrow.Millisecond, nil
+	case common.Microseconds, "":
+		return arrow.Microsecond, nil
+	case common.Nanoseconds:
+		return arrow.Nanosecond, nil
+	}
+
+	return 0, errors.New(fmt.Sprintf("unit: '%s' is not one of 's', 'ms', 'us' or 'ns'", unit))
+}
+
+func toLogicalArrowType(tpe common.Type) (arrow.DataType, error) {
+	switch tpe.Name {
+	case common.TimestampType:
+		unit, err := toTimeUnit(tpe.Unit)
+		if err != nil {
+			return nil, err
+		}
+
+		if tpe.Timezone != "" {
+			if _, err := time.LoadLocation(tpe.Timezone); err != nil {
+				return nil, errors.New(fmt.Sprintf("timezone: '%s' is not valid: %s", tpe.Timezone, err))
+			}
+		}
+
+		return &arrow.TimestampType{Unit: unit, TimeZone: tpe.Timezone}, nil
+	case common.DateType:
+		return arrow.FixedWidthTypes.Date32, nil
+	case common.TimeType:
+		unit, err := toTimeUnit(tpe.Unit)
+		if err != nil {
+			return nil, err
+		}
+
+		if unit == arrow.Second || unit == arrow.Millisecond {
+			return &arrow.Time32Type{Unit: unit}, nil
+		}
+
+		return &arrow.Time64Type{Unit: unit}, nil
+	case common.DurationType:
+		unit, err := toTimeUnit(tpe.Unit)
+		if err != nil {
+			return nil, err
+		}
+
+		return &arrow.DurationType{Unit: unit}, nil
+	case common.DecimalType:
+		if tpe.Precision < 1 || tpe.Precision > maxDecimalPrecision {
+			return nil, errors.New(fmt.Sprintf("precision: %d of type: 'decimal' must be between 1 and %d", tpe.Precision, maxDecimalPrecision))
+		}
+
+		if tpe.Scale < 0 || tpe.Scale > tpe.Precision {
+			return nil, errors.New(fmt.Sprintf("scale: %d of type: 'decimal' must be between 0 and its precision", tpe.Scale))
+		}
+
+		return &arrow.Decimal128Type{Precision: tpe.Precision, Scale: tpe.Scale}, nil
+	case common.UuidType:
+		return NewUuidType(), nil
+	case common.EnumType:
+		if len(tpe.Symbols) == 0 {
+			return nil, errors.New("type: 'enum' requires at least one symbol")
+		}
+
+		return &arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Int32, ValueType: arrow.BinaryTypes.String}, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("type: '%s' is not yet convertible to arrow type", tpe.Name))
+}
+
+// toMetadata returns the metadata of a field of type tpe, the symbols of an enum are kept in the metadata of its field
+// as arrow dictionaries do not restrict their values.
+func toMetadata(tpe common.Type) arrow.Metadata {
+	if tpe.Name != common.EnumType {
+		return arrow.Metadata{}
+	}
+
+	symbols, _ := json.Marshal(tpe.Symbols)
+	return arrow.NewMetadata([]string{symbolsKey}, []string{string(symbols)})
+}
+
+// enumBuilder checks that the values appended to the builder of an enum field are symbols of the enum.
+type enumBuilder struct {
+	field   string
+	symbols []string
+	builder *array.BinaryDictionaryBuilder
+	checked int
+}
+
+// enumBuilders returns the builders of the enum fields found in builder, the builder of field, and in the builders
+// nested in it.
+func enumBuilders(field arrow.Field, builder array.Builder) ([]*enumBuilder, error) {
+	switch b := builder.(type) {
+	case *array.BinaryDictionaryBuilder:
+		index := field.Metadata.FindKey(symbolsKey)
+		if index < 0 {
+			return nil, nil
+		}
+
+		var symbols []string
+		if err := json.Unmarshal([]byte(field.Metadata.Values()[index]), &symbols); err != nil {
+			return nil, err
+		}
+
+		return []*enumBuilder{{field: field.Name, symbols: symbols, builder: b}}, nil
+	case *array.StructBuilder:
+		var builders []*enumBuilder
+		for i, child := range field.Type.(*arrow.StructType).Fields() {
+			nested, err := enumBuilders(child, b.FieldBuilder(i))
+			if err != nil {
+				return nil, err
+			}
+
+			builders = append(builders, nested...)
+		}
+
+		return builders, nil
+	case *array.ListBuilder:
+		return enumBuilders(field.Type.(*arrow.ListType).ElemField(), b.ValueBuilder())
+	}
+
+	return nil, nil
+}
+
+// validate checks the values appended to the builder since the last validation.
+func (enum *enumBuilder) validate() error {
+	for ; enum.checked < enum.builder.Len(); enum.checked++ {
+		if enum.builder.IsNull(enum.checked) {
+			continue
+		}
+
+		value := enum.builder.ValueStr(enum.builder.GetValueIndex(enum.checked))
+		if !slices.Contains(enum.symbols, value) {
+			return errors.New(fmt.Sprintf("value: '%s' of field: '%s' is not one of the symbols: %v", value, enum.field, enum.symbols))
+		}
+	}
+
+	return nil
+}
+
+// toSubstraitType maps an arrow type to a substrait type. The arrow types without substrait equivalent, such as
+// timestamps which are not in microseconds or enums, are mapped to a type variation of the closest substrait type, see
+// typeVariation.
+func toSubstraitType(dataType arrow.DataType, nullable bool) (types.Type, error) {
+	nullability := types.NullabilityRequired
+	if nullable {
+		nullability = types.NullabilityNullable
+	}
+
+	switch t := dataType.(type) {
+	case *arrow.TimestampType:
+		var variation uint32
+		if t.Unit != arrow.Microsecond || (t.TimeZone != "" && t.TimeZone != exprs.TimestampTzTimezone) {
+			var err error
+			if variation, err = typeVariation(t); err != nil {
+				return nil, err
+			}
+		}
+
+		if t.TimeZone == "" {
+			return &types.TimestampType{Nullability: nullability, TypeVariationRef: variation}, nil
+		}
+
+		return &types.TimestampTzType{Nullability: nullability, TypeVariationRef: variation}, nil
+	case *arrow.Time32Type, *arrow.Time64Type:
+		var variation uint32
+		if !arrow.TypeEqual(t, arrow.FixedWidthTypes.Time64us) {
+			var err error
+			if variation, err = typeVariation(t); err != nil {
+				return nil, err
+			}
+		}
+
+		return &types.TimeType{Nullability: nullability, TypeVariationRef: variation}, nil
+	case *arrow.DurationType:
+		variation, err := typeVariation(t)
+		if err != nil {
+			return nil, err
+		}
+
+		return &types.Int64Type{Nullability: nullability, TypeVariationRef: variation}, nil
+	case *arrow.DictionaryType:
+		if !arrow.TypeEqual(t.ValueType, arrow.BinaryTypes.String) {
+			break
+		}
+
+		variation, err := typeVariation(t)
+		if err != nil {
+			return nil, err
+		}
+
+		return &types.StringType{Nullability: nullability, TypeVariationRef: variation}, nil
+	case *UuidType:
+		variation, err := typeVariation(t)
+		if err != nil {
+			return nil, err
+		}
+
+		return &types.UUIDType{Nullability: nullability, TypeVariationRef: variation}, nil
+	case *arrow.StructType:
+		fieldTypes := make([]types.Type, len(t.Fields()))
+		for i, field := range t.Fields() {
+			fieldType, err := toSubstraitType(field.Type, field.Nullable)
+			if err != nil {
+				return nil, err
+			}
+
+			fieldTypes[i] = fieldType
+		}
+
+		return &types.StructType{Nullability: nullability, Types: fieldTypes}, nil
+	case *arrow.ListType:
+		elementType, err := toSubstraitType(t.Elem(), t.ElemField().Nullable)
+		if err != nil {
+			return nil, err
+		}
+
+		return &types.ListType{Nullability: nullability, Type: elementType}, nil
+	}
+
+	return exprs.ToSubstraitType(dataType, nullable, typeVariations)
+}
+
+// typeVariation returns the anchor of the type variation standing for dataType, registering it the first time the type
+// is met. Anchors are never reused so that plans built before a registration remain valid.
+func typeVariation(dataType arrow.DataType) (uint32, error) {
+	if _, ok := exprs.DefaultExtensionIDRegistry.GetIDByType(dataType); !ok {
+		err := exprs.DefaultExtensionIDRegistry.RegisterType(extensions.ID{URI: logicalTypesURI, Name: dataType.String()}, dataType)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, anchor, ok := typeVariations.EncodeTypeVariation(dataType)
+	if !ok {
+		return 0, errors.New(fmt.Sprintf("type: '%s' has no type variation", dataType))
+	}
+
+	return anchor, nil
+}
+
+// LogicalType returns the arrow type of the logical type standing behind the type variation of t, it returns false
+// when t is not a type variation or is the variation of an unsigned integer.
+func LogicalType(t types.Type) (arrow.DataType, bool) {
+	if t.GetTypeVariationReference() == 0 {
+		return nil, false
+	}
+
+	typeVariationsLock.Lock()
+	defer typeVariationsLock.Unlock()
+
+	_, dataType, ok := typeVariations.DecodeTypeArrow(t.GetTypeVariationReference())
+	if !ok || arrow.IsUnsignedInteger(dataType.ID()) {
+		return nil, false
+	}
+
+	return dataType, true
+}
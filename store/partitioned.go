@@ -0,0 +1,397 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/apache/arrow/go/v13/arrow/memory"
+	"github.com/exsql-io/go-datastore/common"
+	"github.com/exsql-io/go-datastore/engine"
+	"github.com/substrait-io/substrait-go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// partitionPrefix is the prefix of the sub-directories holding the partitions of a PartitionedStore persisted to disk.
+const partitionPrefix = "partition-"
+
+// ReadAhead is the number of batches the iterator of a PartitionedStore reads ahead of the caller in each partition.
+var ReadAhead = 4
+
+// PartitionedStore holds the rows of each partition in a store of its own, created as the partition is first put into,
+// so the values of distinct partitions are decoded and sealed in parallel. Its iterators read the partitions
+// concurrently and return them one after the other, from the lowest partition, each in the order of its offsets, unless
+// the scan reads them in any order, in which case their batches are merged as they are read.
+//
+// The retention and the tiering bounds apply to each partition. In Table mode, the rows of a key are expected to be put
+// into a single partition, as the records of a topic are partitioned by their key.
+type PartitionedStore struct {
+	lock         sync.RWMutex
+	schema       *arrow.Schema
+	namedStruct  types.NamedStruct
+	options      Options
+	partitions   map[int32]Store
+	newPartition func(partition int32) (Store, error)
+}
+
+// newPartitionedStore returns a PartitionedStore of schema, checking options against it, which partitions are created
+// by newPartition.
+func newPartitionedStore(allocator *memory.Allocator, inputFormatType InputFormatType, schema *common.Schema, options Options, newPartition func(partition int32) (Store, error)) (*PartitionedStore, error) {
+	// the options are checked by a store which is dropped right away as the partitions are created lazily.
+	template, err := newInMemoryStore(allocator, inputFormatType, schema, options)
+	if err != nil {
+		return nil, err
+	}
+
+	template.Close()
+
+	store := &PartitionedStore{
+		schema:       template.schema,
+		namedStruct:  template.namedStruct,
+		options:      options,
+		partitions:   make(map[int32]Store),
+		newPartition: newPartition,
+	}
+
+	return store, nil
+}
+
+// newPartitionedDiskStore returns a PartitionedStore persisted to directory, each partition in a DiskStore of its own
+// sub-directory, restored from them when it holds any.
+func newPartitionedDiskStore(allocator *memory.Allocator, inputFormatType InputFormatType, schema *common.Schema, options Options, directory string) (*PartitionedStore, error) {
+	store, err := newPartitionedStore(allocator, inputFormatType, schema, options, func(partition int32) (Store, error) {
+		diskStore, err := NewDiskStore(allocator, inputFormatType, schema, options, filepath.Join(directory, partitionPrefix+strconv.Itoa(int(partition))))
+		if err != nil {
+			return nil, err
+		}
+
+		return *diskStore, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(filepath.Join(directory, checkpointFileName)); err == nil {
+		return nil, errors.New(fmt.Sprintf("directory: '%s' holds a store which is not partitioned", directory))
+	}
+
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		partition, err := strconv.ParseInt(strings.TrimPrefix(entry.Name(), partitionPrefix), 10, 32)
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), partitionPrefix) || err != nil {
+			continue
+		}
+
+		if _, err := store.partition(int32(partition)); err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
+
+	return store, nil
+}
+
+// Put puts the value into the store of partition, the puts of distinct partitions run in parallel.
+func (store *PartitionedStore) Put(partition int32, offset int64, timestamp time.Time, key []byte, value []byte) error {
+	partitionStore, err := store.partition(partition)
+	if err != nil {
+		return err
+	}
+
+	return partitionStore.Put(partition, offset, timestamp, key, value)
+}
+
+// partition returns the store of partition, created when it does not exist yet.
+func (store *PartitionedStore) partition(partition int32) (Store, error) {
+	store.lock.RLock()
+	partitionStore, ok := store.partitions[partition]
+	store.lock.RUnlock()
+	if ok {
+		return partitionStore, nil
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if partitionStore, ok := store.partitions[partition]; ok {
+		return partitionStore, nil
+	}
+
+	partitionStore, err := store.newPartition(partition)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("store of partition: %d can't be created: %s", partition, err))
+	}
+
+	store.partitions[partition] = partitionStore
+	return partitionStore, nil
+}
+
+// sorted returns the stores of the partitions from the lowest partition.
+func (store *PartitionedStore) sorted() []Store {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	partitions := make([]int32, 0, len(store.partitions))
+	for partition := range store.partitions {
+		partitions = append(partitions, partition)
+	}
+
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+
+	stores := make([]Store, len(partitions))
+	for index, partition := range partitions {
+		stores[index] = store.partitions[partition]
+	}
+
+	return stores
+}
+
+// Iterator returns an iterator over the snapshots of the partitions, each taken when the iterator is created, which
+// reads them concurrently. The partitions are returned from the lowest one, or from the highest one when the scan reads
+// them backward, and their batches are returned as they are read when the scan reads them in any order.
+func (store *PartitionedStore) Iterator(scan Scan) (*engine.CloseableIterator, error) {
+	if err := validateScan(store.schema, scan); err != nil {
+		return nil, err
+	}
+
+	partitions := store.sorted()
+	if scan.Order == Backward {
+		for left, right := 0, len(partitions)-1; left < right; left, right = left+1, right-1 {
+			partitions[left], partitions[right] = partitions[right], partitions[left]
+		}
+	}
+
+	iterators := make([]engine.CloseableIterator, 0, len(partitions))
+	for _, partition := range partitions {
+		iterator, err := partition.Iterator(scan)
+		if err != nil {
+			for _, created := range iterators {
+				created.Close()
+			}
+
+			return nil, err
+		}
+
+		iterators = append(iterators, *iterator)
+	}
+
+	var iterator engine.CloseableIterator
+	iterator = newParallelIterator(iterators, scan.Order == Any)
+
+	return &iterator, nil
+}
+
+func (store *PartitionedStore) Close() {
+	for _, partition := range store.sorted() {
+		partition.Close()
+	}
+}
+
+func (store *PartitionedStore) Schema() *arrow.Schema {
+	return store.schema
+}
+
+func (store *PartitionedStore) NamedStruct() types.NamedStruct {
+	return store.namedStruct
+}
+
+// Evict evicts the records out of the retention of each partition, it stops at the first partition failing to.
+func (store *PartitionedStore) Evict(now time.Time) error {
+	for _, partition := range store.sorted() {
+		if err := partition.Evict(now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RetentionState sums the retention states of the partitions, Oldest being the one of the oldest partition.
+func (store *PartitionedStore) RetentionState() RetentionState {
+	state := RetentionState{Retention: store.options.Retention}
+	for _, partition := range store.sorted() {
+		partitionState := partition.RetentionState()
+		state.Records += partitionState.Records
+		state.Rows += partitionState.Rows
+		state.Bytes += partitionState.Bytes
+		state.ColdRecords += partitionState.ColdRecords
+		state.ColdBytes += partitionState.ColdBytes
+		state.Evicted.Records += partitionState.Evicted.Records
+		state.Evicted.Rows += partitionState.Evicted.Rows
+		state.Evicted.Bytes += partitionState.Evicted.Bytes
+		if !partitionState.Oldest.IsZero() && (state.Oldest.IsZero() || partitionState.Oldest.Before(state.Oldest)) {
+			state.Oldest = partitionState.Oldest
+		}
+	}
+
+	return state
+}
+
+// Offsets returns the offsets held durably by the store of each partition.
+func (store *PartitionedStore) Offsets() map[int32]int64 {
+	offsets := make(map[int32]int64)
+	for _, partition := range store.sorted() {
+		for partition, offset := range partition.Offsets() {
+			offsets[partition] = offset
+		}
+	}
+
+	return offsets
+}
+
+// Reset resets the store of each partition, it stops at the first partition failing to.
+func (store *PartitionedStore) Reset() error {
+	for _, partition := range store.sorted() {
+		if err := partition.Reset(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parallelIterator reads each of its iterators in a goroutine of its own, up to ReadAhead batches ahead of the caller,
+// and returns their batches one iterator after the other, or in the order they are read when they are merged.
+type parallelIterator struct {
+	batches  []chan parallelBatch
+	position int
+	current  arrow.Record
+	err      error
+	done     chan struct{}
+	wait     sync.WaitGroup
+}
+
+// parallelBatch is a batch read by a parallelIterator, or the error its iterator stopped on.
+type parallelBatch struct {
+	record arrow.Record
+	err    error
+}
+
+func newParallelIterator(iterators []engine.CloseableIterator, merged bool) *parallelIterator {
+	iterator := &parallelIterator{done: make(chan struct{})}
+	if merged {
+		batches := make(chan parallelBatch, ReadAhead*len(iterators))
+		iterator.batches = []chan parallelBatch{batches}
+		for _, source := range iterators {
+			iterator.wait.Add(1)
+			go func(source engine.CloseableIterator) {
+				defer iterator.wait.Done()
+				iterator.read(source, batches)
+			}(source)
+		}
+
+		go func() {
+			iterator.wait.Wait()
+			close(batches)
+		}()
+
+		return iterator
+	}
+
+	for _, source := range iterators {
+		batches := make(chan parallelBatch, ReadAhead)
+		iterator.batches = append(iterator.batches, batches)
+		iterator.wait.Add(1)
+		go func(source engine.CloseableIterator) {
+			defer iterator.wait.Done()
+			defer close(batches)
+			iterator.read(source, batches)
+		}(source)
+	}
+
+	return iterator
+}
+
+// read sends the batches of source to batches, retained, until its end or until the iterator is closed.
+func (iterator *parallelIterator) read(source engine.CloseableIterator, batches chan parallelBatch) {
+	defer source.Close()
+
+	for source.Next() {
+		record := *source.Value()
+		record.Retain()
+		select {
+		case batches <- parallelBatch{record: record}:
+		case <-iterator.done:
+			record.Release()
+			return
+		}
+	}
+
+	if fallible, ok := source.(engine.FallibleIterator); ok && fallible.Err() != nil {
+		select {
+		case batches <- parallelBatch{err: fallible.Err()}:
+		case <-iterator.done:
+		}
+	}
+}
+
+func (iterator *parallelIterator) Next() bool {
+	iterator.releaseCurrent()
+	for iterator.position < len(iterator.batches) && iterator.err == nil {
+		batch, ok := <-iterator.batches[iterator.position]
+		if !ok {
+			iterator.position += 1
+			continue
+		}
+
+		if batch.err != nil {
+			iterator.err = batch.err
+			return false
+		}
+
+		iterator.current = batch.record
+		return true
+	}
+
+	return false
+}
+
+func (iterator *parallelIterator) Value() engine.ColumnarBatch {
+	return &iterator.current
+}
+
+// Err returns the error which stopped the iterator of a partition.
+func (iterator *parallelIterator) Err() error {
+	return iterator.err
+}
+
+// Close stops the goroutines reading the iterators and releases the batches they read ahead.
+func (iterator *parallelIterator) Close() {
+	iterator.releaseCurrent()
+	if iterator.batches == nil {
+		return
+	}
+
+	close(iterator.done)
+	iterator.wait.Wait()
+	for _, batches := range iterator.batches {
+		for batch := range batches {
+			if batch.record != nil {
+				batch.record.Release()
+			}
+		}
+	}
+
+	iterator.batches = nil
+}
+
+func (iterator *parallelIterator) releaseCurrent() {
+	if iterator.current != nil {
+		iterator.current.Release()
+		iterator.current = nil
+	}
+}
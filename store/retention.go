@@ -0,0 +1,99 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/apache/arrow/go/v13/arrow/array"
+	"time"
+)
+
+// Retention bounds the sealed records kept by a store, the oldest records are evicted as a whole as soon as any of the
+// set bounds is exceeded.
+type Retention struct {
+	// MaxAge is compared to the latest time of the rows of each record: the values of TimeColumn, a timestamp or a long
+	// holding epoch milliseconds, or the timestamps of the records put when TimeColumn is empty.
+	MaxAge     time.Duration `yaml:"maxAge" json:"maxAge"`
+	TimeColumn string        `yaml:"timeColumn" json:"timeColumn,omitempty"`
+	MaxRows    int64         `yaml:"maxRows" json:"maxRows,omitempty"`
+	// MaxBytes bounds the size of the records in both tiers: in memory for the hot records and of their parquet files
+	// for the cold ones.
+	MaxBytes int64 `yaml:"maxBytes" json:"maxBytes,omitempty"`
+}
+
+// Evictions counts the records evicted from a store, along with their rows and bytes, in the tier they were evicted from.
+type Evictions struct {
+	Records int   `json:"records"`
+	Rows    int64 `json:"rows"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// RetentionState describes the records kept by a store, the rows not sealed yet included, and the ones evicted so far.
+// Bytes is the size in memory of the hot records, the ones bounded by MaxBytes being those of both tiers.
+type RetentionState struct {
+	Retention Retention `json:"retention"`
+	Records   int       `json:"records"`
+	Rows      int64     `json:"rows"`
+	Bytes     int64     `json:"bytes"`
+	// ColdRecords counts the records, among Records, which were moved to the cold tier, ColdBytes is the size of their
+	// parquet files.
+	ColdRecords int   `json:"coldRecords"`
+	ColdBytes   int64 `json:"coldBytes"`
+	// Oldest is the latest time of the rows of the oldest record, the next one to be evicted.
+	Oldest  time.Time `json:"oldest"`
+	Evicted Evictions `json:"evicted"`
+}
+
+func validateRetention(schema *arrow.Schema, retention Retention) error {
+	if retention.MaxAge < 0 || retention.MaxRows < 0 || retention.MaxBytes < 0 {
+		return errors.New(fmt.Sprintf("retention: %+v can't have negative bounds", retention))
+	}
+
+	if retention.TimeColumn == "" {
+		return nil
+	}
+
+	indices := schema.FieldIndices(retention.TimeColumn)
+	if len(indices) == 0 {
+		return errors.New(fmt.Sprintf("time column: '%s' does not exist", retention.TimeColumn))
+	}
+
+	switch schema.Field(indices[0]).Type.ID() {
+	case arrow.TIMESTAMP, arrow.INT64:
+		return nil
+	}
+
+	return errors.New(fmt.Sprintf("time column: '%s' is neither a timestamp nor a long", retention.TimeColumn))
+}
+
+// newestTime returns the latest time found in the column named timeColumn of record, the zero time when there is no
+// such column or when it only holds nulls.
+func newestTime(record arrow.Record, timeColumn string) (time.Time, error) {
+	indices := record.Schema().FieldIndices(timeColumn)
+	if timeColumn == "" || len(indices) == 0 {
+		return time.Time{}, nil
+	}
+
+	var newest time.Time
+	switch column := record.Column(indices[0]).(type) {
+	case *array.Timestamp:
+		toTime, err := column.DataType().(*arrow.TimestampType).GetToTimeFunc()
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		for i := 0; i < column.Len(); i++ {
+			if column.IsValid(i) && toTime(column.Value(i)).After(newest) {
+				newest = toTime(column.Value(i))
+			}
+		}
+	case *array.Int64:
+		for i := 0; i < column.Len(); i++ {
+			if column.IsValid(i) && time.UnixMilli(column.Value(i)).After(newest) {
+				newest = time.UnixMilli(column.Value(i))
+			}
+		}
+	}
+
+	return newest, nil
+}
@@ -0,0 +1,216 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/apache/arrow/go/v13/arrow/array"
+	"time"
+)
+
+// the metadata columns follow the columns of the schema in the records of a store, they hold the partition, the offset
+// and the timestamp, in epoch milliseconds, of the record each row was put from.
+const (
+	partitionColumn = "__partition"
+	offsetColumn    = "__offset"
+	timestampColumn = "__timestamp"
+)
+
+var metadataFields = []arrow.Field{
+	{Name: partitionColumn, Type: arrow.PrimitiveTypes.Int32},
+	{Name: offsetColumn, Type: arrow.PrimitiveTypes.Int64},
+	{Name: timestampColumn, Type: arrow.PrimitiveTypes.Int64},
+}
+
+type Order string
+
+const (
+	// Forward reads the rows from the oldest to the newest, in the order they were put.
+	Forward Order = "forward"
+	// Backward reads the rows from the newest to the oldest.
+	Backward Order = "backward"
+	// Any reads the rows in no particular order: the batches of the partitions of a PartitionedStore are returned as
+	// soon as they are read, each partition in the order of its offsets, the other stores reading forward.
+	Any Order = "any"
+)
+
+// Scan selects the rows an iterator reads and their order, its zero value reads every row of the store from the oldest
+// to the newest.
+type Scan struct {
+	// Predicate skips the records which can't match it, and the rows of the indexed records it rules out, when set.
+	Predicate *Predicate
+	// Columns lists the top-level columns of the records returned, in order, they hold every column when it is nil.
+	Columns []int
+	Order   Order
+	// Partitions restricts the rows read to the ones of the listed partitions, when it is not nil.
+	Partitions []int32
+	// Offsets bounds the offsets of the rows read, in every partition read, and Timestamps their timestamps, when set.
+	Offsets    *OffsetRange
+	Timestamps *TimeRange
+}
+
+// OffsetRange holds the offsets from From, inclusive, to To, exclusive, the offsets are not bounded above when To is
+// zero.
+type OffsetRange struct {
+	From int64
+	To   int64
+}
+
+// TimeRange holds the times from From, inclusive, to To, exclusive, a zero time leaving its side unbounded.
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+func (offsets OffsetRange) overlaps(low int64, high int64) bool {
+	return high >= offsets.From && (offsets.To == 0 || low < offsets.To)
+}
+
+func (timestamps TimeRange) overlaps(low int64, high int64) bool {
+	return (timestamps.From.IsZero() || high >= timestamps.From.UnixMilli()) && (timestamps.To.IsZero() || low < timestamps.To.UnixMilli())
+}
+
+// bounded returns whether the rows read are bounded by their partitions, offsets or timestamps.
+func (scan Scan) bounded() bool {
+	return scan.Partitions != nil || scan.Offsets != nil || scan.Timestamps != nil
+}
+
+// readsPartition returns whether the rows of partition are read.
+func (scan Scan) readsPartition(partition int32) bool {
+	if scan.Partitions == nil {
+		return true
+	}
+
+	for _, listed := range scan.Partitions {
+		if listed == partition {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readsPartitions returns whether any of the partitions from low to high, inclusive, is read.
+func (scan Scan) readsPartitions(low int32, high int32) bool {
+	if scan.Partitions == nil {
+		return true
+	}
+
+	for _, listed := range scan.Partitions {
+		if listed >= low && listed <= high {
+			return true
+		}
+	}
+
+	return false
+}
+
+// contains returns whether the row of record, the metadata columns of which start at metadata, is within the ranges of
+// the scan.
+func (scan Scan) contains(record arrow.Record, metadata int, row int) bool {
+	if scan.Partitions != nil && !scan.readsPartition(record.Column(metadata).(*array.Int32).Value(row)) {
+		return false
+	}
+
+	if scan.Offsets != nil {
+		offset := record.Column(metadata + 1).(*array.Int64).Value(row)
+		if !scan.Offsets.overlaps(offset, offset) {
+			return false
+		}
+	}
+
+	if scan.Timestamps != nil {
+		timestamp := record.Column(metadata + 2).(*array.Int64).Value(row)
+		if !scan.Timestamps.overlaps(timestamp, timestamp) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// overlaps returns whether the record described by zones, the metadata columns of which start at metadata, may hold
+// rows within the ranges of the scan.
+func (scan Scan) overlaps(zones zoneMap, metadata int) bool {
+	if zones.columns == nil {
+		return true
+	}
+
+	if bounds := zones.columns[metadata].bounds; scan.Partitions != nil && bounds != nil {
+		partitions := bounds.(*array.Int32)
+		if !scan.readsPartitions(partitions.Value(0), partitions.Value(1)) {
+			return false
+		}
+	}
+
+	if bounds := zones.columns[metadata+1].bounds; scan.Offsets != nil && bounds != nil {
+		offsets := bounds.(*array.Int64)
+		if !scan.Offsets.overlaps(offsets.Value(0), offsets.Value(1)) {
+			return false
+		}
+	}
+
+	if bounds := zones.columns[metadata+2].bounds; scan.Timestamps != nil && bounds != nil {
+		timestamps := bounds.(*array.Int64)
+		if !scan.Timestamps.overlaps(timestamps.Value(0), timestamps.Value(1)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validateScan checks that scan can be read from a store of schema.
+func validateScan(schema *arrow.Schema, scan Scan) error {
+	if scan.Order != "" && scan.Order != Forward && scan.Order != Backward && scan.Order != Any {
+		return errors.New(fmt.Sprintf("unsupported order: '%s', expecting '%s', '%s' or '%s'", scan.Order, Forward, Backward, Any))
+	}
+
+	for _, partition := range scan.Partitions {
+		if partition < 0 {
+			return errors.New(fmt.Sprintf("partitions: %v can't be negative", scan.Partitions))
+		}
+	}
+
+	if scan.Offsets != nil && (scan.Offsets.From < 0 || scan.Offsets.To < 0) {
+		return errors.New(fmt.Sprintf("offsets: %+v can't be negative", *scan.Offsets))
+	}
+
+	return validateColumns(schema, scan.Columns)
+}
+
+// storedSchema returns the schema of the records of a store of schema, its columns followed by the metadata columns.
+func storedSchema(schema *arrow.Schema) *arrow.Schema {
+	fields := append(append([]arrow.Field{}, schema.Fields()...), metadataFields...)
+	metadata := schema.Metadata()
+
+	return arrow.NewSchema(fields, &metadata)
+}
+
+// storedColumns returns the columns of the records of a store of width columns read for columns: the ones listed, or
+// all of them when nil, followed by the metadata columns.
+func storedColumns(columns []int, width int) []int {
+	stored := append([]int{}, columns...)
+	if columns == nil {
+		for column := 0; column < width; column++ {
+			stored = append(stored, column)
+		}
+	}
+
+	for index := range metadataFields {
+		stored = append(stored, width+index)
+	}
+
+	return stored
+}
+
+// validateFieldNames checks that the names of the fields of schema are not the ones of the metadata columns.
+func validateFieldNames(schema *arrow.Schema) error {
+	for _, field := range metadataFields {
+		if schema.HasField(field.Name) {
+			return errors.New(fmt.Sprintf("field: '%s' is reserved for the metadata of the rows", field.Name))
+		}
+	}
+
+	return nil
+}
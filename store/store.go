@@ -4,46 +4,88 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/RoaringBitmap/roaring"
 	"github.com/apache/arrow/go/v13/arrow"
 	"github.com/apache/arrow/go/v13/arrow/array"
+	"github.com/apache/arrow/go/v13/arrow/bitutil"
 	"github.com/apache/arrow/go/v13/arrow/compute"
+	"github.com/apache/arrow/go/v13/arrow/compute/exprs"
 	"github.com/exsql-io/go-datastore/common"
 	"github.com/exsql-io/go-datastore/engine"
+	"github.com/substrait-io/substrait-go/expr"
+	"github.com/substrait-io/substrait-go/extensions"
+	"github.com/substrait-io/substrait-go/proto"
 	"github.com/substrait-io/substrait-go/types"
+	"time"
 )
 
 var DefaultChunkSize int64 = 0
 
+// typeVariations declares the arrow types without substrait equivalent as type variations of the closest substrait
+// types: the unsigned integers, which are declared up-front, and the logical types met in the schemas, see
+// typeVariation and DeclareTypeVariations.
+var typeVariations = newTypeVariations()
+
 type InputFormatType string
 
 const (
 	Json InputFormatType = "json"
 )
 
+type Mode string
+
+const (
+	// Append keeps every value put into the store.
+	Append Mode = "append"
+	// Table keeps the latest value put for each key, a null value deleting the value of its key.
+	Table Mode = "table"
+)
+
+// Options are the settings of the store of a stream, they are declared along the stream in the configuration.
+type Options struct {
+	Mode Mode `yaml:"mode"`
+	// Key lists the columns identifying the rows of a store in Table mode, the key of the records is used when empty.
+	Key       []string  `yaml:"key"`
+	Retention Retention `yaml:"retention"`
+	Tiering   Tiering   `yaml:"tiering"`
+	Indexes   []Index   `yaml:"indexes"`
+	// Partitioned holds the rows of each partition in a store of its own, see PartitionedStore.
+	Partitioned bool `yaml:"partitioned"`
+}
+
+// RecordGroup is a set of records read together, Deleted flags the rows of the records, taken one after the other,
+// which were replaced or deleted since they were put, and Selected, when set, the only rows to read. The records of a
+// group of the cold tier are read from Cold once the iterator reaches it.
+type RecordGroup struct {
+	Records  []arrow.Record
+	Deleted  []byte
+	Selected *roaring.Bitmap
+	Cold     *ColdFile
+}
+
 type arrowTableCloseableIterator struct {
-	ctx             context.Context
-	schema          *arrow.Schema
-	inMemoryRecords arrow.Record
-	records         []arrow.Record
-	position        int
-	table           arrow.Table
-	reader          *array.TableReader
+	ctx      context.Context
+	schema   *arrow.Schema
+	columns  []int
+	scan     Scan
+	groups   []RecordGroup
+	position int
+	current  []arrow.Record
+	table    arrow.Table
+	reader   *array.TableReader
+	err      error
 }
 
 func (iterator *arrowTableCloseableIterator) Next() bool {
-	hasNext := iterator.prepareNextNonEmptyBatch()
-	if !hasNext {
-		return false
-	}
+	for {
+		if iterator.reader != nil && iterator.reader.Next() {
+			return true
+		}
 
-	if iterator.reader.Next() {
-		return true
+		if !iterator.prepareNextNonEmptyBatch() {
+			return false
+		}
 	}
-
-	iterator.reader.Release()
-	iterator.table.Release()
-
-	return false
 }
 
 func (iterator *arrowTableCloseableIterator) Value() engine.ColumnarBatch {
@@ -52,55 +94,269 @@ func (iterator *arrowTableCloseableIterator) Value() engine.ColumnarBatch {
 }
 
 func (iterator *arrowTableCloseableIterator) Close() {
-	iterator.reader.Release()
-	iterator.table.Release()
+	iterator.releaseCurrentBatch()
+
+	for _, group := range iterator.groups {
+		releaseRecords(group.Records)
+		if group.Cold != nil {
+			group.Cold.Close()
+		}
+	}
+
+	iterator.groups = nil
+	iterator.position = 0
 }
 
 func (iterator *arrowTableCloseableIterator) prepareNextNonEmptyBatch() bool {
-	if iterator.reader == nil {
-		iterator.table = table(iterator.schema, []arrow.Record{iterator.inMemoryRecords})
-		iterator.reader = array.NewTableReader(iterator.table, DefaultChunkSize)
+	iterator.releaseCurrentBatch()
 
-		return true
+	if iterator.position >= len(iterator.groups) || iterator.err != nil {
+		return false
 	}
 
-	iterator.reader.Release()
-	iterator.table.Release()
+	group := &iterator.groups[iterator.position]
+	if group.Cold != nil {
+		group.Records, iterator.err = group.Cold.Records()
+		group.Cold = nil
+		if iterator.err != nil {
+			return false
+		}
+	}
 
-	iterator.position -= 1
-	if iterator.position < 0 {
+	iterator.position += 1
+
+	stored, err := iterator.readGroup(*group)
+	if err != nil {
+		iterator.err = err
 		return false
 	}
 
-	iterator.table = table(iterator.schema, []arrow.Record{iterator.records[iterator.position]})
+	// the metadata columns following the columns of the schema are dropped.
+	iterator.current = projectRecords(iterator.schema, stored, iterator.columns)
+	releaseRecords(stored)
+
+	iterator.table = table(iterator.schema, iterator.current)
 	iterator.reader = array.NewTableReader(iterator.table, DefaultChunkSize)
 
 	return true
 }
 
-func NewArrowTableCloseableIterator(inMemoryRecords arrow.Record, records []arrow.Record) *engine.CloseableIterator {
+// Err returns the error which stopped the iterator, reading the records of the cold tier may fail.
+func (iterator *arrowTableCloseableIterator) Err() error {
+	return iterator.err
+}
+
+func (iterator *arrowTableCloseableIterator) releaseCurrentBatch() {
+	if iterator.reader != nil {
+		iterator.reader.Release()
+		iterator.table.Release()
+		releaseRecords(iterator.current)
+
+		iterator.reader = nil
+		iterator.table = nil
+		iterator.current = nil
+	}
+}
+
+// readGroup returns the rows of group the scan reads, in its order.
+func (iterator *arrowTableCloseableIterator) readGroup(group RecordGroup) ([]arrow.Record, error) {
+	if group.Selected == nil && !iterator.scan.bounded() && iterator.scan.Order != Backward {
+		return liveRecords(group), nil
+	}
+
+	var selected []arrow.Record
+	base := int64(0)
+	for _, record := range group.Records {
+		rows := iterator.selectRows(group, record, base)
+		base += record.NumRows()
+		if len(rows) == 0 {
+			continue
+		}
+
+		taken, err := engine.TakeRows(iterator.ctx, record, rows)
+		if err != nil {
+			releaseRecords(selected)
+			return nil, err
+		}
+
+		selected = append(selected, taken)
+	}
+
+	if iterator.scan.Order == Backward {
+		for left, right := 0, len(selected)-1; left < right; left, right = left+1, right-1 {
+			selected[left], selected[right] = selected[right], selected[left]
+		}
+	}
+
+	return selected, nil
+}
+
+// selectRows returns the rows of record, the first of which is the row at base of group, which are selected, neither
+// deleted nor out of the ranges of the scan, in the order of the scan.
+func (iterator *arrowTableCloseableIterator) selectRows(group RecordGroup, record arrow.Record, base int64) []int64 {
+	var rows []int64
+	selected := func(row int64) {
+		if !isDeleted(group.Deleted, int(base+row)) && iterator.scan.contains(record, len(iterator.columns), int(row)) {
+			rows = append(rows, row)
+		}
+	}
+
+	if group.Selected == nil {
+		for row := int64(0); row < record.NumRows(); row++ {
+			selected(row)
+		}
+	} else {
+		candidates := group.Selected.Iterator()
+		candidates.AdvanceIfNeeded(uint32(base))
+		for candidates.HasNext() && int64(candidates.PeekNext()) < base+record.NumRows() {
+			selected(int64(candidates.Next()) - base)
+		}
+	}
+
+	if iterator.scan.Order == Backward {
+		for left, right := 0, len(rows)-1; left < right; left, right = left+1, right-1 {
+			rows[left], rows[right] = rows[right], rows[left]
+		}
+	}
+
+	return rows
+}
+
+// NewArrowTableCloseableIterator returns an iterator over the records of groups, in order, reading the rows selected by
+// scan which are not deleted. The records hold the columns of schema followed by the metadata columns, which are not
+// returned. It takes over the references to the records and releases them when closed.
+func NewArrowTableCloseableIterator(schema *arrow.Schema, groups []RecordGroup, scan Scan) *engine.CloseableIterator {
+	columns := make([]int, len(schema.Fields()))
+	for index := range columns {
+		columns[index] = index
+	}
+
 	var iterator engine.CloseableIterator
 	iterator = &arrowTableCloseableIterator{
-		ctx:             context.Background(),
-		schema:          inMemoryRecords.Schema(),
-		inMemoryRecords: inMemoryRecords,
-		records:         records,
-		position:        len(records),
-		table:           nil,
-		reader:          nil,
+		ctx:      context.Background(),
+		schema:   schema,
+		columns:  columns,
+		scan:     scan,
+		groups:   groups,
+		position: 0,
+		current:  nil,
+		table:    nil,
+		reader:   nil,
 	}
 
 	return &iterator
 }
 
+// liveRecords returns new references to the records of group, or to the slices of them made of the rows which are not
+// deleted.
+func liveRecords(group RecordGroup) []arrow.Record {
+	if group.Deleted == nil {
+		return retain(group.Records)
+	}
+
+	var live []arrow.Record
+	base := int64(0)
+	for _, record := range group.Records {
+		start := int64(-1)
+		for row := int64(0); row <= record.NumRows(); row++ {
+			deleted := row == record.NumRows() || isDeleted(group.Deleted, int(base+row))
+			if !deleted && start < 0 {
+				start = row
+			}
+
+			if deleted && start >= 0 {
+				live = append(live, record.NewSlice(start, row))
+				start = -1
+			}
+		}
+
+		base += record.NumRows()
+	}
+
+	return live
+}
+
+// projectSchema returns the schema of the columns of schema listed by columns, schema itself when columns is nil.
+func projectSchema(schema *arrow.Schema, columns []int) *arrow.Schema {
+	if columns == nil {
+		return schema
+	}
+
+	fields := make([]arrow.Field, len(columns))
+	for index, column := range columns {
+		fields[index] = schema.Field(column)
+	}
+
+	metadata := schema.Metadata()
+	return arrow.NewSchema(fields, &metadata)
+}
+
+// projectRecords returns new references to records narrowed to the columns listed by columns, which make schema.
+func projectRecords(schema *arrow.Schema, records []arrow.Record, columns []int) []arrow.Record {
+	if columns == nil {
+		return retain(records)
+	}
+
+	projected := make([]arrow.Record, len(records))
+	for index, record := range records {
+		arrays := make([]arrow.Array, len(columns))
+		for position, column := range columns {
+			arrays[position] = record.Column(column)
+		}
+
+		projected[index] = array.NewRecord(schema, arrays, record.NumRows())
+	}
+
+	return projected
+}
+
+// validateColumns checks that columns lists top-level columns of schema.
+func validateColumns(schema *arrow.Schema, columns []int) error {
+	for _, column := range columns {
+		if column < 0 || column >= len(schema.Fields()) {
+			return errors.New(fmt.Sprintf("column: %d is out of range, the store has %d columns", column, len(schema.Fields())))
+		}
+	}
+
+	return nil
+}
+
+// isDeleted returns whether row is flagged by deleted, which only covers the rows up to the last one deleted.
+func isDeleted(deleted []byte, row int) bool {
+	return row < len(deleted)*8 && bitutil.BitIsSet(deleted, row)
+}
+
 type Filter func(compute.Datum) (compute.Datum, error)
 
+// DecodeError is returned by Put when the record put can't be decoded to a row of the store, which is left unaltered.
+type DecodeError struct {
+	Err error
+}
+
+func (err *DecodeError) Error() string {
+	return fmt.Sprintf("record can't be decoded: %s", err.Err)
+}
+
+func (err *DecodeError) Unwrap() error {
+	return err.Err
+}
+
 type Store interface {
-	Put(offset int64, key []byte, value []byte) error
+	Put(partition int32, offset int64, timestamp time.Time, key []byte, value []byte) error
 	Close()
-	Iterator() (*engine.CloseableIterator, error)
+	// Iterator returns an iterator over the rows of the store selected by scan, in its order.
+	Iterator(scan Scan) (*engine.CloseableIterator, error)
 	Schema() *arrow.Schema
 	NamedStruct() types.NamedStruct
+	// Evict drops the records out of the retention of the store at now.
+	Evict(now time.Time) error
+	RetentionState() RetentionState
+	// Offsets returns the last offset of each partition the store holds durably, the records following them have to be
+	// put again into a restored store.
+	Offsets() map[int32]int64
+	// Reset drops every row of the store, and its persisted state, leaving it as if it was just created. The iterators
+	// already returned keep reading their snapshot.
+	Reset() error
 }
 
 func ToArrowSchema(schema *common.Schema) (*arrow.Schema, error) {
@@ -127,11 +383,104 @@ func toArrowField(field *common.Field) (*arrow.Field, error) {
 		Name:     field.Name,
 		Nullable: field.Nullable,
 		Type:     dataType,
+		Metadata: toMetadata(field.Type),
 	}
 
 	return &arrowField, nil
 }
 
+// ToNamedStruct maps an arrow schema to the substrait schema of the relation reading it, names are given in depth-first
+// order as the names of the fields of structures follow the name of the structure.
+func ToNamedStruct(schema *arrow.Schema) (types.NamedStruct, error) {
+	typeVariationsLock.Lock()
+	defer typeVariationsLock.Unlock()
+
+	var names []string
+	var fieldTypes []types.Type
+	for _, field := range schema.Fields() {
+		fieldType, err := toSubstraitType(field.Type, field.Nullable)
+		if err != nil {
+			return types.NamedStruct{}, errors.New(fmt.Sprintf("type: '%s' of field: '%s' is not convertible to substrait type: %s", field.Type, field.Name, err))
+		}
+
+		names = append(names, field.Name)
+		names = append(names, nestedNames(field.Type)...)
+		fieldTypes = append(fieldTypes, fieldType)
+	}
+
+	return types.NamedStruct{
+		Names: names,
+		Struct: types.StructType{
+			Nullability: types.NullabilityRequired,
+			Types:       fieldTypes,
+		},
+	}, nil
+}
+
+// nestedNames returns the depth-first names of the fields of the structures nested in dataType.
+func nestedNames(dataType arrow.DataType) []string {
+	var names []string
+	switch t := dataType.(type) {
+	case *arrow.StructType:
+		for _, field := range t.Fields() {
+			names = append(names, field.Name)
+			names = append(names, nestedNames(field.Type)...)
+		}
+	case arrow.ListLikeType:
+		names = nestedNames(t.Elem())
+	}
+
+	return names
+}
+
+// DeclareTypeVariations adds to p the declarations of the type variations used by the schemas returned by
+// ToNamedStruct, without them the unsigned integers or the logical types of a plan would be read as their substrait
+// types.
+func DeclareTypeVariations(p *proto.Plan) {
+	typeVariationsLock.Lock()
+	uris, declarations := typeVariations.GetSubstraitRegistry().ToProto()
+	typeVariationsLock.Unlock()
+
+	next := uint32(0)
+	for _, uri := range p.ExtensionUris {
+		if uri.ExtensionUriAnchor > next {
+			next = uri.ExtensionUriAnchor
+		}
+	}
+
+	// the same uri may be listed under several anchors, it is declared once.
+	declared := make(map[string]uint32)
+	anchors := make(map[uint32]uint32)
+	for _, uri := range uris {
+		if anchor, ok := declared[uri.Uri]; ok {
+			anchors[uri.ExtensionUriAnchor] = anchor
+			continue
+		}
+
+		next += 1
+		declared[uri.Uri] = next
+		anchors[uri.ExtensionUriAnchor] = next
+		uri.ExtensionUriAnchor = next
+		p.ExtensionUris = append(p.ExtensionUris, uri)
+	}
+
+	for _, declaration := range declarations {
+		if variation := declaration.GetExtensionTypeVariation(); variation != nil {
+			variation.ExtensionUriReference = anchors[variation.ExtensionUriReference]
+			p.Extensions = append(p.Extensions, declaration)
+		}
+	}
+}
+
+func newTypeVariations() exprs.ExtensionIDSet {
+	set := exprs.NewExtensionSetDefault(expr.NewEmptyExtensionRegistry(&extensions.DefaultCollection))
+	for _, dataType := range []arrow.DataType{arrow.PrimitiveTypes.Uint8, arrow.PrimitiveTypes.Uint16, arrow.PrimitiveTypes.Uint32, arrow.PrimitiveTypes.Uint64} {
+		set.EncodeTypeVariation(dataType)
+	}
+
+	return set
+}
+
 func toArrowType(tpe common.Type) (arrow.DataType, error) {
 	switch tpe.Name {
 	case common.BooleanType:
@@ -160,7 +509,34 @@ func toArrowType(tpe common.Type) (arrow.DataType, error) {
 		return arrow.BinaryTypes.Binary, nil
 	case common.Utf8Type:
 		return arrow.BinaryTypes.String, nil
+	case common.ArrayType:
+		if tpe.Values == nil {
+			return nil, errors.New("type: 'array' requires the type of its values")
+		}
+
+		values, err := toArrowType(*tpe.Values)
+		if err != nil {
+			return nil, err
+		}
+
+		return arrow.ListOfField(arrow.Field{Name: "item", Type: values, Nullable: true, Metadata: toMetadata(*tpe.Values)}), nil
+	case common.StructureType:
+		if tpe.Fields == nil || len(*tpe.Fields) == 0 {
+			return nil, errors.New("type: 'structure' requires at least one field")
+		}
+
+		var fields []arrow.Field
+		for _, field := range *tpe.Fields {
+			arrowField, err := toArrowField(&field)
+			if err != nil {
+				return nil, err
+			}
+
+			fields = append(fields, *arrowField)
+		}
+
+		return arrow.StructOf(fields...), nil
 	default:
-		return nil, errors.New(fmt.Sprintf("type: '%s' is not yet convertible to arrow type", tpe.Name))
+		return toLogicalArrowType(tpe)
 	}
 }
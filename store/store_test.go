@@ -1,9 +1,23 @@
 package store
 
 import (
+	"errors"
+	"fmt"
 	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/apache/arrow/go/v13/arrow/array"
+	"github.com/apache/arrow/go/v13/arrow/compute/exprs"
+	"github.com/apache/arrow/go/v13/arrow/memory"
+	"github.com/apache/arrow/go/v13/parquet/file"
 	"github.com/exsql-io/go-datastore/common"
+	"github.com/exsql-io/go-datastore/engine"
+	"github.com/substrait-io/substrait-go/proto"
+	"github.com/substrait-io/substrait-go/proto/extensions"
+	"github.com/substrait-io/substrait-go/types"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestToArrowSchema(t *testing.T) {
@@ -93,3 +107,1656 @@ func assertFieldType(t *testing.T, index int, name common.TypeName, dataType arr
 		t.Errorf("unexpected type: %+v", dataType)
 	}
 }
+
+func TestToNamedStruct(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "vendorId", Type: arrow.BinaryTypes.String, Nullable: false},
+		{Name: "passengers", Type: arrow.PrimitiveTypes.Int16, Nullable: true},
+		{Name: "flags", Type: arrow.PrimitiveTypes.Uint8, Nullable: false},
+		{Name: "payload", Type: arrow.BinaryTypes.Binary, Nullable: true},
+		{Name: "location", Type: arrow.StructOf(
+			arrow.Field{Name: "latitude", Type: arrow.PrimitiveTypes.Float64},
+			arrow.Field{Name: "longitude", Type: arrow.PrimitiveTypes.Float64},
+		), Nullable: true},
+		{Name: "tags", Type: arrow.ListOf(arrow.BinaryTypes.String), Nullable: false},
+	}, nil)
+
+	namedStruct, err := ToNamedStruct(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedNames := []string{"vendorId", "passengers", "flags", "payload", "location", "latitude", "longitude", "tags"}
+	if len(namedStruct.Names) != len(expectedNames) {
+		t.Fatalf("expected names: %v, got: %v", expectedNames, namedStruct.Names)
+	}
+
+	for index, name := range expectedNames {
+		if namedStruct.Names[index] != name {
+			t.Errorf("expected name at %d to be %s, got: %s", index, name, namedStruct.Names[index])
+		}
+	}
+
+	expectedTypes := []types.Type{
+		&types.StringType{Nullability: types.NullabilityRequired},
+		&types.Int16Type{Nullability: types.NullabilityNullable},
+		&types.Int8Type{Nullability: types.NullabilityRequired, TypeVariationRef: 1},
+		&types.BinaryType{Nullability: types.NullabilityNullable},
+		&types.StructType{Nullability: types.NullabilityNullable, Types: []types.Type{
+			&types.Float64Type{Nullability: types.NullabilityRequired},
+			&types.Float64Type{Nullability: types.NullabilityRequired},
+		}},
+		&types.ListType{Nullability: types.NullabilityRequired, Type: &types.StringType{Nullability: types.NullabilityNullable}},
+	}
+
+	for index, expected := range expectedTypes {
+		actual := namedStruct.Struct.Types[index]
+		if !actual.Equals(expected) {
+			t.Errorf("expected type of field at %d to be %s, got: %s", index, expected, actual)
+		}
+	}
+}
+
+func TestDeclareTypeVariations(t *testing.T) {
+	p := &proto.Plan{
+		ExtensionUris: []*extensions.SimpleExtensionURI{{ExtensionUriAnchor: 1, Uri: "functions_comparison.yaml"}},
+	}
+
+	DeclareTypeVariations(p)
+
+	if len(p.ExtensionUris) != 2 || p.ExtensionUris[1].ExtensionUriAnchor != 2 {
+		t.Fatalf("expected the uri of the type variations to be declared with anchor 2, got: %v", p.ExtensionUris)
+	}
+
+	// the variations of the logical types are only declared once a schema uses them.
+	if len(p.Extensions) < 4 {
+		t.Fatalf("expected at least the 4 type variations of the unsigned integers to be declared, got: %d", len(p.Extensions))
+	}
+
+	for _, extension := range p.Extensions {
+		variation := extension.GetExtensionTypeVariation()
+		if variation.ExtensionUriReference != 2 {
+			t.Errorf("expected type variation: '%s' to reference uri 2, got: %d", variation.Name, variation.ExtensionUriReference)
+		}
+	}
+}
+
+func TestToArrowSchemaNested(t *testing.T) {
+	schema, err := common.FromYaml("../testdata/yaml/nested_schema.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arrowSchema, err := ToArrowSchema(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := arrow.NewSchema([]arrow.Field{
+		{Name: "eventId", Type: arrow.BinaryTypes.String, Nullable: false},
+		{Name: "tags", Type: arrow.ListOf(arrow.BinaryTypes.String), Nullable: true},
+		{Name: "location", Type: arrow.StructOf(
+			arrow.Field{Name: "latitude", Type: arrow.PrimitiveTypes.Float64, Nullable: false},
+			arrow.Field{Name: "longitude", Type: arrow.PrimitiveTypes.Float64, Nullable: false},
+		), Nullable: true},
+		{Name: "stops", Type: arrow.ListOf(arrow.StructOf(
+			arrow.Field{Name: "name", Type: arrow.BinaryTypes.String, Nullable: false},
+			arrow.Field{Name: "durations", Type: arrow.ListOf(arrow.PrimitiveTypes.Int32), Nullable: true},
+		)), Nullable: false},
+	}, nil)
+
+	if !arrowSchema.Equal(expected) {
+		t.Errorf("expected schema: %s, got: %s", expected, arrowSchema)
+	}
+}
+
+func TestInMemoryStoreNested(t *testing.T) {
+	schema, err := common.FromYaml("../testdata/yaml/nested_schema.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allocator := memory.DefaultAllocator
+	store, err := NewInMemoryStore(&allocator, Json, schema, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := []string{
+		`{"eventId":"e1","tags":["a","b"],"location":{"latitude":1.5,"longitude":2.5},"stops":[{"name":"s1","durations":[1,2]}]}`,
+		`{"eventId":"e2","tags":null,"location":null,"stops":[]}`,
+	}
+
+	for offset, event := range events {
+		err = (*store).Put(0, int64(offset), time.Time{}, nil, []byte(event))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	iterator, err := (*store).Iterator(Scan{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer (*iterator).Close()
+
+	var rows int64
+	for (*iterator).Next() {
+		batch := *(*iterator).Value()
+		rows += batch.NumRows()
+
+		tags := batch.Column(1).(*array.List)
+		if start, end := tags.ValueOffsets(0); end-start != 2 || !tags.IsNull(1) {
+			t.Errorf("expected tags to be [a b] and null, got: %s", tags)
+		}
+
+		location := batch.Column(2).(*array.Struct)
+		latitude := location.Field(0).(*array.Float64)
+		if latitude.Value(0) != 1.5 || !location.IsNull(1) {
+			t.Errorf("expected location to be {1.5 2.5} and null, got: %s", location)
+		}
+	}
+
+	if rows != int64(len(events)) {
+		t.Errorf("expected %d rows, got: %d", len(events), rows)
+	}
+}
+
+func TestToArrowSchemaLogical(t *testing.T) {
+	schema, err := common.FromYaml("../testdata/yaml/logical_schema.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arrowSchema, err := ToArrowSchema(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []arrow.DataType{
+		NewUuidType(),
+		&arrow.TimestampType{Unit: arrow.Millisecond, TimeZone: "UTC"},
+		arrow.FixedWidthTypes.Date32,
+		arrow.FixedWidthTypes.Time32s,
+		arrow.FixedWidthTypes.Duration_s,
+		&arrow.Decimal128Type{Precision: 10, Scale: 2},
+		&arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Int32, ValueType: arrow.BinaryTypes.String},
+	}
+
+	for index, dataType := range expected {
+		if !arrow.TypeEqual(arrowSchema.Field(index).Type, dataType) {
+			t.Errorf("expected field at %d to be %s, got: %s", index, dataType, arrowSchema.Field(index).Type)
+		}
+	}
+
+	invalid := []common.Type{
+		{Name: common.TimestampType, Unit: "days"},
+		{Name: common.TimestampType, Timezone: "Mars/Olympus_Mons"},
+		{Name: common.DecimalType, Precision: 39},
+		{Name: common.DecimalType, Precision: 4, Scale: 5},
+		{Name: common.EnumType},
+	}
+
+	for _, tpe := range invalid {
+		if _, err := toArrowType(tpe); err == nil {
+			t.Errorf("expected type: %+v to be rejected", tpe)
+		}
+	}
+}
+
+func TestToNamedStructLogical(t *testing.T) {
+	schema, err := common.FromYaml("../testdata/yaml/logical_schema.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arrowSchema, err := ToArrowSchema(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	namedStruct, err := ToNamedStruct(arrowSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"uuid", "timestamp_tz", "date", "time", "i64", "decimal<10,2>", "string"}
+	for index, name := range expected {
+		actual := namedStruct.Struct.Types[index]
+		if actual.WithNullability(types.NullabilityRequired).String() != name {
+			t.Errorf("expected type of field at %d to be %s, got: %s", index, name, actual)
+		}
+
+		// the variations are decoded back to the arrow type of the field.
+		dataType, _, err := exprs.FromSubstraitType(actual, typeVariations)
+		if err != nil {
+			t.Errorf("expected type of field at %d to be convertible to arrow, got: %v", index, err)
+			continue
+		}
+
+		if !arrow.TypeEqual(dataType, arrowSchema.Field(index).Type) {
+			t.Errorf("expected type of field at %d to be read as %s, got: %s", index, arrowSchema.Field(index).Type, dataType)
+		}
+	}
+}
+
+func TestInMemoryStoreLogical(t *testing.T) {
+	schema, err := common.FromYaml("../testdata/yaml/logical_schema.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allocator := memory.DefaultAllocator
+	store, err := NewInMemoryStore(&allocator, Json, schema, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := []string{
+		`{"tripId":"0b0f2a4e-5c1d-4b7a-9a43-7f3e2d1c0b9a","pickupTimestamp":"2023-06-01T10:15:30.250Z","pickupDate":"2023-06-01","pickupTime":"10:15:30","duration":"1h30m","fareAmount":"12.50","paymentType":"card"}`,
+		`{"tripId":"6f1c2b3a-0000-4000-8000-000000000001","pickupTimestamp":1685614530250,"pickupDate":19509,"pickupTime":null,"duration":60,"fareAmount":7.25,"paymentType":"cash"}`,
+	}
+
+	for offset, event := range events {
+		err = (*store).Put(0, int64(offset), time.Time{}, nil, []byte(event))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	iterator, err := (*store).Iterator(Scan{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer (*iterator).Close()
+
+	if !(*iterator).Next() {
+		t.Fatal("expected a batch")
+	}
+
+	batch := *(*iterator).Value()
+	expected := [][]string{
+		{"0b0f2a4e-5c1d-4b7a-9a43-7f3e2d1c0b9a", "6f1c2b3a-0000-4000-8000-000000000001"},
+		{"2023-06-01 10:15:30.25", "2023-06-01 10:15:30.25"},
+		{"2023-06-01", "2023-06-01"},
+		{"10:15:30", array.NullValueStr},
+		{"5400", "60"},
+		{"12.5", "7.25"},
+		{"card", "cash"},
+	}
+
+	for column, values := range expected {
+		for row, value := range values {
+			actual := batch.Column(column).ValueStr(row)
+			if duration, ok := batch.Column(column).(*array.Duration); ok && duration.IsValid(row) {
+				actual = fmt.Sprint(int64(duration.Value(row)))
+			}
+
+			if actual != value {
+				t.Errorf("expected value of column %d at row %d to be %s, got: %s", column, row, value, actual)
+			}
+		}
+	}
+}
+
+func TestInMemoryStoreRejectsUnknownSymbols(t *testing.T) {
+	schema, err := common.FromYaml("../testdata/yaml/logical_schema.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allocator := memory.DefaultAllocator
+	store, err := NewInMemoryStore(&allocator, Json, schema, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := `{"tripId":"0b0f2a4e-5c1d-4b7a-9a43-7f3e2d1c0b9a","pickupTimestamp":0,"pickupDate":0,"pickupTime":null,"duration":null,"fareAmount":1,"paymentType":"voucher"}`
+	err = (*store).Put(0, 0, time.Time{}, nil, []byte(event))
+	if err == nil {
+		t.Errorf("expected a value which is not a symbol of its enum to be rejected")
+	}
+
+	rows, err := countRows(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rows != 0 {
+		t.Errorf("expected the rejected value not to be stored, got: %d rows", rows)
+	}
+}
+
+func TestInMemoryStoreDiscardsPartiallyDecodedValues(t *testing.T) {
+	schema, err := common.FromYaml("../testdata/yaml/nested_schema.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allocator := memory.DefaultAllocator
+	store, err := NewInMemoryStore(&allocator, Json, schema, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := []string{
+		`{"eventId":"e1","tags":["a"],"location":null,"stops":[]}`,
+		`{"eventId":"e2","tags":"a","location":null,"stops":[]}`,
+		`{"eventId":"e3","tags":["b","c"],"location":{"latitude":1.5,"longitude":2.5},"stops":[]}`,
+	}
+
+	for offset, event := range events {
+		err = (*store).Put(0, int64(offset), time.Time{}, nil, []byte(event))
+		if (err != nil) != (offset == 1) {
+			t.Errorf("expected only the event at %d to be rejected, got: %v for the event at %d", 1, err, offset)
+		}
+
+		var decodeError *DecodeError
+		if err != nil && !errors.As(err, &decodeError) {
+			t.Errorf("expected the event at %d to be rejected with a decode error, got: %v", offset, err)
+		}
+	}
+
+	// the columns missing from a value are null.
+	if err := (*store).Put(0, 3, time.Time{}, nil, []byte(`{"eventId":"e4"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	iterator, err := (*store).Iterator(Scan{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer (*iterator).Close()
+
+	var eventIds []string
+	for (*iterator).Next() {
+		batch := *(*iterator).Value()
+		ids := batch.Column(0).(*array.String)
+		tags := batch.Column(1).(*array.List)
+		for row := 0; row < int(batch.NumRows()); row++ {
+			eventIds = append(eventIds, ids.Value(row))
+			if start, end := tags.ValueOffsets(row); ids.Value(row) == "e3" && end-start != 2 {
+				t.Errorf("expected the tags of e3 to be [b c], got: %s", tags)
+			}
+		}
+	}
+
+	if fmt.Sprint(eventIds) != "[e1 e3 e4]" {
+		t.Errorf("expected events: [e1 e3 e4], got: %v", eventIds)
+	}
+}
+
+func TestInMemoryStoreConcurrentPutAndIterator(t *testing.T) {
+	schema, err := common.FromYaml("../testdata/yaml/nested_schema.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(groupSize int32) { DefaultGroupSize = groupSize }(DefaultGroupSize)
+	DefaultGroupSize = 64
+
+	allocator := memory.DefaultAllocator
+	store, err := NewInMemoryStore(&allocator, Json, schema, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := int(3*DefaultGroupSize + DefaultGroupSize/2)
+	done := make(chan error)
+	go func() {
+		for offset := 0; offset < count; offset++ {
+			event := fmt.Sprintf(`{"eventId":"e%d","tags":["a"],"location":null,"stops":[]}`, offset)
+			if err := (*store).Put(0, int64(offset), time.Time{}, nil, []byte(event)); err != nil {
+				done <- err
+				return
+			}
+		}
+
+		done <- nil
+	}()
+
+	previous := int64(0)
+	for running := true; running; {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			running = false
+		default:
+		}
+
+		rows, err := countRows(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rows < previous || rows > int64(count) {
+			t.Fatalf("expected between %d and %d rows, got: %d", previous, count, rows)
+		}
+
+		previous = rows
+	}
+
+	rows, err := countRows(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rows != int64(count) {
+		t.Errorf("expected %d rows, got: %d", count, rows)
+	}
+}
+
+func countRows(store *Store) (int64, error) {
+	iterator, err := (*store).Iterator(Scan{})
+	if err != nil {
+		return 0, err
+	}
+
+	defer (*iterator).Close()
+
+	var rows int64
+	for (*iterator).Next() {
+		rows += (*(*iterator).Value()).NumRows()
+	}
+
+	return rows, nil
+}
+
+func TestInMemoryStoreTable(t *testing.T) {
+	defer func(groupSize int32) { DefaultGroupSize = groupSize }(DefaultGroupSize)
+	DefaultGroupSize = 2
+
+	tests := []struct {
+		options Options
+		keys    []string
+	}{
+		{Options{Mode: Table}, []string{"k1", "k2", "k1", "k3", "k2"}},
+		{Options{Mode: Table, Key: []string{"eventId"}}, []string{"r1", "r2", "r3", "r4", "r5"}},
+	}
+
+	for _, test := range tests {
+		store := newNestedStore(t, test.options)
+		eventIds := []string{"e1", "e2", "e1", "e3", "e2"}
+		for offset, eventId := range eventIds {
+			event := fmt.Sprintf(`{"eventId":"%s","tags":["v%d"],"location":null,"stops":[]}`, eventId, offset)
+			if err := (*store).Put(0, int64(offset), time.Time{}, []byte(test.keys[offset]), []byte(event)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		snapshot, err := (*store).Iterator(Scan{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the record key of the latest version of e2 deletes it in both modes.
+		if err := (*store).Put(0, 5, time.Time{}, []byte(test.keys[4]), nil); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := map[string]string{"e1": "v2", "e3": "v3"}
+		if rows := readTags(t, store); fmt.Sprint(rows) != fmt.Sprint(expected) {
+			t.Errorf("expected rows: %v with options: %v, got: %v", expected, test.options, rows)
+		}
+
+		expected["e2"] = "v4"
+		if rows := readIterator(t, snapshot); fmt.Sprint(rows) != fmt.Sprint(expected) {
+			t.Errorf("expected snapshot rows: %v with options: %v, got: %v", expected, test.options, rows)
+		}
+	}
+}
+
+// sealingPersistence records the deleted rows of the sealed records and the rows of the keys at each checkpoint.
+type sealingPersistence struct {
+	deleted []string
+	rows    []string
+}
+
+func (persistence *sealingPersistence) checkpoint(store *InMemoryStore, _ map[int32]int64) error {
+	var deleted []string
+	for _, sealed := range store.records {
+		deleted = append(deleted, fmt.Sprint(sealed.deleted))
+	}
+
+	persistence.deleted = append(persistence.deleted, fmt.Sprint(deleted))
+	persistence.rows = append(persistence.rows, fmt.Sprint(store.rows))
+	return nil
+}
+
+func (persistence *sealingPersistence) freeze(int, arrow.Record) (string, int64, error) {
+	return "", 0, errors.New("freeze is not supported")
+}
+
+func TestInMemoryStoreTableSealedState(t *testing.T) {
+	defer func(groupSize int32) { DefaultGroupSize = groupSize }(DefaultGroupSize)
+	DefaultGroupSize = 2
+
+	schema, err := common.FromYaml("../testdata/yaml/nested_schema.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allocator := memory.DefaultAllocator
+	store, err := newInMemoryStore(&allocator, Json, schema, Options{Mode: Table})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer store.Close()
+
+	persistence := &sealingPersistence{}
+	store.persistence = persistence
+
+	// the upserts of k1 fill the groups, replacing a row of the group they seal and then a row of a sealed group.
+	for offset, key := range []string{"k1", "k1", "k2", "k1"} {
+		event := fmt.Sprintf(`{"eventId":"e%s","tags":["v%d"],"location":null,"stops":[]}`, key[1:], offset)
+		if err := store.Put(0, int64(offset), time.Time{}, []byte(key), []byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := "[[[1]] [[3] []]]"
+	if fmt.Sprint(persistence.deleted) != expected {
+		t.Errorf("expected the deleted rows: %s to be sealed, got: %v", expected, persistence.deleted)
+	}
+
+	expected = "[map[k1:{0 1}] map[k1:{1 1} k2:{1 0}]]"
+	if fmt.Sprint(persistence.rows) != expected {
+		t.Errorf("expected the rows: %s to be sealed, got: %v", expected, persistence.rows)
+	}
+}
+
+func TestInMemoryStoreOptions(t *testing.T) {
+	schema, err := common.FromYaml("../testdata/yaml/nested_schema.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []Options{
+		{Mode: "compacted"},
+		{Key: []string{"eventId"}},
+		{Mode: Table, Key: []string{"unknown"}},
+		{Tiering: Tiering{MaxHotRecords: 1}},
+		{Tiering: Tiering{MaxHotAge: -time.Hour}},
+		{Indexes: []Index{{Column: "unknown", Kind: Hash}}},
+		{Indexes: []Index{{Column: "eventId", Kind: "btree"}}},
+		{Indexes: []Index{{Column: "tags", Kind: Hash}}},
+		{Indexes: []Index{{Column: "eventId", Kind: Hash}, {Column: "eventId", Kind: Bitmap}}},
+	}
+
+	allocator := memory.DefaultAllocator
+	for _, options := range tests {
+		if _, err := NewInMemoryStore(&allocator, Json, schema, options); err == nil {
+			t.Errorf("expected options: %v to be rejected", options)
+		}
+	}
+
+	reserved := common.Schema{Fields: []common.Field{{Name: "__offset", Type: common.Type{Name: common.LongType}}}}
+	if _, err := NewInMemoryStore(&allocator, Json, &reserved, Options{}); err == nil {
+		t.Errorf("expected the field: '__offset' to be rejected")
+	}
+
+	store := newNestedStore(t, Options{Mode: Table})
+	if err := (*store).Put(0, 0, time.Time{}, nil, []byte(`{"eventId":"e1","tags":null,"location":null,"stops":[]}`)); err == nil {
+		t.Errorf("expected a record without key to be rejected in table mode")
+	}
+}
+
+func newNestedStore(t *testing.T, options Options) *Store {
+	schema, err := common.FromYaml("../testdata/yaml/nested_schema.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allocator := memory.DefaultAllocator
+	store, err := NewInMemoryStore(&allocator, Json, schema, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+// readTags returns the first tag of each event of store by event id.
+func readTags(t *testing.T, store *Store) map[string]string {
+	iterator, err := (*store).Iterator(Scan{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return readIterator(t, iterator)
+}
+
+func readIterator(t *testing.T, iterator *engine.CloseableIterator) map[string]string {
+	defer (*iterator).Close()
+
+	rows := make(map[string]string)
+	for (*iterator).Next() {
+		batch := *(*iterator).Value()
+		ids := batch.Column(0).(*array.String)
+		tags := batch.Column(1).(*array.List)
+		values := tags.ListValues().(*array.String)
+		for row := 0; row < int(batch.NumRows()); row++ {
+			if _, ok := rows[ids.Value(row)]; ok {
+				t.Errorf("expected a single row for event: %s", ids.Value(row))
+			}
+
+			start, _ := tags.ValueOffsets(row)
+			rows[ids.Value(row)] = values.Value(int(start))
+		}
+	}
+
+	return rows
+}
+
+func TestInMemoryStoreRetention(t *testing.T) {
+	defer func(groupSize int32) { DefaultGroupSize = groupSize }(DefaultGroupSize)
+	DefaultGroupSize = 2
+
+	// the records are sealed, and evicted, against the current time.
+	now := time.Now()
+	tests := []struct {
+		retention Retention
+		evicted   int
+		remaining []string
+	}{
+		{Retention{MaxAge: 90 * time.Minute}, 2, []string{"e4", "e5", "e6"}},
+		{Retention{MaxAge: 90 * time.Minute, TimeColumn: "pickupTimestamp"}, 1, []string{"e2", "e3", "e4", "e5", "e6"}},
+		{Retention{MaxRows: 5}, 1, []string{"e2", "e3", "e4", "e5", "e6"}},
+		{Retention{MaxRows: 1}, 3, []string{"e6"}},
+		{Retention{}, 0, []string{"e0", "e1", "e2", "e3", "e4", "e5", "e6"}},
+	}
+
+	schema, err := common.FromYaml("../testdata/yaml/logical_schema.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allocator := memory.DefaultAllocator
+	for _, test := range tests {
+		store, err := NewInMemoryStore(&allocator, Json, schema, Options{Retention: test.retention})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the records are put an hour apart from each other, their pickups are a minute before the last put.
+		for offset := 0; offset < 7; offset++ {
+			timestamp := now.Add(time.Duration(offset-6) * time.Hour)
+			pickup := now.Add(-time.Minute).UnixMilli()
+			if offset < 2 {
+				pickup = timestamp.UnixMilli()
+			}
+
+			event := fmt.Sprintf(`{"tripId":"00000000-0000-4000-8000-00000000000%d","pickupTimestamp":%d,"pickupDate":0,"pickupTime":null,"duration":null,"fareAmount":%d,"paymentType":"cash"}`, offset, pickup, offset)
+			if err := (*store).Put(0, int64(offset), timestamp, nil, []byte(event)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := (*store).Evict(now); err != nil {
+			t.Fatal(err)
+		}
+
+		state := (*store).RetentionState()
+		if state.Evicted.Records != test.evicted || state.Records != 3-test.evicted {
+			t.Errorf("expected %d records to be evicted with retention: %+v, got: %+v", test.evicted, test.retention, state)
+		}
+
+		if state.Rows != int64(len(test.remaining)) || state.Evicted.Rows != int64(7-len(test.remaining)) {
+			t.Errorf("expected %d rows to remain with retention: %+v, got: %+v", len(test.remaining), test.retention, state)
+		}
+
+		rows, err := countRows(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rows != int64(len(test.remaining)) {
+			t.Errorf("expected %d rows to be read with retention: %+v, got: %d", len(test.remaining), test.retention, rows)
+		}
+	}
+}
+
+func TestInMemoryStoreRetentionBytes(t *testing.T) {
+	defer func(groupSize int32) { DefaultGroupSize = groupSize }(DefaultGroupSize)
+	DefaultGroupSize = 2
+
+	store := newNestedStore(t, Options{Mode: Table, Retention: Retention{MaxBytes: 1}})
+	for offset, key := range []string{"k1", "k2", "k3", "k1", "k4"} {
+		event := fmt.Sprintf(`{"eventId":"e%d","tags":["%s"],"location":null,"stops":[]}`, offset, key)
+		if err := (*store).Put(0, int64(offset), time.Time{}, []byte(key), []byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	state := (*store).RetentionState()
+	if state.Records != 0 || state.Evicted.Records != 2 || state.Evicted.Bytes == 0 {
+		t.Errorf("expected every sealed record to be evicted, got: %+v", state)
+	}
+
+	// the deletion of a key which row was evicted leaves the store unchanged.
+	if err := (*store).Put(0, 5, time.Time{}, []byte("k2"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if rows := readTags(t, store); fmt.Sprint(rows) != "map[e4:k4]" {
+		t.Errorf("expected rows: map[e4:k4], got: %v", rows)
+	}
+}
+
+func TestInMemoryStoreRetentionOptions(t *testing.T) {
+	schema, err := common.FromYaml("../testdata/yaml/logical_schema.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []Retention{
+		{MaxAge: -time.Hour},
+		{MaxAge: time.Hour, TimeColumn: "unknown"},
+		{MaxAge: time.Hour, TimeColumn: "pickupDate"},
+	}
+
+	allocator := memory.DefaultAllocator
+	for _, retention := range tests {
+		if _, err := NewInMemoryStore(&allocator, Json, schema, Options{Retention: retention}); err == nil {
+			t.Errorf("expected retention: %+v to be rejected", retention)
+		}
+	}
+}
+
+// failingPersistence fails to checkpoint while failing is set.
+type failingPersistence struct {
+	failing bool
+}
+
+func (persistence *failingPersistence) checkpoint(*InMemoryStore, map[int32]int64) error {
+	if persistence.failing {
+		return errors.New("checkpoint failed")
+	}
+
+	return nil
+}
+
+func (persistence *failingPersistence) freeze(int, arrow.Record) (string, int64, error) {
+	return "", 0, errors.New("freeze is not supported")
+}
+
+func TestInMemoryStoreOffsetsFailedCheckpoint(t *testing.T) {
+	defer func(groupSize int32) { DefaultGroupSize = groupSize }(DefaultGroupSize)
+	DefaultGroupSize = 2
+
+	schema, err := common.FromYaml("../testdata/yaml/nested_schema.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allocator := memory.DefaultAllocator
+	store, err := newInMemoryStore(&allocator, Json, schema, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer store.Close()
+
+	persistence := &failingPersistence{}
+	store.persistence = persistence
+	put := func(offset int) error {
+		event := fmt.Sprintf(`{"eventId":"e%d","tags":["v%d"],"location":null,"stops":[]}`, offset, offset)
+		return store.Put(0, int64(offset), time.Time{}, nil, []byte(event))
+	}
+
+	for offset := 0; offset < 2; offset++ {
+		if err := put(offset); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if offsets := store.Offsets(); fmt.Sprint(offsets) != "map[0:1]" {
+		t.Errorf("expected offsets: map[0:1], got: %v", offsets)
+	}
+
+	// the offsets of the record sealed by a failed checkpoint are not reported as persisted.
+	persistence.failing = true
+	if err := put(2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := put(3); err == nil {
+		t.Errorf("expected the failed checkpoint to be reported")
+	}
+
+	if offsets := store.Offsets(); fmt.Sprint(offsets) != "map[0:1]" {
+		t.Errorf("expected offsets: map[0:1] after a failed checkpoint, got: %v", offsets)
+	}
+
+	// the next checkpoint persists the record along with the ones sealed since.
+	persistence.failing = false
+	for offset := 4; offset < 6; offset++ {
+		if err := put(offset); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if offsets := store.Offsets(); fmt.Sprint(offsets) != "map[0:5]" {
+		t.Errorf("expected offsets: map[0:5], got: %v", offsets)
+	}
+}
+
+func TestDiskStoreRestore(t *testing.T) {
+	defer func(groupSize int32) { DefaultGroupSize = groupSize }(DefaultGroupSize)
+	DefaultGroupSize = 2
+
+	directory := t.TempDir()
+	store := newDiskStore(t, "../testdata/yaml/logical_schema.yaml", Options{}, directory)
+	for offset := 0; offset < 5; offset++ {
+		event := fmt.Sprintf(`{"tripId":"00000000-0000-4000-8000-00000000000%d","pickupTimestamp":%d,"pickupDate":19509,"pickupTime":"10:15:30","duration":60,"fareAmount":%d,"paymentType":"cash"}`, offset, 1685614530250+offset, offset)
+		if err := (*store).Put(int32(offset%2), int64(offset), time.Time{}, nil, []byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := readValues(t, store)
+	(*store).Close()
+
+	// the unsealed row is lost, the offsets tell where to put it again from.
+	restored := newDiskStore(t, "../testdata/yaml/logical_schema.yaml", Options{}, directory)
+	defer (*restored).Close()
+
+	if offsets := (*restored).Offsets(); fmt.Sprint(offsets) != "map[0:2 1:3]" {
+		t.Errorf("expected offsets: map[0:2 1:3], got: %v", offsets)
+	}
+
+	if !(*restored).Schema().Equal((*store).Schema()) {
+		t.Errorf("expected schema: %s, got: %s", (*store).Schema(), (*restored).Schema())
+	}
+
+	// the rows being built are read last, the restored store only holds the sealed ones.
+	values := readValues(t, restored)
+	if fmt.Sprint(values) != fmt.Sprint(expected[:len(expected)-1]) {
+		t.Errorf("expected rows: %v, got: %v", expected[:len(expected)-1], values)
+	}
+}
+
+func TestDiskStoreRestoreFailedCheckpoint(t *testing.T) {
+	defer func(groupSize int32) { DefaultGroupSize = groupSize }(DefaultGroupSize)
+	DefaultGroupSize = 2
+
+	directory := t.TempDir()
+	store := newDiskStore(t, "../testdata/yaml/nested_schema.yaml", Options{}, directory)
+	put := func(offset int) error {
+		event := fmt.Sprintf(`{"eventId":"e%d","tags":["v%d"],"location":null,"stops":[]}`, offset, offset)
+		return (*store).Put(0, int64(offset), time.Time{}, nil, []byte(event))
+	}
+
+	for offset := 0; offset < 3; offset++ {
+		if err := put(offset); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a directory in place of the temporary checkpoint file makes the next checkpoint fail.
+	obstruction := filepath.Join(directory, checkpointFileName+".tmp")
+	if err := os.MkdirAll(filepath.Join(obstruction, "obstruction"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := put(3); err == nil {
+		t.Errorf("expected the failed checkpoint to be reported")
+	}
+
+	if offsets := (*store).Offsets(); fmt.Sprint(offsets) != "map[0:1]" {
+		t.Errorf("expected offsets: map[0:1] after a failed checkpoint, got: %v", offsets)
+	}
+
+	(*store).Close()
+	if err := os.RemoveAll(obstruction); err != nil {
+		t.Fatal(err)
+	}
+
+	// the store resumes from the last checkpoint, the segment written before the failure is dropped.
+	restored := newDiskStore(t, "../testdata/yaml/nested_schema.yaml", Options{}, directory)
+	defer (*restored).Close()
+
+	if offsets := (*restored).Offsets(); fmt.Sprint(offsets) != "map[0:1]" {
+		t.Errorf("expected offsets: map[0:1], got: %v", offsets)
+	}
+
+	if rows := readTags(t, restored); fmt.Sprint(rows) != "map[e0:v0 e1:v1]" {
+		t.Errorf("expected rows: map[e0:v0 e1:v1], got: %v", rows)
+	}
+
+	if files := listFiles(t, directory); fmt.Sprint(files) != "[00000000000000000000.arrow checkpoint.json]" {
+		t.Errorf("expected files: [00000000000000000000.arrow checkpoint.json], got: %v", files)
+	}
+}
+
+func TestDiskStoreRestoreTable(t *testing.T) {
+	defer func(groupSize int32) { DefaultGroupSize = groupSize }(DefaultGroupSize)
+	DefaultGroupSize = 2
+
+	directory := t.TempDir()
+	store := newDiskStore(t, "../testdata/yaml/nested_schema.yaml", Options{Mode: Table}, directory)
+	for offset, key := range []string{"k1", "k2", "k1", "k3"} {
+		event := fmt.Sprintf(`{"eventId":"e%s","tags":["v%d"],"location":null,"stops":[]}`, key[1:], offset)
+		if err := (*store).Put(0, int64(offset), time.Time{}, []byte(key), []byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	(*store).Close()
+
+	restored := newDiskStore(t, "../testdata/yaml/nested_schema.yaml", Options{Mode: Table}, directory)
+	defer (*restored).Close()
+
+	// the keys of the restored rows are replaced and deleted like the ones put since.
+	if err := (*restored).Put(0, 4, time.Time{}, []byte("k2"), []byte(`{"eventId":"e2","tags":["v4"],"location":null,"stops":[]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (*restored).Put(0, 5, time.Time{}, []byte("k1"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if rows := readTags(t, restored); fmt.Sprint(rows) != "map[e2:v4 e3:v3]" {
+		t.Errorf("expected rows: map[e2:v4 e3:v3], got: %v", rows)
+	}
+}
+
+func TestDiskStoreRestoreUpsertSealingGroup(t *testing.T) {
+	defer func(groupSize int32) { DefaultGroupSize = groupSize }(DefaultGroupSize)
+	DefaultGroupSize = 2
+
+	directory := t.TempDir()
+	store := newDiskStore(t, "../testdata/yaml/nested_schema.yaml", Options{Mode: Table}, directory)
+
+	// the second put of k1 seals the first group, the one of k1 seals the second group and replaces a sealed row.
+	for offset, key := range []string{"k1", "k1", "k2", "k1"} {
+		event := fmt.Sprintf(`{"eventId":"e%s","tags":["v%d"],"location":null,"stops":[]}`, key[1:], offset)
+		if err := (*store).Put(0, int64(offset), time.Time{}, []byte(key), []byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	(*store).Close()
+
+	restored := newDiskStore(t, "../testdata/yaml/nested_schema.yaml", Options{Mode: Table}, directory)
+	defer (*restored).Close()
+
+	if offsets := (*restored).Offsets(); fmt.Sprint(offsets) != "map[0:3]" {
+		t.Errorf("expected offsets: map[0:3], got: %v", offsets)
+	}
+
+	if rows := readTags(t, restored); fmt.Sprint(rows) != "map[e1:v3 e2:v2]" {
+		t.Errorf("expected rows: map[e1:v3 e2:v2], got: %v", rows)
+	}
+
+	if err := (*restored).Put(0, 4, time.Time{}, []byte("k2"), []byte(`{"eventId":"e2","tags":["v4"],"location":null,"stops":[]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if rows, err := countRows(restored); err != nil || rows != 2 {
+		t.Errorf("expected 2 rows once k2 is put again, got: %d %v", rows, err)
+	}
+}
+
+func TestDiskStoreReset(t *testing.T) {
+	defer func(groupSize int32) { DefaultGroupSize = groupSize }(DefaultGroupSize)
+	DefaultGroupSize = 2
+
+	directory := t.TempDir()
+	options := Options{Mode: Table, Tiering: Tiering{MaxHotRecords: 1}}
+	store := newDiskStore(t, "../testdata/yaml/nested_schema.yaml", options, directory)
+	for offset, key := range []string{"k1", "k2", "k3", "k4", "k5"} {
+		event := fmt.Sprintf(`{"eventId":"e%s","tags":["v%d"],"location":null,"stops":[]}`, key[1:], offset)
+		if err := (*store).Put(0, int64(offset), time.Time{}, []byte(key), []byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snapshot, err := (*store).Iterator(Scan{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (*store).Reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the snapshot taken before the reset, the record of the cold tier included, is still read.
+	if rows := readIterator(t, snapshot); len(rows) != 5 {
+		t.Errorf("expected the snapshot to hold 5 rows, got: %v", rows)
+	}
+
+	if rows := readTags(t, store); len(rows) != 0 {
+		t.Errorf("expected no rows, got: %v", rows)
+	}
+
+	if offsets := (*store).Offsets(); len(offsets) != 0 {
+		t.Errorf("expected no offsets, got: %v", offsets)
+	}
+
+	if files := listFiles(t, directory); fmt.Sprint(files) != "[checkpoint.json]" {
+		t.Errorf("expected files: [checkpoint.json], got: %v", files)
+	}
+
+	// the keys put before the reset are forgotten.
+	for offset, key := range []string{"k1", "k6"} {
+		event := fmt.Sprintf(`{"eventId":"e%s","tags":["w%d"],"location":null,"stops":[]}`, key[1:], offset)
+		if err := (*store).Put(0, int64(offset), time.Time{}, []byte(key), []byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := (*store).Put(0, 2, time.Time{}, []byte("k2"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	(*store).Close()
+
+	restored := newDiskStore(t, "../testdata/yaml/nested_schema.yaml", options, directory)
+	defer (*restored).Close()
+
+	if rows := readTags(t, restored); fmt.Sprint(rows) != "map[e1:w0 e6:w1]" {
+		t.Errorf("expected rows: map[e1:w0 e6:w1], got: %v", rows)
+	}
+
+	if offsets := (*restored).Offsets(); fmt.Sprint(offsets) != "map[0:1]" {
+		t.Errorf("expected offsets: map[0:1], got: %v", offsets)
+	}
+}
+
+func TestDiskStoreFiles(t *testing.T) {
+	defer func(groupSize int32) { DefaultGroupSize = groupSize }(DefaultGroupSize)
+	DefaultGroupSize = 2
+
+	directory := t.TempDir()
+	options := Options{Retention: Retention{MaxRows: 3}}
+	store := newDiskStore(t, "../testdata/yaml/nested_schema.yaml", options, directory)
+	for offset := 0; offset < 4; offset++ {
+		event := fmt.Sprintf(`{"eventId":"e%d","tags":["v%d"],"location":null,"stops":[]}`, offset, offset)
+		if err := (*store).Put(0, int64(offset), time.Time{}, nil, []byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	(*store).Close()
+
+	expected := "[00000000000000000001.arrow checkpoint.json]"
+	if files := listFiles(t, directory); fmt.Sprint(files) != expected {
+		t.Errorf("expected the segment of the evicted record to be removed: %s, got: %v", expected, files)
+	}
+
+	// files left behind by an interrupted checkpoint are removed on restore.
+	for _, name := range []string{segmentName(2), segmentName(3) + ".tmp"} {
+		if err := os.WriteFile(filepath.Join(directory, name), []byte("stray"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	restored := newDiskStore(t, "../testdata/yaml/nested_schema.yaml", options, directory)
+	defer (*restored).Close()
+
+	if files := listFiles(t, directory); fmt.Sprint(files) != expected {
+		t.Errorf("expected stray files to be removed: %s, got: %v", expected, files)
+	}
+
+	if rows := readTags(t, restored); fmt.Sprint(rows) != "map[e2:v2 e3:v3]" {
+		t.Errorf("expected rows: map[e2:v2 e3:v3], got: %v", rows)
+	}
+
+	if state := (*restored).RetentionState(); state.Evicted.Records != 1 || state.Evicted.Rows != 2 {
+		t.Errorf("expected the evictions to be restored, got: %+v", state)
+	}
+}
+
+func newDiskStore(t *testing.T, schemaPath string, options Options, directory string) *Store {
+	schema, err := common.FromYaml(schemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allocator := memory.DefaultAllocator
+	store, err := NewDiskStore(&allocator, Json, schema, options, directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+// readValues returns the values of each row of store as strings.
+func readValues(t *testing.T, store *Store) [][]string {
+	return readColumns(t, store, nil)
+}
+
+// readColumns returns the values of the columns of each row of store as strings.
+func readColumns(t *testing.T, store *Store, columns []int) [][]string {
+	iterator, err := (*store).Iterator(Scan{Columns: columns})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer (*iterator).Close()
+
+	var rows [][]string
+	for (*iterator).Next() {
+		batch := *(*iterator).Value()
+		for row := 0; row < int(batch.NumRows()); row++ {
+			var values []string
+			for column := 0; column < int(batch.NumCols()); column++ {
+				values = append(values, batch.Column(column).ValueStr(row))
+			}
+
+			rows = append(rows, values)
+		}
+	}
+
+	return rows
+}
+
+func listFiles(t *testing.T, directory string) []string {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	return names
+}
+
+func TestDiskStoreColdTier(t *testing.T) {
+	defer func(groupSize int32) { DefaultGroupSize = groupSize }(DefaultGroupSize)
+	DefaultGroupSize = 2
+
+	directory := t.TempDir()
+	options := Options{Tiering: Tiering{MaxHotRecords: 1, RowGroupSize: 1}}
+	store := newDiskStore(t, "../testdata/yaml/logical_schema.yaml", options, directory)
+	hot := newDiskStore(t, "../testdata/yaml/logical_schema.yaml", Options{}, t.TempDir())
+	defer (*hot).Close()
+
+	for offset := 0; offset < 7; offset++ {
+		event := fmt.Sprintf(`{"tripId":"00000000-0000-4000-8000-00000000000%d","pickupTimestamp":%d,"pickupDate":19509,"pickupTime":"10:15:0%d","duration":%d,"fareAmount":%d.25,"paymentType":"card"}`, offset, 1685614530250+offset, offset, offset, offset)
+		for _, s := range []*Store{store, hot} {
+			if err := (*s).Put(0, int64(offset), time.Time{}, nil, []byte(event)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	state := (*store).RetentionState()
+	if state.Records != 3 || state.ColdRecords != 2 {
+		t.Errorf("expected 2 of the 3 records to be cold, got: %+v", state)
+	}
+
+	var coldBytes int64
+	for group := 0; group < 2; group++ {
+		info, err := os.Stat(filepath.Join(directory, coldName(group)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		coldBytes += info.Size()
+	}
+
+	if hotState := (*hot).RetentionState(); state.ColdBytes != coldBytes || state.Bytes <= 0 || state.Bytes >= hotState.Bytes || hotState.ColdBytes != 0 {
+		t.Errorf("expected %d cold bytes and the bytes of the hot record only, got: %+v, without tiering: %+v", coldBytes, state, hotState)
+	}
+
+	expected := readValues(t, hot)
+	if values := readValues(t, store); fmt.Sprint(values) != fmt.Sprint(expected) {
+		t.Errorf("expected rows: %v, got: %v", expected, values)
+	}
+
+	expectedFiles := "[00000000000000000000.parquet 00000000000000000001.parquet 00000000000000000002.arrow checkpoint.json]"
+	if files := listFiles(t, directory); fmt.Sprint(files) != expectedFiles {
+		t.Errorf("expected files: %s, got: %v", expectedFiles, files)
+	}
+
+	reader, err := file.OpenParquetFile(filepath.Join(directory, coldName(0)), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer reader.Close()
+
+	if reader.NumRowGroups() != 2 {
+		t.Errorf("expected 2 row groups, got: %d", reader.NumRowGroups())
+	}
+
+	for rowGroup := 0; rowGroup < reader.NumRowGroups(); rowGroup++ {
+		column, err := reader.MetaData().RowGroup(rowGroup).ColumnChunk(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if set, err := column.StatsSet(); err != nil || !set {
+			t.Errorf("expected statistics for row group: %d, got: %v", rowGroup, err)
+		}
+	}
+
+	(*store).Close()
+
+	restored := newDiskStore(t, "../testdata/yaml/logical_schema.yaml", options, directory)
+	defer (*restored).Close()
+
+	if values := readValues(t, restored); fmt.Sprint(values) != fmt.Sprint(expected[:len(expected)-1]) {
+		t.Errorf("expected restored rows: %v, got: %v", expected[:len(expected)-1], values)
+	}
+}
+
+func TestDiskStoreColdTierSnapshot(t *testing.T) {
+	defer func(groupSize int32) { DefaultGroupSize = groupSize }(DefaultGroupSize)
+	DefaultGroupSize = 2
+
+	directory := t.TempDir()
+	options := Options{Mode: Table, Retention: Retention{MaxAge: time.Hour}, Tiering: Tiering{MaxHotRecords: 1}}
+	store := newDiskStore(t, "../testdata/yaml/nested_schema.yaml", options, directory)
+	defer (*store).Close()
+
+	now := time.Now()
+	for offset, key := range []string{"k1", "k2", "k3", "k4"} {
+		event := fmt.Sprintf(`{"eventId":"e%d","tags":["%s"],"location":null,"stops":[]}`, offset, key)
+		if err := (*store).Put(0, int64(offset), now, []byte(key), []byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the rows of the cold tier are deleted like the hot ones.
+	if err := (*store).Put(0, 4, now, []byte("k1"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := (*store).Iterator(Scan{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (*store).Evict(now.Add(2 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if files := listFiles(t, directory); fmt.Sprint(files) != "[checkpoint.json]" {
+		t.Errorf("expected the files of the evicted records to be removed, got: %v", files)
+	}
+
+	expected := "map[e1:k2 e2:k3 e3:k4]"
+	if rows := readIterator(t, snapshot); fmt.Sprint(rows) != expected {
+		t.Errorf("expected snapshot rows: %s, got: %v", expected, rows)
+	}
+
+	if rows := readTags(t, store); len(rows) != 0 {
+		t.Errorf("expected every row to be evicted, got: %v", rows)
+	}
+}
+
+func TestDiskStoreProjection(t *testing.T) {
+	defer func(groupSize int32) { DefaultGroupSize = groupSize }(DefaultGroupSize)
+	DefaultGroupSize = 2
+
+	options := Options{Tiering: Tiering{MaxHotRecords: 1}}
+	store := newDiskStore(t, "../testdata/yaml/nested_schema.yaml", options, t.TempDir())
+	defer (*store).Close()
+
+	for offset := 0; offset < 7; offset++ {
+		event := fmt.Sprintf(`{"eventId":"e%d","tags":["t%d"],"location":{"latitude":%d.5,"longitude":2.5},"stops":[{"name":"s%d","durations":[%d]}]}`, offset, offset, offset, offset, offset)
+		if err := (*store).Put(0, int64(offset), time.Time{}, nil, []byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if state := (*store).RetentionState(); state.ColdRecords != 2 {
+		t.Errorf("expected 2 cold records, got: %+v", state)
+	}
+
+	// the columns are returned in the order they are listed, the hot and the cold records alike.
+	columns := []int{2, 0, 2}
+	var expected [][]string
+	for _, values := range readValues(t, store) {
+		expected = append(expected, []string{values[2], values[0], values[2]})
+	}
+
+	if values := readColumns(t, store, columns); fmt.Sprint(values) != fmt.Sprint(expected) {
+		t.Errorf("expected rows: %v, got: %v", expected, values)
+	}
+
+	iterator, err := (*store).Iterator(Scan{Columns: columns})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer (*iterator).Close()
+
+	for (*iterator).Next() {
+		var names []string
+		for _, field := range (*(*iterator).Value()).Schema().Fields() {
+			names = append(names, field.Name)
+		}
+
+		if fmt.Sprint(names) != "[location eventId location]" {
+			t.Errorf("expected the fields: [location eventId location], got: %v", names)
+		}
+	}
+
+	if _, err := (*store).Iterator(Scan{Columns: []int{4}}); err == nil {
+		t.Error("expected an error for a column out of range")
+	}
+}
+
+func TestDiskStoreScan(t *testing.T) {
+	defer func(groupSize int32) { DefaultGroupSize = groupSize }(DefaultGroupSize)
+	DefaultGroupSize = 2
+
+	// the first record is moved to the cold tier and the last event is not sealed.
+	options := Options{Tiering: Tiering{MaxHotRecords: 2}}
+	store := newDiskStore(t, "../testdata/yaml/nested_schema.yaml", options, t.TempDir())
+	defer (*store).Close()
+
+	start := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	for offset := 0; offset < 7; offset++ {
+		event := fmt.Sprintf(`{"eventId":"e%d","tags":[],"location":null,"stops":[]}`, offset)
+		timestamp := start.Add(time.Duration(offset) * time.Hour)
+		if err := (*store).Put(int32(offset%2), int64(offset), timestamp, nil, []byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if state := (*store).RetentionState(); state.ColdRecords != 1 {
+		t.Errorf("expected 1 cold record, got: %+v", state)
+	}
+
+	tests := []struct {
+		scan     Scan
+		expected string
+	}{
+		{Scan{}, "[e0 e1 e2 e3 e4 e5 e6]"},
+		{Scan{Order: Forward}, "[e0 e1 e2 e3 e4 e5 e6]"},
+		{Scan{Order: Backward}, "[e6 e5 e4 e3 e2 e1 e0]"},
+		{Scan{Offsets: &OffsetRange{From: 1, To: 5}}, "[e1 e2 e3 e4]"},
+		{Scan{Offsets: &OffsetRange{From: 5}}, "[e5 e6]"},
+		{Scan{Offsets: &OffsetRange{From: 1, To: 5}, Order: Backward}, "[e4 e3 e2 e1]"},
+		{Scan{Timestamps: &TimeRange{From: start.Add(2 * time.Hour), To: start.Add(4 * time.Hour)}}, "[e2 e3]"},
+		{Scan{Timestamps: &TimeRange{To: start.Add(time.Hour)}}, "[e0]"},
+		{Scan{Offsets: &OffsetRange{From: 10}}, "[]"},
+		{Scan{Partitions: []int32{1}}, "[e1 e3 e5]"},
+		{Scan{Partitions: []int32{0}, Offsets: &OffsetRange{From: 1, To: 5}}, "[e2 e4]"},
+		{Scan{Partitions: []int32{1, 0}, Offsets: &OffsetRange{From: 5}, Order: Backward}, "[e6 e5]"},
+		{Scan{Partitions: []int32{2}}, "[]"},
+		{Scan{Partitions: []int32{}}, "[]"},
+	}
+
+	for _, test := range tests {
+		iterator, err := (*store).Iterator(test.scan)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var eventIds []string
+		for (*iterator).Next() {
+			batch := *(*iterator).Value()
+			if batch.NumCols() != 4 {
+				t.Errorf("expected 4 columns, got: %d", batch.NumCols())
+			}
+
+			for row := 0; row < int(batch.NumRows()); row++ {
+				eventIds = append(eventIds, batch.Column(0).ValueStr(row))
+			}
+		}
+
+		(*iterator).Close()
+		if fmt.Sprint(eventIds) != test.expected {
+			t.Errorf("expected scan: %+v to read: %s, got: %v", test.scan, test.expected, eventIds)
+		}
+	}
+
+	for _, scan := range []Scan{{Order: "sideways"}, {Offsets: &OffsetRange{From: -1}}, {Partitions: []int32{0, -1}}} {
+		if _, err := (*store).Iterator(scan); err == nil {
+			t.Errorf("expected scan: %+v to be rejected", scan)
+		}
+	}
+}
+
+func TestPartitionedStore(t *testing.T) {
+	defer func(groupSize int32) { DefaultGroupSize = groupSize }(DefaultGroupSize)
+	DefaultGroupSize = 2
+
+	store := newNestedStore(t, Options{Partitioned: true})
+	defer (*store).Close()
+
+	// the partitions are put into concurrently, each in the order of its offsets.
+	var wait sync.WaitGroup
+	errs := make(chan error, 3)
+	for partition := 2; partition >= 0; partition-- {
+		wait.Add(1)
+		go func(partition int) {
+			defer wait.Done()
+			for offset := 0; offset < 5; offset++ {
+				event := fmt.Sprintf(`{"eventId":"p%d-%d","tags":[],"location":null,"stops":[]}`, partition, offset)
+				if err := (*store).Put(int32(partition), int64(offset), time.Time{}, nil, []byte(event)); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(partition)
+	}
+
+	wait.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	expected := "[p0-0 p0-1 p0-2 p0-3 p0-4 p1-0 p1-1 p1-2 p1-3 p1-4 p2-0 p2-1 p2-2 p2-3 p2-4]"
+	if eventIds := readEventIds(t, store, Scan{}); fmt.Sprint(eventIds) != expected {
+		t.Errorf("expected events: %s, got: %v", expected, eventIds)
+	}
+
+	expected = "[p2-3 p2-2 p1-3 p1-2 p0-3 p0-2]"
+	if eventIds := readEventIds(t, store, Scan{Order: Backward, Offsets: &OffsetRange{From: 2, To: 4}}); fmt.Sprint(eventIds) != expected {
+		t.Errorf("expected events: %s, got: %v", expected, eventIds)
+	}
+
+	expected = "[p2-2 p2-3]"
+	if eventIds := readEventIds(t, store, Scan{Partitions: []int32{2}, Offsets: &OffsetRange{From: 2, To: 4}}); fmt.Sprint(eventIds) != expected {
+		t.Errorf("expected events: %s, got: %v", expected, eventIds)
+	}
+
+	// the partitions are merged in any order, each of them in the order of its offsets.
+	merged := make(map[string][]string)
+	for _, eventId := range readEventIds(t, store, Scan{Order: Any}) {
+		merged[eventId[:2]] = append(merged[eventId[:2]], eventId)
+	}
+
+	if fmt.Sprint(merged) != "map[p0:[p0-0 p0-1 p0-2 p0-3 p0-4] p1:[p1-0 p1-1 p1-2 p1-3 p1-4] p2:[p2-0 p2-1 p2-2 p2-3 p2-4]]" {
+		t.Errorf("expected the events of each partition in order, got: %v", merged)
+	}
+
+	if offsets := (*store).Offsets(); fmt.Sprint(offsets) != "map[0:3 1:3 2:3]" {
+		t.Errorf("expected offsets: map[0:3 1:3 2:3], got: %v", offsets)
+	}
+
+	if state := (*store).RetentionState(); state.Records != 6 || state.Rows != 15 {
+		t.Errorf("expected 6 records of 15 rows, got: %+v", state)
+	}
+
+	// an iterator closed before its end stops reading the partitions.
+	iterator, err := (*store).Iterator(Scan{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !(*iterator).Next() {
+		t.Errorf("expected the iterator to read a batch")
+	}
+
+	(*iterator).Close()
+
+	if _, err := (*store).Iterator(Scan{Order: "sideways"}); err == nil {
+		t.Errorf("expected the order: 'sideways' to be rejected")
+	}
+}
+
+func TestPartitionedDiskStore(t *testing.T) {
+	defer func(groupSize int32) { DefaultGroupSize = groupSize }(DefaultGroupSize)
+	DefaultGroupSize = 2
+
+	directory := t.TempDir()
+	options := Options{Partitioned: true}
+	store := newDiskStore(t, "../testdata/yaml/nested_schema.yaml", options, directory)
+	for offset := 0; offset < 6; offset++ {
+		event := fmt.Sprintf(`{"eventId":"e%d","tags":[],"location":null,"stops":[]}`, offset)
+		if err := (*store).Put(int32(offset%2), int64(offset), time.Time{}, nil, []byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	(*store).Close()
+
+	if files := listFiles(t, directory); fmt.Sprint(files) != "[partition-0 partition-1]" {
+		t.Errorf("expected files: [partition-0 partition-1], got: %v", files)
+	}
+
+	// the unsealed rows of each partition are lost.
+	restored := newDiskStore(t, "../testdata/yaml/nested_schema.yaml", options, directory)
+	defer (*restored).Close()
+
+	if offsets := (*restored).Offsets(); fmt.Sprint(offsets) != "map[0:2 1:3]" {
+		t.Errorf("expected offsets: map[0:2 1:3], got: %v", offsets)
+	}
+
+	if eventIds := readEventIds(t, restored, Scan{}); fmt.Sprint(eventIds) != "[e0 e2 e1 e3]" {
+		t.Errorf("expected events: [e0 e2 e1 e3], got: %v", eventIds)
+	}
+
+	// a store which is not partitioned can't be restored as a partitioned one.
+	flat := newDiskStore(t, "../testdata/yaml/nested_schema.yaml", Options{}, filepath.Join(directory, "partition-0"))
+	(*flat).Close()
+
+	schema, err := common.FromYaml("../testdata/yaml/nested_schema.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allocator := memory.DefaultAllocator
+	if _, err := NewDiskStore(&allocator, Json, schema, options, filepath.Join(directory, "partition-0")); err == nil {
+		t.Errorf("expected a store which is not partitioned to be rejected")
+	}
+}
+
+func readEventIds(t *testing.T, store *Store, scan Scan) []string {
+	iterator, err := (*store).Iterator(scan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer (*iterator).Close()
+
+	var eventIds []string
+	for (*iterator).Next() {
+		batch := *(*iterator).Value()
+		for row := 0; row < int(batch.NumRows()); row++ {
+			eventIds = append(eventIds, batch.Column(0).ValueStr(row))
+		}
+	}
+
+	return eventIds
+}
+
+// gatedIterator returns its batches once its gate is closed.
+type gatedIterator struct {
+	gate    chan struct{}
+	batches []arrow.Record
+	current arrow.Record
+}
+
+func (iterator *gatedIterator) Next() bool {
+	<-iterator.gate
+	if len(iterator.batches) == 0 {
+		return false
+	}
+
+	iterator.current, iterator.batches = iterator.batches[0], iterator.batches[1:]
+	return true
+}
+
+func (iterator *gatedIterator) Value() engine.ColumnarBatch {
+	return &iterator.current
+}
+
+func (iterator *gatedIterator) Close() {
+	for _, batch := range iterator.batches {
+		batch.Release()
+	}
+}
+
+func TestParallelIteratorMerged(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.PrimitiveTypes.Int64}}, nil)
+	newIterator := func(gate chan struct{}, ids ...int64) engine.CloseableIterator {
+		iterator := &gatedIterator{gate: gate}
+		for _, id := range ids {
+			builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+			builder.Field(0).(*array.Int64Builder).Append(id)
+			iterator.batches = append(iterator.batches, builder.NewRecord())
+			builder.Release()
+		}
+
+		return iterator
+	}
+
+	for _, merged := range []bool{false, true} {
+		blocked, open := make(chan struct{}), make(chan struct{})
+		close(open)
+
+		iterator := newParallelIterator([]engine.CloseableIterator{newIterator(blocked, 1, 2), newIterator(open, 3, 4)}, merged)
+		var ids []string
+		readId := func() {
+			next := make(chan bool, 1)
+			go func() { next <- iterator.Next() }()
+			select {
+			case ok := <-next:
+				if !ok {
+					t.Fatalf("expected a batch, merged: %t", merged)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("expected a batch to be read, merged: %t, got: %v", merged, ids)
+			}
+
+			ids = append(ids, (*iterator.Value()).Column(0).ValueStr(0))
+		}
+
+		if merged {
+			// the batches of the second iterator are returned while the first one is blocked.
+			readId()
+			readId()
+		}
+
+		close(blocked)
+		for len(ids) < 4 {
+			readId()
+		}
+
+		if iterator.Next() {
+			t.Errorf("expected 4 batches, merged: %t", merged)
+		}
+
+		iterator.Close()
+
+		expected := "[1 2 3 4]"
+		if merged {
+			expected = "[3 4 1 2]"
+		}
+
+		if fmt.Sprint(ids) != expected {
+			t.Errorf("expected batches: %s, merged: %t, got: %v", expected, merged, ids)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/apache/arrow/go/v13/arrow/array"
+	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+	"reflect"
+	"strings"
+)
+
+// UuidType is the arrow extension type of the uuid columns, uuids are stored as 16 bytes and read from and written to
+// json in their canonical form (xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx).
+type UuidType struct {
+	arrow.ExtensionBase
+}
+
+func NewUuidType() *UuidType {
+	return &UuidType{ExtensionBase: arrow.ExtensionBase{Storage: &arrow.FixedSizeBinaryType{ByteWidth: 16}}}
+}
+
+func (*UuidType) ArrayType() reflect.Type {
+	return reflect.TypeOf(UuidArray{})
+}
+
+func (*UuidType) ExtensionName() string {
+	return "arrow.uuid"
+}
+
+func (uuidType *UuidType) String() string {
+	return "uuid"
+}
+
+func (*UuidType) Serialize() string {
+	return ""
+}
+
+func (*UuidType) Deserialize(storageType arrow.DataType, _ string) (arrow.ExtensionType, error) {
+	if !arrow.TypeEqual(storageType, &arrow.FixedSizeBinaryType{ByteWidth: 16}) {
+		return nil, errors.New(fmt.Sprintf("storage type: '%s' of uuid is not fixed_size_binary[16]", storageType))
+	}
+
+	return NewUuidType(), nil
+}
+
+func (uuidType *UuidType) ExtensionEquals(other arrow.ExtensionType) bool {
+	return uuidType.ExtensionName() == other.ExtensionName()
+}
+
+func (*UuidType) NewBuilder(builder *array.ExtensionBuilder) array.Builder {
+	return &UuidBuilder{ExtensionBuilder: builder}
+}
+
+type UuidArray struct {
+	array.ExtensionArrayBase
+}
+
+func (uuidArray *UuidArray) Value(i int) uuid.UUID {
+	return uuid.UUID(uuidArray.Storage().(*array.FixedSizeBinary).Value(i))
+}
+
+func (uuidArray *UuidArray) ValueStr(i int) string {
+	if uuidArray.IsNull(i) {
+		return array.NullValueStr
+	}
+
+	return uuidArray.Value(i).String()
+}
+
+func (uuidArray *UuidArray) String() string {
+	values := make([]string, uuidArray.Len())
+	for i := range values {
+		values[i] = uuidArray.ValueStr(i)
+	}
+
+	return "[" + strings.Join(values, " ") + "]"
+}
+
+func (uuidArray *UuidArray) GetOneForMarshal(i int) interface{} {
+	if uuidArray.IsNull(i) {
+		return nil
+	}
+
+	return uuidArray.Value(i).String()
+}
+
+func (uuidArray *UuidArray) MarshalJSON() ([]byte, error) {
+	values := make([]interface{}, uuidArray.Len())
+	for i := range values {
+		values[i] = uuidArray.GetOneForMarshal(i)
+	}
+
+	return json.Marshal(values)
+}
+
+type UuidBuilder struct {
+	*array.ExtensionBuilder
+}
+
+func (builder *UuidBuilder) Append(value uuid.UUID) {
+	builder.Builder.(*array.FixedSizeBinaryBuilder).Append(value[:])
+}
+
+func (builder *UuidBuilder) AppendValueFromString(s string) error {
+	if s == array.NullValueStr {
+		builder.AppendNull()
+		return nil
+	}
+
+	value, err := uuid.Parse(s)
+	if err != nil {
+		return err
+	}
+
+	builder.Append(value)
+	return nil
+}
+
+func (builder *UuidBuilder) UnmarshalOne(decoder *json.Decoder) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	switch value := token.(type) {
+	case nil:
+		builder.AppendNull()
+	case string:
+		parsed, err := uuid.Parse(value)
+		if err != nil {
+			return errors.New(fmt.Sprintf("value: '%s' is not a uuid: %s", value, err))
+		}
+
+		builder.Append(parsed)
+	default:
+		return &json.UnmarshalTypeError{Value: fmt.Sprint(token), Type: reflect.TypeOf(""), Offset: decoder.InputOffset()}
+	}
+
+	return nil
+}
+
+func (builder *UuidBuilder) Unmarshal(decoder *json.Decoder) error {
+	for decoder.More() {
+		if err := builder.UnmarshalOne(decoder); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (builder *UuidBuilder) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	if delimiter, ok := token.(json.Delim); !ok || delimiter != '[' {
+		return errors.New(fmt.Sprintf("uuid builder expects a json array, got: '%v'", token))
+	}
+
+	return builder.Unmarshal(decoder)
+}
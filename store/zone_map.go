@@ -0,0 +1,375 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/apache/arrow/go/v13/arrow"
+	"github.com/apache/arrow/go/v13/arrow/array"
+	"github.com/apache/arrow/go/v13/arrow/compute"
+	"github.com/apache/arrow/go/v13/arrow/compute/exprs"
+	"github.com/apache/arrow/go/v13/arrow/memory"
+	"github.com/apache/arrow/go/v13/arrow/scalar"
+	"github.com/exsql-io/go-datastore/engine"
+	"github.com/substrait-io/substrait-go/expr"
+	"github.com/substrait-io/substrait-go/types"
+	"math"
+	"strings"
+)
+
+// zoneMap holds the statistics of the columns of a sealed record which let an iterator skip it.
+type zoneMap struct {
+	rows    int64
+	columns []columnZone
+}
+
+// columnZone holds the number of nulls of a column and its bounds: its minimum and its maximum, decoded from their
+// dictionary or extension, or nil when the column has no order or no value to bound.
+type columnZone struct {
+	nulls  int64
+	bounds arrow.Array
+}
+
+// newZoneMap computes the zone map of record, its bounds are copied out of it.
+func newZoneMap(record arrow.Record, allocator memory.Allocator) (zoneMap, error) {
+	zones := zoneMap{rows: record.NumRows(), columns: make([]columnZone, record.NumCols())}
+	for index, column := range record.Columns() {
+		zones.columns[index].nulls = int64(column.NullN())
+		if !orderable(column.DataType()) {
+			continue
+		}
+
+		low, high := -1, -1
+		for row := 0; row < column.Len(); row++ {
+			if column.IsNull(row) || isNaN(column, row) {
+				continue
+			}
+
+			if low < 0 || engine.CompareValues(column, row, column, low) < 0 {
+				low = row
+			}
+
+			if high < 0 || engine.CompareValues(column, row, column, high) > 0 {
+				high = row
+			}
+		}
+
+		if low < 0 {
+			continue
+		}
+
+		lowValue, highValue := decodedSlice(column, low), decodedSlice(column, high)
+		bounds, err := array.Concatenate([]arrow.Array{lowValue, highValue}, allocator)
+		lowValue.Release()
+		highValue.Release()
+		if err != nil {
+			zones.release()
+			return zoneMap{}, err
+		}
+
+		zones.columns[index].bounds = bounds
+	}
+
+	return zones, nil
+}
+
+func (zones zoneMap) release() {
+	for _, zone := range zones.columns {
+		if zone.bounds != nil {
+			zone.bounds.Release()
+		}
+	}
+}
+
+// Predicate is a condition pushed down to the iterator of a store, which skips the records none of the rows of which
+// can satisfy it according to their zone maps, and the rows of the indexed records its equalities rule out. The other
+// rows are not filtered.
+type Predicate struct {
+	ctx        context.Context
+	conditions []expr.Expression
+}
+
+// NewPredicate returns the predicate satisfied by the rows satisfying every condition, the literals of which are
+// evaluated with ctx, see engine.EvaluateExpression.
+func NewPredicate(ctx context.Context, conditions ...expr.Expression) *Predicate {
+	return &Predicate{ctx: ctx, conditions: conditions}
+}
+
+// mayMatch returns whether a row of the record described by zones may satisfy the predicate.
+func (predicate *Predicate) mayMatch(zones zoneMap) bool {
+	if predicate == nil || zones.columns == nil {
+		return true
+	}
+
+	for _, condition := range predicate.conditions {
+		for _, conjunct := range conjuncts(condition) {
+			if excludes(predicate.ctx, zones, conjunct) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// conjuncts returns the conditions combined by the and functions of condition.
+func conjuncts(condition expr.Expression) []expr.Expression {
+	function, ok := condition.(*expr.ScalarFunction)
+	if !ok || functionName(function) != "and" {
+		return []expr.Expression{condition}
+	}
+
+	var flattened []expr.Expression
+	for i := 0; i < function.NArgs(); i++ {
+		argument, ok := function.Arg(i).(expr.Expression)
+		if !ok {
+			return []expr.Expression{condition}
+		}
+
+		flattened = append(flattened, conjuncts(argument)...)
+	}
+
+	return flattened
+}
+
+// excludes returns whether no row of the record described by zones can satisfy condition, it only handles the null
+// checks of columns and the comparisons of columns with constants. Any error leaves the record in.
+func excludes(ctx context.Context, zones zoneMap, condition expr.Expression) bool {
+	function, ok := condition.(*expr.ScalarFunction)
+	if !ok || function.NArgs() == 0 {
+		return false
+	}
+
+	name := functionName(function)
+	switch name {
+	case "is_null", "is_not_null":
+		column, _, ok := columnOperand(function.Arg(0), len(zones.columns))
+		if !ok {
+			return false
+		}
+
+		nulls := zones.columns[column].nulls
+		return (name == "is_null" && nulls == 0) || (name == "is_not_null" && nulls == zones.rows)
+	case "equal", "lt", "lte", "gt", "gte":
+	default:
+		return false
+	}
+
+	if function.NArgs() != 2 {
+		return false
+	}
+
+	left, right := function.Arg(0), function.Arg(1)
+	column, cast, ok := columnOperand(left, len(zones.columns))
+	if !ok {
+		// the comparison is mirrored to compare the column with the constant.
+		column, cast, ok = columnOperand(right, len(zones.columns))
+		right = left
+		name = map[string]string{"equal": "equal", "lt": "gt", "lte": "gte", "gt": "lt", "gte": "lte"}[name]
+	}
+
+	constant, isExpression := right.(expr.Expression)
+	if !ok || !isExpression || !isConstant(constant) {
+		return false
+	}
+
+	// a comparison with a null is never satisfied.
+	zone := zones.columns[column]
+	if zone.nulls == zones.rows {
+		return true
+	}
+
+	if zone.bounds == nil {
+		return false
+	}
+
+	bounds, err := castBounds(ctx, zone.bounds, cast)
+	if err != nil {
+		return false
+	}
+
+	defer bounds.Release()
+
+	value, err := constantValue(ctx, constant, bounds.DataType())
+	if err != nil {
+		return false
+	}
+
+	defer value.Release()
+
+	if value.IsNull(0) {
+		return true
+	}
+
+	low, high := engine.CompareValues(bounds, 0, value, 0), engine.CompareValues(bounds, 1, value, 0)
+	switch name {
+	case "equal":
+		return low > 0 || high < 0
+	case "lt":
+		return low >= 0
+	case "lte":
+		return low > 0
+	case "gt":
+		return high <= 0
+	case "gte":
+		return high < 0
+	}
+
+	return false
+}
+
+// constantValue evaluates constant as a single value of dataType, the type of the bounds it is compared with.
+func constantValue(ctx context.Context, constant expr.Expression, dataType arrow.DataType) (arrow.Array, error) {
+	value, err := engine.EvaluateScalar(ctx, constant)
+	if err != nil {
+		return nil, err
+	}
+
+	// the bounds of the extension columns are bounds of their storage.
+	if extension, ok := value.(*scalar.Extension); ok && extension.IsValid() {
+		value = extension.Value
+	}
+
+	values, err := scalar.MakeArrayFromScalar(value, 1, compute.GetAllocator(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if arrow.TypeEqual(values.DataType(), dataType) {
+		return values, nil
+	}
+
+	defer values.Release()
+
+	return compute.CastArray(ctx, values, compute.SafeCastOptions(dataType))
+}
+
+// castBounds returns bounds cast as the column they bound is by cast, when set.
+func castBounds(ctx context.Context, bounds arrow.Array, cast *expr.Cast) (arrow.Array, error) {
+	if cast == nil {
+		bounds.Retain()
+		return bounds, nil
+	}
+
+	dataType, _, err := exprs.FromSubstraitType(cast.Type, exprs.GetExtensionIDSet(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if arrow.TypeEqual(bounds.DataType(), dataType) {
+		bounds.Retain()
+		return bounds, nil
+	}
+
+	if family(bounds.DataType()) == "" || family(bounds.DataType()) != family(dataType) {
+		return nil, errors.New(fmt.Sprintf("cast from: '%s' to: '%s' may not preserve the order of the values", bounds.DataType(), dataType))
+	}
+
+	return compute.CastArray(ctx, bounds, compute.SafeCastOptions(dataType))
+}
+
+// columnOperand returns the index of the top-level column, out of width, referenced by argument, which may be cast.
+func columnOperand(argument types.FuncArg, width int) (int, *expr.Cast, bool) {
+	cast, isCast := argument.(*expr.Cast)
+	if isCast {
+		argument = cast.Input
+	}
+
+	reference, ok := argument.(*expr.FieldReference)
+	if !ok || reference.Root != expr.RootReference {
+		return 0, nil, false
+	}
+
+	field, ok := reference.Reference.(*expr.StructFieldRef)
+	if !ok || field.Child != nil || field.Field < 0 || int(field.Field) >= width {
+		return 0, nil, false
+	}
+
+	return int(field.Field), cast, true
+}
+
+// isConstant returns whether expression references no column.
+func isConstant(expression expr.Expression) bool {
+	switch e := expression.(type) {
+	case expr.Literal:
+		return true
+	case *expr.Cast:
+		return isConstant(e.Input)
+	case *expr.ScalarFunction:
+		for i := 0; i < e.NArgs(); i++ {
+			if argument, ok := e.Arg(i).(expr.Expression); ok && !isConstant(argument) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+func functionName(function *expr.ScalarFunction) string {
+	name, _, _ := strings.Cut(function.ID().Name, ":")
+	return name
+}
+
+// orderable returns whether the values of dataType can be bounded.
+func orderable(dataType arrow.DataType) bool {
+	switch t := dataType.(type) {
+	case *arrow.DictionaryType:
+		return orderable(t.ValueType)
+	case arrow.ExtensionType:
+		return orderable(t.StorageType())
+	}
+
+	switch dataType.ID() {
+	case arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64, arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64,
+		arrow.FLOAT32, arrow.FLOAT64, arrow.STRING, arrow.BINARY, arrow.FIXED_SIZE_BINARY, arrow.DECIMAL128,
+		arrow.TIMESTAMP, arrow.DATE32, arrow.TIME32, arrow.TIME64, arrow.DURATION:
+		return true
+	}
+
+	return false
+}
+
+// family returns the family of dataType, the casts between the types of a family preserve the order of the values.
+func family(dataType arrow.DataType) string {
+	switch dataType.ID() {
+	case arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64, arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64,
+		arrow.FLOAT32, arrow.FLOAT64, arrow.DECIMAL128:
+		return "numeric"
+	case arrow.TIMESTAMP, arrow.DATE32:
+		return "temporal"
+	case arrow.TIME32, arrow.TIME64:
+		return "time"
+	case arrow.DURATION:
+		return "duration"
+	case arrow.STRING, arrow.LARGE_STRING:
+		return "string"
+	}
+
+	return ""
+}
+
+// decodedSlice returns the value at row of column, decoded from its dictionary or extension.
+func decodedSlice(column arrow.Array, row int) arrow.Array {
+	switch c := column.(type) {
+	case *array.Dictionary:
+		return decodedSlice(c.Dictionary(), c.GetValueIndex(row))
+	case array.ExtensionArray:
+		return decodedSlice(c.Storage(), row)
+	}
+
+	return array.NewSlice(column, int64(row), int64(row+1))
+}
+
+func isNaN(column arrow.Array, row int) bool {
+	switch c := column.(type) {
+	case *array.Float32:
+		return math.IsNaN(float64(c.Value(row)))
+	case *array.Float64:
+		return math.IsNaN(c.Value(row))
+	}
+
+	return false
+}